@@ -0,0 +1,243 @@
+package genodatastruct
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+//BGZF (blocked gzip) is a series of gzip members of at most 64KB, each
+//carrying its compressed size in the "BC" extra subfield. It is the
+//compression of bgzip, BAM and tabix files and allows random access by
+//decompressing a single block
+
+//bgzfBlock locates a block in the compressed and uncompressed streams
+type bgzfBlock struct {
+	coffset, uoffset int64
+	usize            int64
+}
+
+//BgzfReader reads a bgzip compressed file at uncompressed offsets
+type BgzfReader struct {
+	file   *os.File
+	blocks []bgzfBlock
+	//the last decompressed block
+	cached int
+	data   []byte
+}
+
+//IsBgzf tells whether the file starts with a BGZF block header
+func IsBgzf(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	header := make([]byte, 18)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false, nil
+	}
+	_, err = bgzfBlockSize(header)
+	return err == nil, nil
+}
+
+//bgzfBlockSize parses a block header and returns the size of the whole block
+func bgzfBlockSize(header []byte) (int, error) {
+	if header[0] != 31 || header[1] != 139 || header[2] != 8 || header[3]&4 == 0 {
+		return 0, errors.New("not a BGZF block")
+	}
+	xlen := int(binary.LittleEndian.Uint16(header[10:12]))
+	extra := header[12:]
+	if len(extra) > xlen {
+		extra = extra[:xlen]
+	}
+	for len(extra) >= 4 {
+		slen := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if extra[0] == 'B' && extra[1] == 'C' && slen == 2 && len(extra) >= 6 {
+			return int(binary.LittleEndian.Uint16(extra[4:6])) + 1, nil
+		}
+		if len(extra) < 4+slen {
+			break
+		}
+		extra = extra[4+slen:]
+	}
+	return 0, errors.New("BGZF block without BC subfield")
+}
+
+//OpenBgzf opens a bgzip compressed file and indexes its blocks by walking
+//the block headers
+func OpenBgzf(path string) (*BgzfReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &BgzfReader{file: f, cached: -1}
+	header := make([]byte, 18)
+	footer := make([]byte, 4)
+	var coffset, uoffset int64
+	for {
+		if _, err := f.ReadAt(header, coffset); err == io.EOF {
+			break
+		} else if err != nil {
+			f.Close()
+			return nil, err
+		}
+		size, err := bgzfBlockSize(header)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s at offset %d: %v", path, coffset, err)
+		}
+		//ISIZE, the uncompressed size, ends the block
+		if _, err := f.ReadAt(footer, coffset+int64(size)-4); err != nil {
+			f.Close()
+			return nil, err
+		}
+		usize := int64(binary.LittleEndian.Uint32(footer))
+		if usize > 0 {
+			r.blocks = append(r.blocks, bgzfBlock{coffset, uoffset, usize})
+		}
+		coffset += int64(size)
+		uoffset += usize
+	}
+	return r, nil
+}
+
+//block decompresses the i-th block
+func (r *BgzfReader) block(i int) ([]byte, error) {
+	if i == r.cached {
+		return r.data, nil
+	}
+	header := make([]byte, 18)
+	if _, err := r.file.ReadAt(header, r.blocks[i].coffset); err != nil {
+		return nil, err
+	}
+	size, err := bgzfBlockSize(header)
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]byte, size)
+	if _, err := r.file.ReadAt(raw, r.blocks[i].coffset); err != nil {
+		return nil, err
+	}
+	xlen := int(binary.LittleEndian.Uint16(raw[10:12]))
+	data, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(raw[12+xlen : size-8])))
+	if err != nil {
+		return nil, err
+	}
+	r.cached, r.data = i, data
+	return data, nil
+}
+
+//ReadAt fills p from the uncompressed offset
+func (r *BgzfReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		i := sort.Search(len(r.blocks), func(i int) bool { return r.blocks[i].uoffset+r.blocks[i].usize > pos })
+		if i == len(r.blocks) {
+			return n, io.EOF
+		}
+		data, err := r.block(i)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], data[pos-r.blocks[i].uoffset:])
+	}
+	return n, nil
+}
+
+//Size of the uncompressed stream
+func (r *BgzfReader) Size() int64 {
+	if len(r.blocks) == 0 {
+		return 0
+	}
+	last := r.blocks[len(r.blocks)-1]
+	return last.uoffset + last.usize
+}
+
+func (r *BgzfReader) Close() error {
+	return r.file.Close()
+}
+
+//bgzfMaxBlock is the uncompressed data of a block, small enough for the
+//compressed block to stay under 64KB even for incompressible data
+const bgzfMaxBlock = 0xff00
+
+//bgzfEOF is the empty block ending a BGZF file
+var bgzfEOF = []byte{31, 139, 8, 4, 0, 0, 0, 0, 0, 255, 6, 0, 'B', 'C', 2, 0, 27, 0, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+
+//BgzfWriter compresses a stream into BGZF blocks
+type BgzfWriter struct {
+	w    io.Writer
+	data []byte
+	buf  bytes.Buffer
+	fw   *flate.Writer
+}
+
+func NewBgzfWriter(w io.Writer) *BgzfWriter {
+	fw, _ := flate.NewWriter(nil, flate.DefaultCompression)
+	return &BgzfWriter{w: w, fw: fw}
+}
+
+//Write buffers p, writing the blocks filled
+func (bw *BgzfWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		room := bgzfMaxBlock - len(bw.data)
+		if room > len(p) {
+			room = len(p)
+		}
+		bw.data = append(bw.data, p[:room]...)
+		p = p[room:]
+		if len(bw.data) == bgzfMaxBlock {
+			if err := bw.Flush(); err != nil {
+				return n - len(p), err
+			}
+		}
+	}
+	return n, nil
+}
+
+//Flush writes the buffered data as a block
+func (bw *BgzfWriter) Flush() error {
+	if len(bw.data) == 0 {
+		return nil
+	}
+	bw.buf.Reset()
+	bw.fw.Reset(&bw.buf)
+	if _, err := bw.fw.Write(bw.data); err != nil {
+		return err
+	}
+	if err := bw.fw.Close(); err != nil {
+		return err
+	}
+	header := []byte{31, 139, 8, 4, 0, 0, 0, 0, 0, 255, 6, 0, 'B', 'C', 2, 0, 0, 0}
+	binary.LittleEndian.PutUint16(header[16:], uint16(len(header)+bw.buf.Len()+8-1))
+	footer := make([]byte, 8)
+	binary.LittleEndian.PutUint32(footer, crc32.ChecksumIEEE(bw.data))
+	binary.LittleEndian.PutUint32(footer[4:], uint32(len(bw.data)))
+	bw.data = bw.data[:0]
+	for _, part := range [][]byte{header, bw.buf.Bytes(), footer} {
+		if _, err := bw.w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Close writes the last block and the end of file block, the underlying
+//writer stays open
+func (bw *BgzfWriter) Close() error {
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	_, err := bw.w.Write(bgzfEOF)
+	return err
+}
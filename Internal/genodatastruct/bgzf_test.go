@@ -0,0 +1,39 @@
+package genodatastruct
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestBgzfWriter(t *testing.T) {
+	//three blocks, the last one partial
+	data := bytes.Repeat([]byte("ACGTTGCA"), 2*bgzfMaxBlock/8+100)
+	var buf bytes.Buffer
+	bw := NewBgzfWriter(&buf)
+	bw.Write(data[:10])
+	bw.Write(data[10:])
+	if err := bw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(buf.Bytes(), bgzfEOF) {
+		t.Error("no end of file block")
+	}
+	path := filepath.Join(t.TempDir(), "data.gz")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenBgzf(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if len(r.blocks) != 3 || r.Size() != int64(len(data)) {
+		t.Fatalf("%d blocks of %d bytes, want 3 of %d", len(r.blocks), r.Size(), len(data))
+	}
+	got := make([]byte, 20)
+	if _, err := r.ReadAt(got, bgzfMaxBlock-10); err != nil || !bytes.Equal(got, data[bgzfMaxBlock-10:bgzfMaxBlock+10]) {
+		t.Errorf("read %q across blocks, want %q (%v)", got, data[bgzfMaxBlock-10:bgzfMaxBlock+10], err)
+	}
+}
@@ -0,0 +1,216 @@
+package genodatastruct
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//FaiRec is a line of a samtools .fai index: the sequence length, the offset
+//of its first base and the bases and bytes of each line
+type FaiRec struct {
+	Name      string
+	Length    int
+	Offset    int64
+	LineBases int
+	LineWidth int
+}
+
+//Fasta reads regions of an indexed FASTA file, plain or bgzip compressed
+type Fasta struct {
+	reader io.ReaderAt
+	closer io.Closer
+	Index  map[string]FaiRec //keyed by ChroSym of the sequence name
+	mu     sync.Mutex
+}
+
+//OpenFasta opens a FASTA file with its .fai index. Without an index the
+//sequences are indexed in memory by reading the file once
+func OpenFasta(path string) (*Fasta, error) {
+	fa := &Fasta{Index: map[string]FaiRec{}}
+	isBgzf, err := IsBgzf(path)
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	if isBgzf {
+		r, err := OpenBgzf(path)
+		if err != nil {
+			return nil, err
+		}
+		fa.reader, fa.closer, size = r, r, r.Size()
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		fa.reader, fa.closer, size = f, f, info.Size()
+	}
+	var recs []FaiRec
+	if fai, err := os.Open(path + ".fai"); err == nil {
+		recs, err = ReadFai(fai)
+		fai.Close()
+		if err != nil {
+			fa.Close()
+			return nil, fmt.Errorf("%s.fai: %v", path, err)
+		}
+	} else {
+		recs, err = BuildFai(io.NewSectionReader(fa.reader, 0, size))
+		if err != nil {
+			fa.Close()
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	for _, rec := range recs {
+		fa.Index[ChroSym(rec.Name)] = rec
+	}
+	return fa, nil
+}
+
+//ReadFai parses a .fai index
+func ReadFai(r io.Reader) ([]FaiRec, error) {
+	recs := []FaiRec{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 5 {
+			continue
+		}
+		nums := make([]int64, 4)
+		for i := range nums {
+			n, err := strconv.ParseInt(fields[i+1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad index line %q", scanner.Text())
+			}
+			nums[i] = n
+		}
+		recs = append(recs, FaiRec{fields[0], int(nums[0]), nums[1], int(nums[2]), int(nums[3])})
+	}
+	return recs, scanner.Err()
+}
+
+//BuildFai indexes the sequences of an uncompressed FASTA stream. Lines of a
+//sequence must have the same length except the last one
+func BuildFai(r io.Reader) ([]FaiRec, error) {
+	recs := []FaiRec{}
+	br := bufio.NewReader(r)
+	var offset int64
+	var rec *FaiRec
+	short := false //a line shorter than the others was seen
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			width := len(line)
+			bases := len(bytes.TrimRight(line, "\r\n"))
+			if line[0] == '>' {
+				if rec != nil {
+					recs = append(recs, *rec)
+				}
+				name := strings.Fields(string(line[1:bases]))
+				if len(name) == 0 {
+					return nil, fmt.Errorf("sequence without name at offset %d", offset)
+				}
+				rec = &FaiRec{Name: name[0], Offset: offset + int64(width)}
+				short = false
+			} else if rec != nil && bases > 0 {
+				if rec.LineBases == 0 {
+					rec.LineBases, rec.LineWidth = bases, width
+				} else if short || bases > rec.LineBases {
+					return nil, fmt.Errorf("different line lengths in %s", rec.Name)
+				}
+				if bases < rec.LineBases {
+					short = true
+				}
+				rec.Length += bases
+			}
+			offset += int64(width)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if rec != nil {
+		recs = append(recs, *rec)
+	}
+	return recs, nil
+}
+
+//Fetch the upper case sequence of the region (1-based, inclusive) on the
+//forward strand. The region is clipped to the sequence
+func (fa *Fasta) Fetch(chromosome string, region Coor) (string, error) {
+	rec, ok := fa.Index[ChroSym(chromosome)]
+	if !ok {
+		return "", fmt.Errorf("sequence %s not in the FASTA index", chromosome)
+	}
+	if region.Start < 1 {
+		region.Start = 1
+	}
+	if region.End > rec.Length {
+		region.End = rec.Length
+	}
+	if region.End < region.Start {
+		return "", nil
+	}
+	position := func(base int) int64 { //byte offset of a 0-based base
+		return rec.Offset + int64(base/rec.LineBases)*int64(rec.LineWidth) + int64(base%rec.LineBases)
+	}
+	from, to := position(region.Start-1), position(region.End-1)+1
+	raw := make([]byte, to-from)
+	fa.mu.Lock()
+	n, err := fa.reader.ReadAt(raw, from)
+	fa.mu.Unlock()
+	if err != nil && !(err == io.EOF && n == len(raw)) {
+		return "", err
+	}
+	seq := make([]byte, 0, region.End-region.Start+1)
+	for _, b := range raw {
+		if b != '\n' && b != '\r' {
+			seq = append(seq, b)
+		}
+	}
+	return strings.ToUpper(string(seq)), nil
+}
+
+func (fa *Fasta) Close() error {
+	return fa.closer.Close()
+}
+
+//ReverseComplement of a DNA sequence, letters other than ACGT are kept
+func ReverseComplement(seq string) string {
+	rc := make([]byte, len(seq))
+	for i := 0; i < len(seq); i++ {
+		b := seq[len(seq)-1-i]
+		switch b {
+		case 'A':
+			b = 'T'
+		case 'C':
+			b = 'G'
+		case 'G':
+			b = 'C'
+		case 'T':
+			b = 'A'
+		case 'a':
+			b = 't'
+		case 'c':
+			b = 'g'
+		case 'g':
+			b = 'c'
+		case 't':
+			b = 'a'
+		}
+		rc[i] = b
+	}
+	return string(rc)
+}
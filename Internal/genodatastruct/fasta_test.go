@@ -0,0 +1,80 @@
+package genodatastruct
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+//bgzfTestBlock compresses data into one BGZF block
+func bgzfTestBlock(t *testing.T, data []byte) []byte {
+	var deflated bytes.Buffer
+	fw, err := flate.NewWriter(&deflated, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	fw.Close()
+	block := []byte{31, 139, 8, 4, 0, 0, 0, 0, 0, 255, 6, 0, 'B', 'C', 2, 0, 0, 0}
+	binary.LittleEndian.PutUint16(block[16:], uint16(len(block)+deflated.Len()+8-1))
+	footer := make([]byte, 8)
+	binary.LittleEndian.PutUint32(footer, crc32.ChecksumIEEE(data))
+	binary.LittleEndian.PutUint32(footer[4:], uint32(len(data)))
+	return append(append(block, deflated.Bytes()...), footer...)
+}
+
+func TestFasta(t *testing.T) {
+	dir := t.TempDir()
+	fasta := ">chr1 first\nACGTACGTAC\nGTacgtAAAA\nCC\n>2\nTTTTGGGG\nAA\n"
+	plain := filepath.Join(dir, "plain.fa")
+	if err := ioutil.WriteFile(plain, []byte(fasta), 0644); err != nil {
+		t.Fatal(err)
+	}
+	//two blocks splitting the second line and the empty end of file block
+	compressed := filepath.Join(dir, "genome.fa.gz")
+	data := append(bgzfTestBlock(t, []byte(fasta[:20])), bgzfTestBlock(t, []byte(fasta[20:]))...)
+	data = append(data, bgzfTestBlock(t, nil)...)
+	if err := ioutil.WriteFile(compressed, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	indexed := filepath.Join(dir, "indexed.fa")
+	ioutil.WriteFile(indexed, []byte(fasta), 0644)
+	ioutil.WriteFile(indexed+".fai", []byte("chr1\t22\t12\t10\t11\n2\t10\t40\t8\t9\n"), 0644)
+
+	cases := []struct {
+		chromosome string
+		region     Coor
+		seq        string
+	}{
+		{"chr1", Coor{Start: 1, End: 4}, "ACGT"},
+		{"1", Coor{Start: 9, End: 14}, "ACGTAC"},
+		{"chr1", Coor{Start: 20, End: 30}, "ACC"},
+		{"chr2", Coor{Start: 7, End: 10}, "GGAA"},
+	}
+	for _, path := range []string{plain, compressed, indexed} {
+		fa, err := OpenFasta(path)
+		if err != nil {
+			t.Fatal(path, err)
+		}
+		if rec := fa.Index["chr2"]; rec.Length != 10 || rec.Offset != 40 || rec.LineBases != 8 || rec.LineWidth != 9 {
+			t.Errorf("%s: index of chr2 %+v", path, rec)
+		}
+		for _, c := range cases {
+			seq, err := fa.Fetch(c.chromosome, c.region)
+			if err != nil {
+				t.Fatal(path, err)
+			}
+			if seq != c.seq {
+				t.Errorf("%s: %s:%d-%d got %s, want %s", path, c.chromosome, c.region.Start, c.region.End, seq, c.seq)
+			}
+		}
+		if _, err := fa.Fetch("chrX", Coor{Start: 1, End: 2}); err == nil {
+			t.Errorf("%s: no error for a missing sequence", path)
+		}
+		fa.Close()
+	}
+}
@@ -24,6 +24,7 @@ type Transcript struct { //name, genomic locus, exon
 	Coordinate         Coor
 	Exons              []Coor //start and end locations of an exon
 	Introns            []Coor
+	CDS                []Coor //coding part of the exons, empty for non-coding transcripts
 	Attributes         map[string]string
 }
 
@@ -36,6 +37,9 @@ type Coor struct {
 //METHODS
 //###########################
 func MergeRegions(regions []Coor) []Coor {
+	if len(regions) == 0 {
+		return []Coor{}
+	}
 	//sort regions by start coor before merging
 	sort.Slice(regions, func(i, j int) bool { return regions[i].Start <= regions[j].Start })
 	//merge overlap region into a larger region
@@ -53,11 +57,14 @@ func MergeRegions(regions []Coor) []Coor {
 }
 
 //Region A overlaping with region B (more than 1bp)
+//either end of A inside B, or B inside A
 func (A Coor) Intersect(B Coor) bool {
 	if A.Start >= B.Start && A.Start <= B.End {
 		return true
 	} else if A.End >= B.Start && A.End <= B.End {
 		return true
+	} else if B.Inside(A) {
+		return true
 	} else {
 		return false
 	}
@@ -75,6 +82,9 @@ func (A Coor) Inside(B Coor) bool {
 //Interval region take in a SORTED region list and return the intervals
 //demarcated by the list
 func IntervalRegions(regions []Coor) []Coor {
+	if len(regions) < 2 {
+		return []Coor{}
+	}
 	interval := make([]Coor, len(regions)-1)
 	for i := 0; i < len(interval); i++ {
 		interval[i] = Coor{regions[i].End + 1, regions[i+1].Start - 1}
@@ -82,6 +92,29 @@ func IntervalRegions(regions []Coor) []Coor {
 	return interval
 }
 
+//SubtractRegions removes the SORTED and merged regions from a region
+//and return the remaining parts
+func SubtractRegions(region Coor, regions []Coor) []Coor {
+	remain := []Coor{}
+	from := sort.Search(len(regions), func(i int) bool { return regions[i].End >= region.Start })
+	start := region.Start
+	for _, reg := range regions[from:] {
+		if reg.Start > region.End {
+			break
+		}
+		if reg.Start > start {
+			remain = append(remain, Coor{start, reg.Start - 1})
+		}
+		if reg.End+1 > start {
+			start = reg.End + 1
+		}
+	}
+	if start <= region.End {
+		remain = append(remain, Coor{start, region.End})
+	}
+	return remain
+}
+
 //MergeExons merges all the exons of a gene to
 //produce a joint set of exons of a gene locus
 func (g *Gene) MergeExons() []Coor {
@@ -110,6 +143,16 @@ func (g *Gene) Contains(region Coor) bool {
 	return region.Inside(g.Coordinate)
 }
 
+//Transcript of the gene by its name, nil if the gene does not have it
+func (g *Gene) Transcript(name string) *Transcript {
+	for _, t := range g.Transcripts {
+		if t.TranscriptName == name {
+			return t
+		}
+	}
+	return nil
+}
+
 //Introns of a transcript
 func (t *Transcript) GenerateIntrons() []Coor {
 	if t.Strand == "+" {
@@ -122,6 +165,33 @@ func (t *Transcript) GenerateIntrons() []Coor {
 	}
 }
 
+//CodingSpan is the region from the first to the last coding base
+//of the transcript. ok is false for a non-coding transcript
+func (t *Transcript) CodingSpan() (span Coor, ok bool) {
+	if len(t.CDS) == 0 {
+		return Coor{}, false
+	}
+	span = t.CDS[0]
+	for _, cds := range t.CDS {
+		if cds.Start < span.Start {
+			span.Start = cds.Start
+		}
+		if cds.End > span.End {
+			span.End = cds.End
+		}
+	}
+	return span, true
+}
+
+//Length of the spliced transcript, the sum of its exon lengths
+func (t *Transcript) Length() int {
+	length := 0
+	for _, exon := range t.Exons {
+		length += exon.End - exon.Start + 1
+	}
+	return length
+}
+
 //find the exon that intersect with a given region of a transcript
 func (t *Transcript) WhichExonIntersect(reg Coor) []int {
 	result := []int{}
@@ -0,0 +1,56 @@
+package genodatastruct
+
+import "testing"
+
+func TestIntersect(t *testing.T) {
+	b := Coor{100, 200}
+	tests := []struct {
+		a    Coor
+		want bool
+	}{
+		{Coor{120, 180}, true}, //inside
+		{Coor{50, 250}, true},  //containing
+		{Coor{100, 200}, true},
+		{Coor{50, 100}, true},
+		{Coor{200, 250}, true},
+		{Coor{150, 250}, true},
+		{Coor{50, 99}, false},
+		{Coor{201, 250}, false},
+	}
+	for _, test := range tests {
+		if got := test.a.Intersect(b); got != test.want {
+			t.Errorf("%v intersects %v: %t, want %t", test.a, b, got, test.want)
+		}
+		if got := b.Intersect(test.a); got != test.want {
+			t.Errorf("%v intersects %v: %t, want %t", b, test.a, got, test.want)
+		}
+	}
+}
+
+func TestSubtractRegions(t *testing.T) {
+	region := Coor{100, 200}
+	tests := []struct {
+		regions []Coor
+		want    []Coor
+	}{
+		{nil, []Coor{{100, 200}}},
+		{[]Coor{{10, 50}, {250, 300}}, []Coor{{100, 200}}},
+		{[]Coor{{10, 50}, {90, 110}, {120, 130}, {190, 250}}, []Coor{{111, 119}, {131, 189}}},
+		{[]Coor{{50, 100}, {200, 300}}, []Coor{{101, 199}}},
+		{[]Coor{{101, 199}}, []Coor{{100, 100}, {200, 200}}},
+		{[]Coor{{50, 300}}, []Coor{}},
+	}
+	for _, test := range tests {
+		got := SubtractRegions(region, test.regions)
+		if len(got) != len(test.want) {
+			t.Errorf("%v minus %v: %v, want %v", region, test.regions, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%v minus %v: %v, want %v", region, test.regions, got, test.want)
+				break
+			}
+		}
+	}
+}
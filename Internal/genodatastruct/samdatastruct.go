@@ -9,11 +9,45 @@ import (
 //Only take sam fields related to mapping info
 //not full support for all the sam fields yet
 type SamRec struct {
+	QName      string
 	Flag       int64
 	CIGAR      string
 	Pos        int
 	Chromosome string
 	MAPQ       int
+	Tags       []string //optional fields as TAG:TYPE:VALUE
+	Fields     []string //all the fields of the line, to write the alignment back
+}
+
+//Tag returns the value of an optional field
+func (sr *SamRec) Tag(name string) (string, bool) {
+	for _, tag := range sr.Tags {
+		if len(tag) > 5 && tag[:2] == name && tag[2] == ':' && tag[4] == ':' {
+			return tag[5:], true
+		}
+	}
+	return "", false
+}
+
+//IntTag returns the value of an integer optional field
+func (sr *SamRec) IntTag(name string) (int, bool) {
+	val, ok := sr.Tag(name)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+//NH is the number of reported alignments of the read, 1 without the NH tag
+func (sr *SamRec) NH() int {
+	if nh, ok := sr.IntTag("NH"); ok && nh > 0 {
+		return nh
+	}
+	return 1
 }
 
 func (sr *SamRec) Strand() string {
@@ -132,3 +166,88 @@ func (sr SamRec) RegionAligned() []Coor {
 	}
 	return aligned
 }
+
+//Mismatches are the reference positions of the mismatched bases of the
+//alignment by its MD tag, false without the tag. MD describes the matches,
+//mismatches and deletions of the CIGAR in order, skipping introns
+func (sr SamRec) Mismatches() ([]int, bool) {
+	md, ok := sr.Tag("MD")
+	if !ok {
+		return nil, false
+	}
+	positions := []int{}
+	pos, n := sr.Pos, 0
+	for _, c := range sr.CIGAR {
+		if c >= '0' && c <= '9' {
+			n = n*10 + int(c-'0')
+			continue
+		}
+		switch c {
+		case 'M', '=', 'X', 'D':
+			for i := 0; i < n; i++ {
+				positions = append(positions, pos+i)
+			}
+			pos += n
+		case 'N':
+			pos += n
+		}
+		n = 0
+	}
+	mismatches := []int{}
+	for i, k := 0, 0; k < len(md); {
+		switch c := md[k]; {
+		case c >= '0' && c <= '9':
+			n := 0
+			for ; k < len(md) && md[k] >= '0' && md[k] <= '9'; k++ {
+				n = n*10 + int(md[k]-'0')
+			}
+			i += n
+		case c == '^':
+			//deleted bases
+			for k++; k < len(md) && (md[k] < '0' || md[k] > '9'); k++ {
+				i++
+			}
+		default:
+			if i < len(positions) {
+				mismatches = append(mismatches, positions[i])
+			}
+			i++
+			k++
+		}
+	}
+	return mismatches, true
+}
+
+//AlignedBases are the bases aligned to the reference (M, = and X) of each
+//segment between the introns (N) of the alignment, in reference order.
+//Deleted and inserted bases are not aligned
+func (sr SamRec) AlignedBases() []int {
+	bases := []int{0}
+	n := 0
+	for _, c := range sr.CIGAR {
+		if c >= '0' && c <= '9' {
+			n = n*10 + int(c-'0')
+			continue
+		}
+		switch c {
+		case 'M', '=', 'X':
+			bases[len(bases)-1] += n
+		case 'N':
+			bases = append(bases, 0)
+		}
+		n = 0
+	}
+	return bases
+}
+
+//JunctionRec is a splice junction reported by an aligner or a junction
+//extraction tool, with the intron in 1-based inclusive coordinates
+type JunctionRec struct {
+	Chromosome  string
+	Strand      string //+, - or . if undefined
+	Intron      Coor
+	Unique      int
+	Multi       int
+	MaxOverhang int
+	Motif       int //STAR motif code, -1 if unknown
+}
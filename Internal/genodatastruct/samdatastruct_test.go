@@ -0,0 +1,44 @@
+package genodatastruct
+
+import "testing"
+
+func TestSamRecTags(t *testing.T) {
+	sr := SamRec{Tags: []string{"NM:i:2", "XS:A:+", "CB:Z:ACGT-1", "NHX", "AS:Z:high"}}
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{"NM", "2", true},
+		{"CB", "ACGT-1", true},
+		{"XS", "+", true},
+		{"NH", "", false},
+		{"UB", "", false},
+	}
+	for _, test := range tests {
+		if value, ok := sr.Tag(test.name); value != test.value || ok != test.ok {
+			t.Errorf("tag %s %q %t, want %q %t", test.name, value, ok, test.value, test.ok)
+		}
+	}
+	if n, ok := sr.IntTag("NM"); n != 2 || !ok {
+		t.Errorf("integer tag NM %d %t, want 2", n, ok)
+	}
+	if n, ok := sr.IntTag("AS"); n != 0 || ok {
+		t.Errorf("integer tag of a string %d %t", n, ok)
+	}
+
+	for _, test := range []struct {
+		tags []string
+		want int
+	}{
+		{nil, 1},
+		{[]string{"NH:i:3"}, 3},
+		{[]string{"NH:i:0"}, 1},
+		{[]string{"NH:Z:x"}, 1},
+	} {
+		sr := SamRec{Tags: test.tags}
+		if nh := sr.NH(); nh != test.want {
+			t.Errorf("NH of %v %d, want %d", test.tags, nh, test.want)
+		}
+	}
+}
@@ -15,6 +15,9 @@ type FeatureType string
 //Geneline, Trancriptline, Exonline are 3 major features recorded in Gtf
 const Geneline, Transcriptline, Exonline FeatureType = "gene", "transcript", "exon"
 
+//CDSline records the coding part of an exon
+const CDSline FeatureType = "CDS"
+
 //Parsegtf parses gtf file and return parsed gene in the geneset
 //if geneset=["all"] (a constant) it will stores all the genes
 func Parsegtf(gtf string, geneset []string) map[string]*genodatastruct.Gene {
@@ -69,6 +72,17 @@ func Parsegtf(gtf string, geneset []string) map[string]*genodatastruct.Gene {
 				Genes[geneid].Transcripts[idx].Exons = append(Genes[geneid].Transcripts[idx].Exons, genodatastruct.Coor{start, end})
 			}
 		}
+
+		if FeatureType(fields[2]) == CDSline {
+			idx := len(Genes[geneid].Transcripts) - 1
+			start, _ := strconv.Atoi(fields[3])
+			end, _ := strconv.Atoi(fields[4])
+			if allgene {
+				Genes[geneid].Transcripts[idx].CDS = append(Genes[geneid].Transcripts[idx].CDS, genodatastruct.Coor{start, end})
+			} else if _, has := hasgene(geneset, gene); has {
+				Genes[geneid].Transcripts[idx].CDS = append(Genes[geneid].Transcripts[idx].CDS, genodatastruct.Coor{start, end})
+			}
+		}
 	}
 	//println(duration)
 	return Genes
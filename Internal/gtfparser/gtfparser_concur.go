@@ -55,6 +55,9 @@ func (w *GatherGeneRecs) TakeGeneLines() {
 				genelines = append(genelines, fields)
 			}
 		}
+		if len(genelines) > 0 { //the last gene
+			w.out <- genelines
+		}
 		close(w.out)
 	}()
 }
@@ -88,6 +91,11 @@ func (w *MakeGeneStruct) GenereateGene() {
 					start, _ := strconv.Atoi(fields[3])
 					end, _ := strconv.Atoi(fields[4])
 					gene.Transcripts[idx].Exons = append(gene.Transcripts[idx].Exons, genodatastruct.Coor{start, end})
+				} else if FeatureType(fields[2]) == CDSline {
+					idx := len(gene.Transcripts) - 1
+					start, _ := strconv.Atoi(fields[3])
+					end, _ := strconv.Atoi(fields[4])
+					gene.Transcripts[idx].CDS = append(gene.Transcripts[idx].CDS, genodatastruct.Coor{start, end})
 				}
 			}
 			w.out <- GeneMapUnit{gene, geneid}
@@ -0,0 +1,75 @@
+package gtfparser
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//testGTF writes the lines, tab separated by |, into a GTF file
+func testGTF(t *testing.T, lines ...string) string {
+	path := filepath.Join(t.TempDir(), "test.gtf")
+	if err := ioutil.WriteFile(path, []byte(strings.ReplaceAll(strings.Join(lines, "\n"), "|", "\t")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParsegtfConcurrentLastGene(t *testing.T) {
+	gtf := testGTF(t,
+		"#comment",
+		`1|src|gene|10|20|.|+|.|gene_id "G0"; gene_name "ZERO";`,
+		`1|src|transcript|10|20|.|+|.|gene_id "G0"; gene_name "ZERO"; transcript_id "T0"; transcript_name "ZERO-201";`,
+		`1|src|exon|10|20|.|+|.|gene_id "G0"; gene_name "ZERO"; transcript_id "T0"; transcript_name "ZERO-201";`,
+		`1|src|gene|100|400|.|-|.|gene_id "G1"; gene_name "ONE";`,
+		`1|src|transcript|100|400|.|-|.|gene_id "G1"; gene_name "ONE"; transcript_id "T1"; transcript_name "ONE-201";`,
+		`1|src|exon|300|400|.|-|.|gene_id "G1"; gene_name "ONE"; transcript_id "T1"; transcript_name "ONE-201";`,
+		`1|src|exon|100|200|.|-|.|gene_id "G1"; gene_name "ONE"; transcript_id "T1"; transcript_name "ONE-201";`,
+	)
+	genes := ParsegtfConcurrent(gtf)
+	if len(genes) != 2 {
+		t.Fatalf("%d genes, want 2", len(genes))
+	}
+	//the last gene of the file has no gene line after it
+	last, ok := genes["G1"]
+	if !ok {
+		t.Fatal("last gene G1 missing")
+	}
+	if len(last.Transcripts) != 1 || len(last.Transcripts[0].Exons) != 2 {
+		t.Errorf("last gene %+v, want a transcript of 2 exons", last)
+	}
+}
+
+func TestParseCDS(t *testing.T) {
+	gtf := testGTF(t,
+		`1|src|gene|100|600|.|+|.|gene_id "G1"; gene_name "ONE";`,
+		`1|src|transcript|100|600|.|+|.|gene_id "G1"; gene_name "ONE"; transcript_id "T1"; transcript_name "ONE-201";`,
+		`1|src|exon|100|200|.|+|.|gene_id "G1"; gene_name "ONE"; transcript_id "T1"; transcript_name "ONE-201";`,
+		`1|src|CDS|150|200|.|+|0|gene_id "G1"; gene_name "ONE"; transcript_id "T1"; transcript_name "ONE-201";`,
+		`1|src|start_codon|150|152|.|+|0|gene_id "G1"; gene_name "ONE"; transcript_id "T1"; transcript_name "ONE-201";`,
+		`1|src|exon|500|600|.|+|.|gene_id "G1"; gene_name "ONE"; transcript_id "T1"; transcript_name "ONE-201";`,
+		`1|src|CDS|500|550|.|+|2|gene_id "G1"; gene_name "ONE"; transcript_id "T1"; transcript_name "ONE-201";`,
+		`1|src|transcript|100|600|.|+|.|gene_id "G1"; gene_name "ONE"; transcript_id "T2"; transcript_name "ONE-202";`,
+		`1|src|exon|100|600|.|+|.|gene_id "G1"; gene_name "ONE"; transcript_id "T2"; transcript_name "ONE-202";`,
+	)
+	parsers := map[string]func(string) map[string]*genodatastruct.Gene{
+		"Parsegtf":           func(gtf string) map[string]*genodatastruct.Gene { return Parsegtf(gtf, []string{"all"}) },
+		"ParsegtfConcurrent": ParsegtfConcurrent,
+	}
+	for name, parse := range parsers {
+		gene, ok := parse(gtf)["G1"]
+		if !ok || len(gene.Transcripts) != 2 {
+			t.Fatalf("%s: gene %+v, want 2 transcripts", name, gene)
+		}
+		cds := gene.Transcript("ONE-201").CDS
+		if len(cds) != 2 || cds[0] != (genodatastruct.Coor{Start: 150, End: 200}) || cds[1] != (genodatastruct.Coor{Start: 500, End: 550}) {
+			t.Errorf("%s: CDS %v of the coding transcript, want 150-200 and 500-550", name, cds)
+		}
+		if cds := gene.Transcript("ONE-202").CDS; len(cds) != 0 {
+			t.Errorf("%s: CDS %v of the noncoding transcript", name, cds)
+		}
+	}
+}
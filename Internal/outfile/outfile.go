@@ -0,0 +1,19 @@
+package outfile
+
+import (
+	"log"
+	"os"
+)
+
+//Write creates the file and fills it by the writer function, exiting on
+//any error
+func Write(path string, write func(*os.File) error) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	if err := write(f); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,96 @@
+package readfilter
+
+import (
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEnd tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp //comparison and logical operators
+	tokLParen
+	tokRParen
+)
+
+//token of an expression at byte offset pos
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+//operators, two characters first
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!"}
+
+//lex splits the expression into tokens ending with a tokEnd
+func lex(expr string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, &Error{Expr: expr, Pos: i, Msg: "unterminated string"}
+			}
+			tokens = append(tokens, token{tokString, expr[i+1 : i+1+end], i})
+			i += end + 2
+		case isDigit(c) || (c == '.' && i+1 < len(expr) && isDigit(expr[i+1])):
+			start := i
+			if strings.HasPrefix(expr[i:], "0x") || strings.HasPrefix(expr[i:], "0X") {
+				i += 2
+			}
+			for i < len(expr) && (isDigit(expr[i]) || isLetter(expr[i]) || expr[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokNumber, expr[start:i], start})
+		case isLetter(c):
+			start := i
+			for i < len(expr) && (isLetter(expr[i]) || isDigit(expr[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, expr[start:i], start})
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(expr[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				msg := "unexpected character " + string(c)
+				switch c {
+				case '=':
+					msg = "unexpected =, use == to compare"
+				case '&', '|':
+					msg = "unexpected " + string(c) + ", use " + string(c) + string(c)
+				}
+				return nil, &Error{Expr: expr, Pos: i, Msg: msg}
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokEnd, "", len(expr)}), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
@@ -0,0 +1,346 @@
+//Package readfilter compiles read filter expressions into the filter
+//callbacks of samparser.ParseSam, such as
+//
+//	mapq>=20 && !secondary && nm<=4 && tag(NH)==1
+//
+//Comparisons (== != < <= > >=) of fields, tags, numbers (0x for hex) and
+//quoted strings combine with &&, || and ! and parentheses. Fields are mapq,
+//flag, pos, nh (1 without the NH tag), nm and as (NM and AS tags), chr, name
+//and cigar. The flag bits are the booleans paired, proper, unmapped,
+//mateunmapped, reverse, matereverse, read1, read2, secondary, qcfail,
+//duplicate and supplementary, and spliced is true for the reads with an
+//intron. tag(XX) is the value of an optional field, alone it is true if the
+//field is present. Comparisons of a missing tag are false
+package readfilter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//Default keeps the alignments of mapping quality above 30
+const Default = "mapq>30"
+
+//Error of an expression, at the byte offset Pos of the bad token
+type Error struct {
+	Expr string
+	Pos  int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("read filter: %s at column %d\n\t%s\n\t%s^", e.Msg, e.Pos+1, e.Expr, strings.Repeat(" ", e.Pos))
+}
+
+//Compile the expression into a filter keeping the alignments it is true
+//for. An empty expression keeps all the alignments
+func Compile(expr string) (func(genodatastruct.SamRec) bool, error) {
+	if strings.TrimSpace(expr) == "" {
+		return func(genodatastruct.SamRec) bool { return true }, nil
+	}
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{expr: expr, tokens: tokens}
+	cond, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEnd {
+		return nil, p.errorf(t, "unexpected %s", describe(t))
+	}
+	return func(s genodatastruct.SamRec) bool { return cond(&s) }, nil
+}
+
+type condition func(*genodatastruct.SamRec) bool
+
+//operand of a comparison: a number, a text, or a tag that is either
+type operand struct {
+	tok  token
+	num  func(*genodatastruct.SamRec) (float64, bool)
+	text func(*genodatastruct.SamRec) (string, bool)
+}
+
+var numberFields = map[string]func(*genodatastruct.SamRec) (float64, bool){
+	"mapq": func(s *genodatastruct.SamRec) (float64, bool) { return float64(s.MAPQ), true },
+	"flag": func(s *genodatastruct.SamRec) (float64, bool) { return float64(s.Flag), true },
+	"pos":  func(s *genodatastruct.SamRec) (float64, bool) { return float64(s.Pos), true },
+	"nh":   func(s *genodatastruct.SamRec) (float64, bool) { return float64(s.NH()), true },
+	"nm":   intTag("NM"),
+	"as":   intTag("AS"),
+}
+
+var textFields = map[string]func(*genodatastruct.SamRec) (string, bool){
+	"chr":   func(s *genodatastruct.SamRec) (string, bool) { return s.Chromosome, true },
+	"name":  func(s *genodatastruct.SamRec) (string, bool) { return s.QName, true },
+	"cigar": func(s *genodatastruct.SamRec) (string, bool) { return s.CIGAR, true },
+}
+
+var flagBits = map[string]int64{
+	"paired":        0x1,
+	"proper":        0x2,
+	"unmapped":      0x4,
+	"mateunmapped":  0x8,
+	"reverse":       0x10,
+	"matereverse":   0x20,
+	"read1":         0x40,
+	"read2":         0x80,
+	"secondary":     0x100,
+	"qcfail":        0x200,
+	"duplicate":     0x400,
+	"supplementary": 0x800,
+}
+
+func intTag(name string) func(*genodatastruct.SamRec) (float64, bool) {
+	return func(s *genodatastruct.SamRec) (float64, bool) {
+		n, ok := s.IntTag(name)
+		return float64(n), ok
+	}
+}
+
+type parser struct {
+	expr   string
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEnd {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return &Error{Expr: p.expr, Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func describe(t token) string {
+	switch t.kind {
+	case tokEnd:
+		return "end of expression"
+	case tokString:
+		return "string " + strconv.Quote(t.text)
+	}
+	return strconv.Quote(t.text)
+}
+
+//or: and {|| and}
+func (p *parser) or() (condition, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOp && p.peek().text == "||" {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(s *genodatastruct.SamRec) bool { return l(s) || right(s) }
+	}
+	return left, nil
+}
+
+//and: unary {&& unary}
+func (p *parser) and() (condition, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOp && p.peek().text == "&&" {
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(s *genodatastruct.SamRec) bool { return l(s) && right(s) }
+	}
+	return left, nil
+}
+
+//unary: ! unary | ( or ) | comparison | boolean
+func (p *parser) unary() (condition, error) {
+	t := p.peek()
+	if t.kind == tokOp && t.text == "!" {
+		p.next()
+		cond, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(s *genodatastruct.SamRec) bool { return !cond(s) }, nil
+	}
+	if t.kind == tokLParen {
+		p.next()
+		cond, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if r := p.next(); r.kind != tokRParen {
+			return nil, p.errorf(r, "expected ) closing the ( at column %d, got %s", t.pos+1, describe(r))
+		}
+		return cond, nil
+	}
+	if t.kind == tokIdent && !isComparison(p.tokens[p.i+1]) {
+		name := strings.ToLower(t.text)
+		if bit, ok := flagBits[name]; ok {
+			p.next()
+			return func(s *genodatastruct.SamRec) bool { return s.Flag&bit != 0 }, nil
+		}
+		if name == "spliced" {
+			p.next()
+			return func(s *genodatastruct.SamRec) bool { return strings.Contains(s.CIGAR, "N") }, nil
+		}
+	}
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	op := p.peek()
+	if !isComparison(op) {
+		if left.tok.kind == tokIdent && strings.EqualFold(left.tok.text, "tag") {
+			//a tag alone tells its presence
+			return func(s *genodatastruct.SamRec) bool { _, ok := left.text(s); return ok }, nil
+		}
+		return nil, p.errorf(op, "expected a comparison after %s, got %s", describe(left.tok), describe(op))
+	}
+	p.next()
+	right, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	return p.compare(left, op, right)
+}
+
+func isComparison(t token) bool {
+	if t.kind != tokOp {
+		return false
+	}
+	switch t.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
+
+//operand: number | string | field | tag(XX)
+func (p *parser) operand() (operand, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if lower := strings.ToLower(t.text); strings.HasPrefix(lower, "0x") {
+			var n int64
+			n, err = strconv.ParseInt(lower[2:], 16, 64)
+			v = float64(n)
+		}
+		if err != nil {
+			return operand{}, p.errorf(t, "bad number %s", describe(t))
+		}
+		return operand{tok: t, num: func(*genodatastruct.SamRec) (float64, bool) { return v, true }}, nil
+	case tokString:
+		return operand{tok: t, text: func(*genodatastruct.SamRec) (string, bool) { return t.text, true }}, nil
+	case tokIdent:
+		name := strings.ToLower(t.text)
+		if f, ok := numberFields[name]; ok {
+			return operand{tok: t, num: f}, nil
+		}
+		if f, ok := textFields[name]; ok {
+			return operand{tok: t, text: f}, nil
+		}
+		if name == "tag" {
+			return p.tag(t)
+		}
+		if _, ok := flagBits[name]; ok || name == "spliced" {
+			return operand{}, p.errorf(t, "%s is a boolean, it cannot be compared", t.text)
+		}
+		return operand{}, p.errorf(t, "unknown field %s", describe(t))
+	}
+	return operand{}, p.errorf(t, "expected a field, a number or a string, got %s", describe(t))
+}
+
+//tag: tag ( XX ), a text that is also a number when it parses as one
+func (p *parser) tag(t token) (operand, error) {
+	if l := p.next(); l.kind != tokLParen {
+		return operand{}, p.errorf(l, "expected ( after tag, got %s", describe(l))
+	}
+	n := p.next()
+	if (n.kind != tokIdent && n.kind != tokString) || len(n.text) != 2 {
+		return operand{}, p.errorf(n, "expected a two character tag name, got %s", describe(n))
+	}
+	if r := p.next(); r.kind != tokRParen {
+		return operand{}, p.errorf(r, "expected ) after the tag name, got %s", describe(r))
+	}
+	name := n.text
+	text := func(s *genodatastruct.SamRec) (string, bool) { return s.Tag(name) }
+	num := func(s *genodatastruct.SamRec) (float64, bool) {
+		v, ok := s.Tag(name)
+		if !ok {
+			return 0, false
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return operand{tok: t, num: num, text: text}, nil
+}
+
+//compare the operands as numbers if both can be numbers, as texts
+//otherwise. Texts are only equal or not
+func (p *parser) compare(left operand, op token, right operand) (condition, error) {
+	if left.num != nil && right.num != nil {
+		test := numberTest(op.text)
+		return func(s *genodatastruct.SamRec) bool {
+			a, ok := left.num(s)
+			if !ok {
+				return false
+			}
+			b, ok := right.num(s)
+			return ok && test(a, b)
+		}, nil
+	}
+	if left.text == nil {
+		return nil, p.errorf(right.tok, "%s is a number, %s is a text", describe(left.tok), describe(right.tok))
+	}
+	if right.text == nil {
+		return nil, p.errorf(right.tok, "%s is a text, %s is a number", describe(left.tok), describe(right.tok))
+	}
+	if op.text != "==" && op.text != "!=" {
+		return nil, p.errorf(op, "texts compare by == or != only, not %s", op.text)
+	}
+	equal := op.text == "=="
+	return func(s *genodatastruct.SamRec) bool {
+		a, ok := left.text(s)
+		if !ok {
+			return false
+		}
+		b, ok := right.text(s)
+		return ok && (a == b) == equal
+	}, nil
+}
+
+func numberTest(op string) func(a, b float64) bool {
+	switch op {
+	case "==":
+		return func(a, b float64) bool { return a == b }
+	case "!=":
+		return func(a, b float64) bool { return a != b }
+	case "<":
+		return func(a, b float64) bool { return a < b }
+	case "<=":
+		return func(a, b float64) bool { return a <= b }
+	case ">":
+		return func(a, b float64) bool { return a > b }
+	}
+	return func(a, b float64) bool { return a >= b }
+}
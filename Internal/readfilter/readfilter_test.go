@@ -0,0 +1,68 @@
+package readfilter
+
+import (
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestCompile(t *testing.T) {
+	primary := genodatastruct.SamRec{QName: "r1", Flag: 0x40 | 0x1, CIGAR: "50M100N50M", Chromosome: "chr1", MAPQ: 60, Tags: []string{"NH:i:1", "NM:i:2", "RG:Z:A"}}
+	secondary := genodatastruct.SamRec{QName: "r2", Flag: 0x100 | 0x10, CIGAR: "100M", Chromosome: "chr2", MAPQ: 3, Tags: []string{"NH:i:3"}}
+	tests := []struct {
+		expr               string
+		primary, secondary bool
+	}{
+		{"", true, true},
+		{Default, true, false},
+		{"mapq>=20 && !secondary && nm<=4 && tag(NH)==1", true, false},
+		{"nm<=4", true, false}, //missing tag
+		{"tag(NM)", true, false},
+		{"!tag(NM)", false, true},
+		{"secondary || spliced", true, true},
+		{"reverse && (nh>2 || mapq>30)", false, true},
+		{"chr == 'chr2' || tag(RG) == \"A\"", true, true},
+		{"tag(RG) != 'B'", true, false},
+		{"nh == 1 && read1 && paired", true, false},
+		{"flag < 0x100", true, false},
+	}
+	for _, test := range tests {
+		filter, err := Compile(test.expr)
+		if err != nil {
+			t.Fatalf("%q: %v", test.expr, err)
+		}
+		if filter(primary) != test.primary || filter(secondary) != test.secondary {
+			t.Errorf("%q keeps %v and %v, want %v and %v", test.expr, filter(primary), filter(secondary), test.primary, test.secondary)
+		}
+	}
+
+	errors := []struct {
+		expr string
+		pos  int
+	}{
+		{"mapq>30 &&", 10},
+		{"mapq = 30", 5},
+		{"mapq>30 & !secondary", 8},
+		{"mapqq>30", 0},
+		{"mapq>30 secondary", 8},
+		{"(mapq>30 || nh==1", 17},
+		{"chr > 'chr1'", 4},
+		{"chr == 1", 7},
+		{"secondary == 1", 0},
+		{"tag(NHX)==1", 4},
+		{"name == 'r1", 8},
+		{"flag < 0x10g", 7},
+		{"mapq > 3.0.1", 7},
+	}
+	for _, test := range errors {
+		_, err := Compile(test.expr)
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%q: got %v, want an expression error", test.expr, err)
+			continue
+		}
+		if e.Pos != test.pos {
+			t.Errorf("%q: error at %d, want %d: %v", test.expr, e.Pos, test.pos, e)
+		}
+	}
+}
@@ -13,6 +13,13 @@ import (
 //ParseSam filter reads and parse them into SamRec struct
 //and generating a channel of iterator
 func ParseSam(sam string, filter func(genodatastruct.SamRec) bool) <-chan genodatastruct.SamRec {
+	return ParseSamAll(sam, filter, nil)
+}
+
+//ParseSamAll is ParseSam handing the unmapped and filtered out reads to
+//dropped, if not nil, so that every alignment goes either to the channel or
+//to dropped
+func ParseSamAll(sam string, filter func(genodatastruct.SamRec) bool, dropped func(genodatastruct.SamRec)) <-chan genodatastruct.SamRec {
 	out := make(chan genodatastruct.SamRec, 100)
 	go func() {
 		samF, err := os.Open(sam)
@@ -27,22 +34,26 @@ func ParseSam(sam string, filter func(genodatastruct.SamRec) bool) <-chan genoda
 			if strings.HasPrefix(line, "@") {
 				continue
 			}
-			fields := strings.SplitN(line, "\t", 7)
+			fields := strings.Split(line, "\t")
 			flag, _ := strconv.Atoi(fields[1])
-			if flag == 4 { //unmapped
-				continue
-			}
 			mapq, _ := strconv.Atoi(fields[4])
 			pos, _ := strconv.Atoi(fields[3])
 			temp := genodatastruct.SamRec{
+				QName:      fields[0],
 				Flag:       int64(flag),
 				MAPQ:       mapq,
 				Pos:        pos,
 				Chromosome: genodatastruct.ChroSym(fields[2]),
 				CIGAR:      fields[5],
+				Fields:     fields,
+			}
+			if len(fields) > 11 {
+				temp.Tags = fields[11:]
 			}
-			if filter(temp) {
+			if flag&0x4 == 0 && filter(temp) { //0x4: unmapped, CIGAR *
 				out <- temp
+			} else if dropped != nil {
+				dropped(temp)
 			}
 		}
 		close(out)
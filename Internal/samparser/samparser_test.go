@@ -2,7 +2,10 @@ package samparser
 
 import (
 	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -26,3 +29,34 @@ func TestParseSam(t *testing.T) {
 	}
 	println(total, "#####", cnt)
 }
+
+func TestParseSamAll(t *testing.T) {
+	sam := filepath.Join(t.TempDir(), "test.sam")
+	lines := []string{
+		"@HD\tVN:1.6",
+		"r1\t16\t1\t101\t60\t20M100N30M\t*\t0\t0\t*\t*\tNH:i:1\tCB:Z:ACGT-1",
+		"r2\t0\tchr2\t50\t60\t10M\t*\t0\t0\t*\t*",
+		"r3\t0\tchr2\t60\t5\t10M\t*\t0\t0\t*\t*",
+		"r4\t4\t*\t0\t0\t*\t*\t0\t0\tACGT\tFFFF",
+		"r5\t133\tchr2\t50\t60\t*\t=\t50\t0\tACGT\tFFFF", //unmapped mate placed by its pair
+	}
+	if err := ioutil.WriteFile(sam, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dropped := []string{}
+	kept := []genodatastruct.SamRec{}
+	for s := range ParseSamAll(sam, func(s genodatastruct.SamRec) bool { return s.MAPQ > 10 }, func(s genodatastruct.SamRec) { dropped = append(dropped, s.QName) }) {
+		kept = append(kept, s)
+	}
+	if len(kept) != 2 || strings.Join(dropped, ",") != "r3,r4,r5" {
+		t.Fatalf("kept %+v dropped %v, want r1, r2 and r3, r4, r5", kept, dropped)
+	}
+	r1 := kept[0]
+	if r1.QName != "r1" || r1.Flag != 16 || r1.Chromosome != "chr1" || r1.Pos != 101 || r1.MAPQ != 60 || r1.CIGAR != "20M100N30M" ||
+		strings.Join(r1.Tags, " ") != "NH:i:1 CB:Z:ACGT-1" || strings.Join(r1.Fields, "\t") != lines[1] {
+		t.Errorf("record %+v of %q", r1, lines[1])
+	}
+	if r2 := kept[1]; r2.QName != "r2" || len(r2.Tags) != 0 || len(r2.Fields) != 11 {
+		t.Errorf("record without optional fields %+v", r2)
+	}
+}
@@ -0,0 +1,376 @@
+package samparser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//ReadHeader reads the header lines (starting with @) of a SAM file
+func ReadHeader(sam string) ([]string, error) {
+	f, err := os.Open(sam)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	header := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "@") {
+			break
+		}
+		header = append(header, line)
+	}
+	return header, scanner.Err()
+}
+
+//AddProgram appends the @PG line of a program run to the header, chained
+//to the last program by PP. The sort order of @HD becomes unsorted as
+//written by concurrent workers
+func AddProgram(header []string, id, version, commandLine string) []string {
+	out := []string{}
+	ids := map[string]bool{}
+	last := ""
+	for _, line := range header {
+		fields := strings.Split(line, "\t")
+		switch fields[0] {
+		case "@HD":
+			for i, f := range fields {
+				if strings.HasPrefix(f, "SO:") {
+					fields[i] = "SO:unsorted"
+				}
+			}
+			line = strings.Join(fields, "\t")
+		case "@PG":
+			for _, f := range fields {
+				if strings.HasPrefix(f, "ID:") {
+					last = f[3:]
+					ids[last] = true
+				}
+			}
+		}
+		out = append(out, line)
+	}
+	pgID := id
+	for n := 1; ids[pgID]; n++ {
+		pgID = fmt.Sprintf("%s.%d", id, n)
+	}
+	pg := "@PG\tID:" + pgID + "\tPN:" + id
+	if last != "" {
+		pg += "\tPP:" + last
+	}
+	if version != "" {
+		pg += "\tVN:" + version
+	}
+	return append(out, pg+"\tCL:"+strings.Replace(commandLine, "\t", " ", -1))
+}
+
+//BamWriter writes SAM lines as the records of a BGZF compressed BAM file
+type BamWriter struct {
+	bgzf       *genodatastruct.BgzfWriter
+	references map[string]int32
+	record     bytes.Buffer
+}
+
+//NewBamWriter writes the header, whose @SQ lines name the references
+func NewBamWriter(w io.Writer, header []string) (*BamWriter, error) {
+	bw := &BamWriter{bgzf: genodatastruct.NewBgzfWriter(w), references: map[string]int32{}}
+	text := ""
+	if len(header) > 0 {
+		text = strings.Join(header, "\n") + "\n"
+	}
+	var b bytes.Buffer
+	b.WriteString("BAM\x01")
+	binary.Write(&b, binary.LittleEndian, int32(len(text)))
+	b.WriteString(text)
+	type reference struct {
+		name   string
+		length int32
+	}
+	refs := []reference{}
+	for _, line := range header {
+		if !strings.HasPrefix(line, "@SQ\t") {
+			continue
+		}
+		ref := reference{}
+		for _, f := range strings.Split(line, "\t")[1:] {
+			switch {
+			case strings.HasPrefix(f, "SN:"):
+				ref.name = f[3:]
+			case strings.HasPrefix(f, "LN:"):
+				n, err := strconv.Atoi(f[3:])
+				if err != nil {
+					return nil, fmt.Errorf("bad reference length in %q", line)
+				}
+				ref.length = int32(n)
+			}
+		}
+		bw.references[ref.name] = int32(len(refs))
+		refs = append(refs, ref)
+	}
+	binary.Write(&b, binary.LittleEndian, int32(len(refs)))
+	for _, ref := range refs {
+		binary.Write(&b, binary.LittleEndian, int32(len(ref.name)+1))
+		b.WriteString(ref.name)
+		b.WriteByte(0)
+		binary.Write(&b, binary.LittleEndian, ref.length)
+	}
+	_, err := bw.bgzf.Write(b.Bytes())
+	return bw, err
+}
+
+//reference index of a name, -1 for *
+func (bw *BamWriter) reference(name string) (int32, error) {
+	if name == "*" {
+		return -1, nil
+	}
+	id, ok := bw.references[name]
+	if !ok {
+		return 0, fmt.Errorf("reference %s is not in the @SQ lines of the header", name)
+	}
+	return id, nil
+}
+
+const cigarOps = "MIDNSHP=X"
+
+const seqCodes = "=ACMGRSVTWYHKDBN"
+
+//Write encodes the fields of a SAM line as a BAM record
+func (bw *BamWriter) Write(fields []string) error {
+	if len(fields) < 11 {
+		return fmt.Errorf("SAM line of %d fields", len(fields))
+	}
+	atoi := func(s string) int {
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	refID, err := bw.reference(fields[2])
+	if err != nil {
+		return err
+	}
+	nextRefID := refID
+	if fields[6] != "=" {
+		if nextRefID, err = bw.reference(fields[6]); err != nil {
+			return err
+		}
+	}
+	pos := int32(atoi(fields[3]) - 1)
+	//CIGAR operations and the reference span
+	cigar := []uint32{}
+	span, n := 0, 0
+	if fields[5] != "*" {
+		for _, c := range fields[5] {
+			if c >= '0' && c <= '9' {
+				n = n*10 + int(c-'0')
+				continue
+			}
+			op := strings.IndexRune(cigarOps, c)
+			if op < 0 {
+				return fmt.Errorf("bad CIGAR %s", fields[5])
+			}
+			cigar = append(cigar, uint32(n)<<4|uint32(op))
+			if c == 'M' || c == 'D' || c == 'N' || c == '=' || c == 'X' {
+				span += n
+			}
+			n = 0
+		}
+	}
+	if span == 0 {
+		span = 1
+	}
+	seq := fields[9]
+	if seq == "*" {
+		seq = ""
+	}
+
+	b := &bw.record
+	b.Reset()
+	le := binary.LittleEndian
+	binary.Write(b, le, int32(0)) //block size, set at the end
+	binary.Write(b, le, refID)
+	binary.Write(b, le, pos)
+	binary.Write(b, le, uint8(len(fields[0])+1))
+	binary.Write(b, le, uint8(atoi(fields[4])))
+	binary.Write(b, le, reg2bin(int(pos), int(pos)+span))
+	binary.Write(b, le, uint16(len(cigar)))
+	binary.Write(b, le, uint16(atoi(fields[1])))
+	binary.Write(b, le, int32(len(seq)))
+	binary.Write(b, le, nextRefID)
+	binary.Write(b, le, int32(atoi(fields[7])-1))
+	binary.Write(b, le, int32(atoi(fields[8])))
+	b.WriteString(fields[0])
+	b.WriteByte(0)
+	for _, op := range cigar {
+		binary.Write(b, le, op)
+	}
+	for i := 0; i < len(seq); i += 2 {
+		code := byte(strings.IndexByte(seqCodes, upper(seq[i]))&15) << 4
+		if i+1 < len(seq) {
+			code |= byte(strings.IndexByte(seqCodes, upper(seq[i+1])) & 15)
+		}
+		b.WriteByte(code)
+	}
+	for i := 0; i < len(seq); i++ {
+		if fields[10] == "*" || i >= len(fields[10]) {
+			b.WriteByte(0xff)
+		} else {
+			b.WriteByte(fields[10][i] - 33)
+		}
+	}
+	for _, tag := range fields[11:] {
+		if err := writeTag(b, tag); err != nil {
+			return err
+		}
+	}
+	record := b.Bytes()
+	le.PutUint32(record, uint32(len(record)-4))
+	_, err = bw.bgzf.Write(record)
+	return err
+}
+
+//Close ends the BAM file, the underlying writer stays open
+func (bw *BamWriter) Close() error {
+	return bw.bgzf.Close()
+}
+
+func upper(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+//reg2bin is the bin of the 0-based region [beg, end) in the binning index
+//of the SAM specification
+func reg2bin(beg, end int) uint16 {
+	end--
+	switch {
+	case beg>>14 == end>>14:
+		return uint16(((1<<15)-1)/7 + (beg >> 14))
+	case beg>>17 == end>>17:
+		return uint16(((1<<12)-1)/7 + (beg >> 17))
+	case beg>>20 == end>>20:
+		return uint16(((1<<9)-1)/7 + (beg >> 20))
+	case beg>>23 == end>>23:
+		return uint16(((1<<6)-1)/7 + (beg >> 23))
+	case beg>>26 == end>>26:
+		return uint16(((1<<3)-1)/7 + (beg >> 26))
+	}
+	return 0
+}
+
+//writeTag encodes an optional field TAG:TYPE:VALUE, integers in the
+//smallest type holding them
+func writeTag(b *bytes.Buffer, tag string) error {
+	if len(tag) < 5 || tag[2] != ':' || tag[4] != ':' {
+		return fmt.Errorf("bad optional field %q", tag)
+	}
+	le := binary.LittleEndian
+	b.WriteString(tag[:2])
+	value := tag[5:]
+	switch tag[3] {
+	case 'A':
+		if len(value) != 1 {
+			return fmt.Errorf("bad optional field %q", tag)
+		}
+		b.WriteByte('A')
+		b.WriteByte(value[0])
+	case 'i':
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad optional field %q", tag)
+		}
+		writeInt(b, n)
+	case 'f':
+		f, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return fmt.Errorf("bad optional field %q", tag)
+		}
+		b.WriteByte('f')
+		binary.Write(b, le, float32(f))
+	case 'Z', 'H':
+		if tag[3] == 'H' {
+			if _, err := hex.DecodeString(value); err != nil {
+				return fmt.Errorf("bad optional field %q", tag)
+			}
+		}
+		b.WriteByte(tag[3])
+		b.WriteString(value)
+		b.WriteByte(0)
+	case 'B':
+		values := strings.Split(value, ",")
+		sub := values[0]
+		if len(sub) != 1 || !strings.Contains("cCsSiIf", sub) {
+			return fmt.Errorf("bad optional field %q", tag)
+		}
+		b.WriteByte('B')
+		b.WriteByte(sub[0])
+		binary.Write(b, le, int32(len(values)-1))
+		for _, v := range values[1:] {
+			if sub == "f" {
+				f, err := strconv.ParseFloat(v, 32)
+				if err != nil {
+					return fmt.Errorf("bad optional field %q", tag)
+				}
+				binary.Write(b, le, float32(f))
+				continue
+			}
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("bad optional field %q", tag)
+			}
+			switch sub {
+			case "c":
+				binary.Write(b, le, int8(n))
+			case "C":
+				binary.Write(b, le, uint8(n))
+			case "s":
+				binary.Write(b, le, int16(n))
+			case "S":
+				binary.Write(b, le, uint16(n))
+			case "i":
+				binary.Write(b, le, int32(n))
+			case "I":
+				binary.Write(b, le, uint32(n))
+			}
+		}
+	default:
+		return fmt.Errorf("unknown type of optional field %q", tag)
+	}
+	return nil
+}
+
+//writeInt writes an integer value in the smallest BAM type holding it
+func writeInt(b *bytes.Buffer, n int64) {
+	le := binary.LittleEndian
+	switch {
+	case n >= 0 && n <= math.MaxUint8:
+		b.WriteByte('C')
+		b.WriteByte(uint8(n))
+	case n >= math.MinInt8 && n < 0:
+		b.WriteByte('c')
+		binary.Write(b, le, int8(n))
+	case n >= 0 && n <= math.MaxUint16:
+		b.WriteByte('S')
+		binary.Write(b, le, uint16(n))
+	case n >= math.MinInt16 && n < 0:
+		b.WriteByte('s')
+		binary.Write(b, le, int16(n))
+	case n >= 0 && n <= math.MaxUint32:
+		b.WriteByte('I')
+		binary.Write(b, le, uint32(n))
+	default:
+		b.WriteByte('i')
+		binary.Write(b, le, int32(n))
+	}
+}
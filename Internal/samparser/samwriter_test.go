@@ -0,0 +1,64 @@
+package samparser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestAddProgram(t *testing.T) {
+	header := []string{"@HD\tVN:1.6\tSO:coordinate", "@SQ\tSN:chr1\tLN:1000", "@PG\tID:STAR\tPN:STAR"}
+	got := AddProgram(header, "STAR", "", "STAR --again")
+	want := []string{"@HD\tVN:1.6\tSO:unsorted", "@SQ\tSN:chr1\tLN:1000", "@PG\tID:STAR\tPN:STAR", "@PG\tID:STAR.1\tPN:STAR\tPP:STAR\tCL:STAR --again"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("header %q, want %q", got, want)
+	}
+}
+
+func TestBamWriter(t *testing.T) {
+	var buf bytes.Buffer
+	bw, err := NewBamWriter(&buf, []string{"@SQ\tSN:chr1\tLN:1000", "@SQ\tSN:chr2\tLN:500"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := "r1\t16\tchr2\t101\t60\t3M100N2M\t=\t201\t0\tACGTN\tIIIII\tNH:i:1\tsc:Z:normal\tXN:i:-300"
+	if err := bw.Write(strings.Split(line, "\t")); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.Write(strings.Split("r2\t0\tchr3\t1\t60\t5M\t*\t0\t0\t*\t*", "\t")); err == nil {
+		t.Error("no error for a reference missing in the header")
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	le := binary.LittleEndian
+	text := int(le.Uint32(data[4:]))
+	p := 8 + text + 4 + (4 + 5 + 4) + (4 + 5 + 4)
+	record := data[p+4 : p+4+int(le.Uint32(data[p:]))]
+	if refID, pos := int32(le.Uint32(record)), int32(le.Uint32(record[4:])); refID != 1 || pos != 100 {
+		t.Errorf("record at %d:%d, want 1:100", refID, pos)
+	}
+	if bin := le.Uint16(record[10:]); bin != 4681 {
+		t.Errorf("bin %d, want 4681", bin)
+	}
+	want := []byte("r1\x00")
+	want = append(want, 3<<4, 0, 0, 0, 0x43, 0x06, 0, 0, 2<<4, 0, 0, 0) //3M100N2M
+	want = append(want, 0x12, 0x48, 0xf0)                               //ACGTN
+	want = append(want, 40, 40, 40, 40, 40)
+	want = append(want, []byte("NHC\x01scZnormal\x00XNs")...)
+	want = append(want, 0xd4, 0xfe)
+	if got := record[32:]; !bytes.Equal(got, want) {
+		t.Errorf("record data %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,210 @@
+package samparser
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//UMIDedup collapses the PCR duplicates of UMI libraries: the reads of the
+//same alignment (strand, aligned segments with their junctions, and mate)
+//and cell whose UMIs fall in the same directional network are counted once.
+//The alignments must be sorted by coordinate
+type UMIDedup struct {
+	Tag        string //optional field of the UMI, such as UB or RX
+	CellTag    string //optional field of the cell barcode, reads of different cells are never duplicates
+	Reads      int    //reads with a UMI
+	Duplicates int    //reads collapsed into another one
+	//Duplicate, if set, is given each collapsed read
+	Duplicate func(genodatastruct.SamRec)
+}
+
+//alignmentKey tells the reads that may be duplicates of each other
+type alignmentKey struct {
+	cell, strand string
+	mate         int64
+	region       string
+}
+
+//umiGroup is the reads of an alignment by UMI, in input order
+type umiGroup struct {
+	pos   int
+	order int //groups at the same position are collapsed in input order
+	reads map[string][]genodatastruct.SamRec
+	umis  []string
+}
+
+//Collapse passes on the reads of the input keeping one read of each UMI
+//group at each alignment. Reads without the UMI are passed on as is. The
+//counts are complete once the output is closed
+func (d *UMIDedup) Collapse(in <-chan genodatastruct.SamRec) <-chan genodatastruct.SamRec {
+	out := make(chan genodatastruct.SamRec, 100)
+	go func() {
+		groups := map[alignmentKey]*umiGroup{}
+		order := 0
+		//flush the groups starting before pos, all of them if pos is negative
+		flush := func(pos int) {
+			done := []*umiGroup{}
+			for key, g := range groups {
+				if pos < 0 || g.pos < pos {
+					done = append(done, g)
+					delete(groups, key)
+				}
+			}
+			sort.Slice(done, func(a, b int) bool {
+				if done[a].pos != done[b].pos {
+					return done[a].pos < done[b].pos
+				}
+				return done[a].order < done[b].order
+			})
+			for _, g := range done {
+				d.collapse(g, out)
+			}
+		}
+		chromosome, pos := "", 0
+		seen := map[string]bool{}
+		for s := range in {
+			umi, ok := s.Tag(d.Tag)
+			if !ok {
+				out <- s
+				continue
+			}
+			d.Reads++
+			switch {
+			case s.Chromosome != chromosome:
+				if seen[s.Chromosome] {
+					log.Fatalln("UMI deduplication needs alignments sorted by coordinate, ", s.QName, " is back on ", s.Chromosome)
+				}
+				flush(-1)
+				chromosome = s.Chromosome
+				seen[chromosome] = true
+			case s.Pos < pos:
+				log.Fatalln("UMI deduplication needs alignments sorted by coordinate, ", s.QName, " at ", s.Chromosome, ":", s.Pos, " follows ", pos)
+			case s.Pos > pos:
+				flush(s.Pos)
+			}
+			pos = s.Pos
+			cell := ""
+			if d.CellTag != "" {
+				cell, _ = s.Tag(d.CellTag)
+			}
+			key := alignmentKey{cell: cell, strand: s.Strand(), mate: s.Flag & 0xC0, region: fmt.Sprint(s.RegionAligned())}
+			g, ok := groups[key]
+			if !ok {
+				g = &umiGroup{pos: s.Pos, order: order, reads: map[string][]genodatastruct.SamRec{}}
+				groups[key] = g
+				order++
+			}
+			if _, ok := g.reads[umi]; !ok {
+				g.umis = append(g.umis, umi)
+			}
+			g.reads[umi] = append(g.reads[umi], s)
+		}
+		flush(-1)
+		close(out)
+	}()
+	return out
+}
+
+//collapse sends the first read of the leading UMI of each network, the
+//other reads of the group are duplicates
+func (d *UMIDedup) collapse(g *umiGroup, out chan<- genodatastruct.SamRec) {
+	counts := map[string]int{}
+	total := 0
+	for umi, reads := range g.reads {
+		counts[umi] = len(reads)
+		total += len(reads)
+	}
+	leaders := DirectionalNetworks(g.umis, counts)
+	for _, umi := range leaders {
+		out <- g.reads[umi][0]
+	}
+	d.Duplicates += total - len(leaders)
+	if d.Duplicate == nil {
+		return
+	}
+	kept := map[string]bool{}
+	for _, umi := range leaders {
+		kept[umi] = true
+	}
+	for _, umi := range g.umis {
+		for i, s := range g.reads[umi] {
+			if i > 0 || !kept[umi] {
+				d.Duplicate(s)
+			}
+		}
+	}
+}
+
+//DirectionalNetworks returns the leading UMI of each network in order of
+//their counts, as the directional method of UMI-tools: a UMI absorbs the
+//UMIs one substitution away with a count up to half its own (n <= (m+1)/2),
+//and these absorb their neighbours in turn
+func DirectionalNetworks(umis []string, counts map[string]int) []string {
+	leaders := []string{}
+	for umi, leader := range directionalLeaders(umis, counts) {
+		if umi == leader {
+			leaders = append(leaders, umi)
+		}
+	}
+	sortByCount(leaders, counts)
+	return leaders
+}
+
+//directionalLeaders maps every UMI to the leading UMI of its network
+func directionalLeaders(umis []string, counts map[string]int) map[string]string {
+	order := make([]string, len(umis))
+	copy(order, umis)
+	sortByCount(order, counts)
+	leader := map[string]string{}
+	for _, top := range order {
+		if _, ok := leader[top]; ok {
+			continue
+		}
+		leader[top] = top
+		queue := []string{top}
+		for len(queue) > 0 {
+			a := queue[0]
+			queue = queue[1:]
+			for _, b := range order {
+				if _, ok := leader[b]; ok {
+					continue
+				}
+				if counts[a] >= 2*counts[b]-1 && oneSubstitution(a, b) {
+					leader[b] = top
+					queue = append(queue, b)
+				}
+			}
+		}
+	}
+	return leader
+}
+
+//sortByCount sorts the UMIs by decreasing count, then by sequence
+func sortByCount(umis []string, counts map[string]int) {
+	sort.Slice(umis, func(a, b int) bool {
+		if counts[umis[a]] != counts[umis[b]] {
+			return counts[umis[a]] > counts[umis[b]]
+		}
+		return umis[a] < umis[b]
+	})
+}
+
+//oneSubstitution tells if the sequences differ by exactly one base
+func oneSubstitution(a, b string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	diff := 0
+	for i := 0; i < len(a); i++ {
+		if a[i] != b[i] {
+			diff++
+			if diff > 1 {
+				return false
+			}
+		}
+	}
+	return diff == 1
+}
@@ -0,0 +1,57 @@
+package samparser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestDirectionalNetworks(t *testing.T) {
+	//ACGT absorbs ACGA (1 <= 5) which absorbs ACCA, while ACGG of 6 is more
+	//than half of ACGT and TTTT is too far
+	counts := map[string]int{"ACGT": 10, "ACGA": 3, "ACCA": 1, "ACGG": 6, "TTTT": 2}
+	got := DirectionalNetworks([]string{"ACGT", "ACGA", "ACCA", "ACGG", "TTTT"}, counts)
+	if want := []string{"ACGT", "ACGG", "TTTT"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("networks led by %v, want %v", got, want)
+	}
+}
+
+func TestUMIDedup(t *testing.T) {
+	read := func(name string, pos int, cigar, umi string) genodatastruct.SamRec {
+		s := genodatastruct.SamRec{QName: name, Chromosome: "chr1", Pos: pos, CIGAR: cigar, MAPQ: 60, Tags: []string{"CB:Z:C1"}}
+		if umi != "" {
+			s.Tags = append(s.Tags, "UB:Z:"+umi)
+		}
+		return s
+	}
+	in := make(chan genodatastruct.SamRec)
+	go func() {
+		in <- read("a", 100, "50M100N50M", "AAAA")
+		in <- read("b", 100, "50M100N50M", "AAAT") //error of AAAA
+		in <- read("c", 100, "50M100N50M", "AAAA")
+		in <- read("d", 100, "50M200N50M", "AAAA") //other junction
+		in <- read("e", 100, "50M", "")            //no UMI
+		in <- read("f", 120, "50M100N50M", "AAAA") //other position
+		in <- read("g", 120, "50M100N50M", "AAAA")
+		other := read("h", 120, "50M100N50M", "AAAA") //other cell
+		other.Tags[0] = "CB:Z:C2"
+		in <- other
+		close(in)
+	}()
+	duplicates := []string{}
+	d := &UMIDedup{Tag: "UB", CellTag: "CB", Duplicate: func(s genodatastruct.SamRec) { duplicates = append(duplicates, s.QName) }}
+	names := []string{}
+	for s := range d.Collapse(in) {
+		names = append(names, s.QName)
+	}
+	if want := []string{"e", "a", "d", "f", "h"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("kept %v, want %v", names, want)
+	}
+	if d.Reads != 7 || d.Duplicates != 3 {
+		t.Errorf("%d reads with %d duplicates, want 7 and 3", d.Reads, d.Duplicates)
+	}
+	if want := []string{"c", "b", "g"}; !reflect.DeepEqual(duplicates, want) {
+		t.Errorf("duplicates %v, want %v", duplicates, want)
+	}
+}
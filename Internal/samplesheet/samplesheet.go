@@ -0,0 +1,140 @@
+package samplesheet
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//Sample is a line of a sample sheet
+type Sample struct {
+	ID    string
+	Path  string //alignments or junctions of the sample
+	Group string
+	//optional columns
+	Library   string            //library type, library or library_type column
+	ReadGroup string            //reads of the sample by their RG tag, read_group or rg column
+	Fields    map[string]string //all the columns by their header name
+}
+
+//ParseSampleSheet parses a tab separated sample sheet, comma separated if
+//the file name ends with .csv, with the quoting of CSV. The header names the
+//columns, sample, path and group are required (case insensitive). Lines
+//starting with # are comments. Relative paths are taken from the directory
+//of the sheet
+func ParseSampleSheet(sheet string) []Sample {
+	f, err := os.Open(sheet)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	sep := "\t"
+	if strings.HasSuffix(strings.ToLower(sheet), ".csv") {
+		sep = ","
+	}
+	rows, err := readRows(f, sep == ",")
+	if err != nil {
+		log.Fatalln("Sample sheet ", sheet, ": ", err)
+	}
+	samples := []Sample{}
+	var header []string
+	seen := map[string]bool{}
+	for _, fields := range rows {
+		line := strings.Join(fields, sep)
+		if header == nil {
+			for _, name := range fields {
+				header = append(header, strings.ToLower(strings.TrimSpace(name)))
+			}
+			for _, required := range []string{"sample", "path", "group"} {
+				if !has(header, required) {
+					log.Fatalln("Sample sheet ", sheet, " has no ", required, " column")
+				}
+			}
+			continue
+		}
+		if len(fields) != len(header) {
+			log.Fatalln("Sample sheet ", sheet, " line has ", len(fields), " columns instead of ", len(header), ": ", line)
+		}
+		s := Sample{Fields: map[string]string{}}
+		for i, name := range header {
+			s.Fields[name] = strings.TrimSpace(fields[i])
+		}
+		s.ID, s.Path, s.Group = s.Fields["sample"], s.Fields["path"], s.Fields["group"]
+		s.Library = firstField(s.Fields, "library_type", "library")
+		s.ReadGroup = firstField(s.Fields, "read_group", "rg")
+		if s.ID == "" || s.Path == "" {
+			log.Fatalln("Sample sheet ", sheet, " line without sample or path: ", line)
+		}
+		if seen[s.ID] {
+			log.Fatalln("Sample ", s.ID, " is twice in ", sheet)
+		}
+		seen[s.ID] = true
+		if !filepath.IsAbs(s.Path) {
+			s.Path = filepath.Join(filepath.Dir(sheet), s.Path)
+		}
+		samples = append(samples, s)
+	}
+	return samples
+}
+
+//readRows reads the fields of the lines of a sheet, leaving out blank and
+//comment lines. Comma separated sheets are read by encoding/csv so that
+//quoted fields may hold commas
+func readRows(r io.Reader, comma bool) ([][]string, error) {
+	rows := [][]string{}
+	if comma {
+		cr := csv.NewReader(r)
+		cr.Comment = '#'
+		cr.FieldsPerRecord = -1 //checked against the header
+		records, err := cr.ReadAll()
+		for _, fields := range records {
+			if strings.TrimSpace(strings.Join(fields, "")) != "" {
+				rows = append(rows, fields)
+			}
+		}
+		return rows, err
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rows = append(rows, strings.Split(line, "\t"))
+	}
+	return rows, scanner.Err()
+}
+
+//Groups in the order of their first sample
+func Groups(samples []Sample) []string {
+	groups := []string{}
+	for _, s := range samples {
+		if !has(groups, s.Group) {
+			groups = append(groups, s.Group)
+		}
+	}
+	return groups
+}
+
+//firstField is the value of the first present column of the names
+func firstField(fields map[string]string, names ...string) string {
+	for _, name := range names {
+		if v, ok := fields[name]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+func has(vs []string, v string) bool {
+	for _, x := range vs {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package samplesheet
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSampleSheet(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name, content string
+	}{
+		{"sheet.tsv", "# samples\nSample\tPath\tGroup\tlibrary_type\tRG\n" +
+			"s1\ts1.bam\tcase, treated\tfr-firststrand\trg1\n\n" +
+			"s2\t/data/s2.SJ.out.tab\tcontrol\t\t\n"},
+		//quoted fields hold the separator, Windows line ends
+		{"sheet.csv", "# samples\r\nSample,Path,Group,library_type,RG\r\n" +
+			"s1,s1.bam,\"case, treated\",fr-firststrand,rg1\r\n\r\n" +
+			"s2,/data/s2.SJ.out.tab,control,,\r\n"},
+	}
+	want := []Sample{
+		{ID: "s1", Path: filepath.Join(dir, "s1.bam"), Group: "case, treated", Library: "fr-firststrand", ReadGroup: "rg1"},
+		{ID: "s2", Path: "/data/s2.SJ.out.tab", Group: "control"},
+	}
+	for _, test := range tests {
+		sheet := filepath.Join(dir, test.name)
+		if err := ioutil.WriteFile(sheet, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		samples := ParseSampleSheet(sheet)
+		if len(samples) != len(want) {
+			t.Fatalf("%s: samples %+v, want %+v", test.name, samples, want)
+		}
+		for i, s := range samples {
+			w := want[i]
+			if s.ID != w.ID || s.Path != w.Path || s.Group != w.Group || s.Library != w.Library || s.ReadGroup != w.ReadGroup || len(s.Fields) != 5 {
+				t.Errorf("%s: sample %+v, want %+v", test.name, s, w)
+			}
+		}
+		if groups := Groups(samples); len(groups) != 2 || groups[0] != "case, treated" {
+			t.Errorf("%s: groups %q", test.name, groups)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package sjparser
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//ParseSJTab parses a STAR SJ.out.tab file: chromosome, first and last intron
+//base, strand (0 undefined, 1 +, 2 -), motif, annotated, unique reads,
+//multi-mapping reads and maximum overhang
+func ParseSJTab(sjtab string) []genodatastruct.JunctionRec {
+	junctions := []genodatastruct.JunctionRec{}
+	scanLines(sjtab, func(fields []string) {
+		if len(fields) < 9 {
+			log.Fatalln("Ill-formated SJ.out.tab line in ", sjtab, ": ", strings.Join(fields, "\t"))
+		}
+		strand := "."
+		if fields[3] == "1" {
+			strand = "+"
+		} else if fields[3] == "2" {
+			strand = "-"
+		}
+		junctions = append(junctions, genodatastruct.JunctionRec{
+			Chromosome:  genodatastruct.ChroSym(fields[0]),
+			Strand:      strand,
+			Intron:      genodatastruct.Coor{Start: atoi(fields[1]), End: atoi(fields[2])},
+			Unique:      atoi(fields[6]),
+			Multi:       atoi(fields[7]),
+			MaxOverhang: atoi(fields[8]),
+			Motif:       atoi(fields[4]),
+		})
+	})
+	return junctions
+}
+
+//ParseJunc parses a junction file of regtools (BED12, the two blocks are the
+//anchors around the intron) or leafcutter (BED6: chromosome, intron start
+//0-based, intron end, name, reads, strand)
+func ParseJunc(junc string) []genodatastruct.JunctionRec {
+	junctions := []genodatastruct.JunctionRec{}
+	scanLines(junc, func(fields []string) {
+		if len(fields) < 6 {
+			log.Fatalln("Ill-formated junction line in ", junc, ": ", strings.Join(fields, "\t"))
+		}
+		start, end := atoi(fields[1]), atoi(fields[2])
+		overhang := 0
+		if len(fields) >= 12 {
+			blocks := strings.Split(strings.TrimSuffix(fields[10], ","), ",")
+			if len(blocks) != 2 {
+				log.Fatalln("Junction with ", len(blocks), " blocks in ", junc)
+			}
+			left, right := atoi(blocks[0]), atoi(blocks[1])
+			start, end = start+left, end-right
+			overhang = left
+			if right < overhang {
+				overhang = right
+			}
+		}
+		strand := fields[5]
+		if strand != "+" && strand != "-" {
+			strand = "."
+		}
+		junctions = append(junctions, genodatastruct.JunctionRec{
+			Chromosome:  genodatastruct.ChroSym(fields[0]),
+			Strand:      strand,
+			Intron:      genodatastruct.Coor{Start: start + 1, End: end},
+			Unique:      atoi(fields[4]),
+			MaxOverhang: overhang,
+			Motif:       -1,
+		})
+	})
+	return junctions
+}
+
+//ParseJunctions parses a junction file of the format sj (STAR SJ.out.tab)
+//or junc (regtools/leafcutter)
+func ParseJunctions(path, format string) []genodatastruct.JunctionRec {
+	switch format {
+	case "sj":
+		return ParseSJTab(path)
+	case "junc":
+		return ParseJunc(path)
+	}
+	log.Fatalln("Unknown junction format ", format)
+	return nil
+}
+
+//DetectFormat tells the format of an input by the file name: sj for a name
+//ending in SJ.out.tab, junc for .junc and sam otherwise. Junction files of
+//other names need their format given
+func DetectFormat(input string) string {
+	switch {
+	case strings.HasSuffix(input, "SJ.out.tab"):
+		return "sj"
+	case strings.HasSuffix(input, ".junc"):
+		return "junc"
+	}
+	return "sam"
+}
+
+//scanLines splits every non comment line of the file by tab
+func scanLines(path string, parse func([]string)) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "track") {
+			continue
+		}
+		parse(strings.Split(line, "\t"))
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func atoi(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		log.Fatalln("Not an integer: ", s)
+	}
+	return n
+}
@@ -0,0 +1,80 @@
+package sjparser
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//testFile writes the lines, tab separated by |, into a file of the name
+func testFile(t *testing.T, name string, lines ...string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(strings.ReplaceAll(strings.Join(lines, "\n"), "|", "\t")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func compareJunctions(t *testing.T, got, want []genodatastruct.JunctionRec) {
+	if len(got) != len(want) {
+		t.Fatalf("junctions %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("junction %d %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseSJTab(t *testing.T) {
+	//STAR gives the first and last intron bases, 1-based
+	sj := testFile(t, "test.SJ.out.tab",
+		"1|201|299|1|1|1|10|2|30",
+		"chr1|451|549|2|2|0|3|0|12",
+		"chr2|101|199|0|0|0|1|1|8",
+	)
+	compareJunctions(t, ParseSJTab(sj), []genodatastruct.JunctionRec{
+		{Chromosome: "chr1", Strand: "+", Intron: genodatastruct.Coor{Start: 201, End: 299}, Unique: 10, Multi: 2, MaxOverhang: 30, Motif: 1},
+		{Chromosome: "chr1", Strand: "-", Intron: genodatastruct.Coor{Start: 451, End: 549}, Unique: 3, MaxOverhang: 12, Motif: 2},
+		{Chromosome: "chr2", Strand: ".", Intron: genodatastruct.Coor{Start: 101, End: 199}, Unique: 1, Multi: 1, MaxOverhang: 8, Motif: 0},
+	})
+}
+
+func TestParseJunc(t *testing.T) {
+	junc := testFile(t, "test.junc",
+		"track name=junctions",
+		"#comment",
+		//regtools BED12, 0-based, the blocks are the anchors around the intron
+		"chr1|150|339|J1|12|+|150|339|255,0,0|2|50,40|0,149",
+		//leafcutter BED6, the 0-based intron start and the intron end
+		"chr1|200|299|.|7|-",
+		"2|450|549|.|4|?",
+	)
+	compareJunctions(t, ParseJunc(junc), []genodatastruct.JunctionRec{
+		{Chromosome: "chr1", Strand: "+", Intron: genodatastruct.Coor{Start: 201, End: 299}, Unique: 12, MaxOverhang: 40, Motif: -1},
+		{Chromosome: "chr1", Strand: "-", Intron: genodatastruct.Coor{Start: 201, End: 299}, Unique: 7, Motif: -1},
+		{Chromosome: "chr2", Strand: ".", Intron: genodatastruct.Coor{Start: 451, End: 549}, Unique: 4, Motif: -1},
+	})
+}
+
+func TestDetectFormat(t *testing.T) {
+	for _, test := range []struct {
+		input, want string
+	}{
+		{"sample/SJ.out.tab", "sj"},
+		{"sample.SJ.out.tab", "sj"},
+		{"sample.junc", "junc"},
+		{"sample.bam", "sam"},
+		{"sample.sam", "sam"},
+		//junction files of other names need -format
+		{"sample.tab", "sam"},
+		{"sample.bed", "sam"},
+	} {
+		if got := DetectFormat(test.input); got != test.want {
+			t.Errorf("format of %s %s, want %s", test.input, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package splicestats
+
+import (
+	"math"
+	"sort"
+)
+
+//Counts of a sample: K inclusion out of N informative reads. Counts may be
+//fractional after normalization by the isoform lengths
+type Counts struct {
+	K, N float64
+}
+
+//Bounds of the fitted parameters
+const (
+	minPhi   = 1e-6 //nearly binomial
+	maxPhi   = 0.99
+	maxLogit = 15
+	tol      = 1e-5
+)
+
+func lbeta(a, b float64) float64 {
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	return la + lb - lab
+}
+
+//BetaBinomialLogLik is the log likelihood of the counts under a beta-binomial
+//of mean mu and overdispersion phi (the intra-class correlation). The binomial
+//coefficients are left out as they do not depend on the parameters
+func BetaBinomialLogLik(counts []Counts, mu, phi float64) float64 {
+	s := 1/phi - 1
+	alpha, beta := mu*s, (1-mu)*s
+	ll := 0.0
+	for _, c := range counts {
+		if c.N <= 0 {
+			continue
+		}
+		ll += lbeta(c.K+alpha, c.N-c.K+beta) - lbeta(alpha, beta)
+	}
+	return ll
+}
+
+//goldenMax maximizes f on [lo, hi] by golden section search
+func goldenMax(f func(float64) float64, lo, hi float64) (float64, float64) {
+	r := (math.Sqrt(5) - 1) / 2
+	a, b := lo, hi
+	c, d := b-r*(b-a), a+r*(b-a)
+	fc, fd := f(c), f(d)
+	for b-a > tol {
+		if fc > fd {
+			b, d, fd = d, c, fc
+			c = b - r*(b-a)
+			fc = f(c)
+		} else {
+			a, c, fc = c, d, fd
+			d = a + r*(b-a)
+			fd = f(d)
+		}
+	}
+	if fc > fd {
+		return c, fc
+	}
+	return d, fd
+}
+
+func logistic(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+//fitMean is the maximum likelihood mean of the counts at a given dispersion
+func fitMean(counts []Counts, phi float64) (float64, float64) {
+	x, ll := goldenMax(func(x float64) float64 { return BetaBinomialLogLik(counts, logistic(x), phi) }, -maxLogit, maxLogit)
+	return logistic(x), ll
+}
+
+//Fit is a beta-binomial fit of groups of samples with a mean per group and a
+//dispersion shared by all the replicates
+type Fit struct {
+	Means  []float64
+	Phi    float64
+	LogLik float64
+}
+
+//FitBetaBinomial fits a mean per group and a common dispersion by maximum
+//likelihood. Samples without reads are ignored
+func FitBetaBinomial(groups ...[]Counts) Fit {
+	profile := func(logPhi float64) float64 {
+		ll := 0.0
+		for _, g := range groups {
+			_, l := fitMean(g, math.Exp(logPhi))
+			ll += l
+		}
+		return ll
+	}
+	logPhi, ll := goldenMax(profile, math.Log(minPhi), math.Log(maxPhi))
+	fit := Fit{Phi: math.Exp(logPhi), LogLik: ll}
+	for _, g := range groups {
+		mu, _ := fitMean(g, fit.Phi)
+		fit.Means = append(fit.Means, mu)
+	}
+	return fit
+}
+
+//informative counts the samples with reads
+func informative(counts []Counts) int {
+	n := 0
+	for _, c := range counts {
+		if c.N > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+//BetaBinomialTest is the likelihood ratio test of different means of the two
+//groups against a common mean, both with a shared dispersion. The p-value is
+//NaN if a group has no informative sample
+func BetaBinomialTest(a, b []Counts) (stat, p float64) {
+	if informative(a) == 0 || informative(b) == 0 {
+		return math.NaN(), math.NaN()
+	}
+	pooled := append(append([]Counts{}, a...), b...)
+	null := FitBetaBinomial(pooled)
+	alt := FitBetaBinomial(a, b)
+	stat = 2 * (alt.LogLik - null.LogLik)
+	if stat < 0 {
+		stat = 0
+	}
+	return stat, ChiSquare1PValue(stat)
+}
+
+//ChiSquare1PValue is the upper tail probability of a chi-square of one degree of freedom
+func ChiSquare1PValue(stat float64) float64 {
+	return math.Erfc(math.Sqrt(stat / 2))
+}
+
+//BenjaminiHochberg adjusts the p-values for the false discovery rate. NaN
+//p-values stay NaN and are not counted as tests
+func BenjaminiHochberg(p []float64) []float64 {
+	q := make([]float64, len(p))
+	order := []int{}
+	for i, v := range p {
+		q[i] = math.NaN()
+		if !math.IsNaN(v) {
+			order = append(order, i)
+		}
+	}
+	sort.Slice(order, func(i, j int) bool { return p[order[i]] < p[order[j]] })
+	m := float64(len(order))
+	min := 1.0
+	for k := len(order) - 1; k >= 0; k-- {
+		adjusted := p[order[k]] * m / float64(k+1)
+		if adjusted < min {
+			min = adjusted
+		}
+		q[order[k]] = min
+	}
+	return q
+}
+
+//BetaBinomialPMF is the probability of k successes in n trials of a
+//beta-binomial of mean mu and overdispersion phi
+func BetaBinomialPMF(k, n int, mu, phi float64) float64 {
+	s := 1/phi - 1
+	alpha, beta := mu*s, (1-mu)*s
+	ln1, _ := math.Lgamma(float64(n + 1))
+	lk1, _ := math.Lgamma(float64(k + 1))
+	lnk1, _ := math.Lgamma(float64(n - k + 1))
+	return math.Exp(ln1 - lk1 - lnk1 + lbeta(float64(k)+alpha, float64(n-k)+beta) - lbeta(alpha, beta))
+}
+
+//OutlierPValue is the two sided tail probability of k successes in n trials
+//under a beta-binomial of mean mu and overdispersion phi: twice the smaller
+//tail, at most 1
+func OutlierPValue(k, n int, mu, phi float64) float64 {
+	if n <= 0 {
+		return math.NaN()
+	}
+	lower, upper := 0.0, 0.0
+	for x := 0; x <= n; x++ {
+		p := BetaBinomialPMF(x, n, mu, phi)
+		if x <= k {
+			lower += p
+		}
+		if x >= k {
+			upper += p
+		}
+	}
+	return math.Min(1, 2*math.Min(lower, upper))
+}
@@ -0,0 +1,54 @@
+package splicestats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBenjaminiHochberg(t *testing.T) {
+	p := []float64{0.01, 0.04, math.NaN(), 0.03, 0.5}
+	want := []float64{0.04, 0.04 * 4 / 3, math.NaN(), 0.04 * 4 / 3, 0.5}
+	for i, q := range BenjaminiHochberg(p) {
+		if math.IsNaN(want[i]) != math.IsNaN(q) || (!math.IsNaN(q) && math.Abs(q-want[i]) > 1e-12) {
+			t.Errorf("q[%d] = %g, want %g", i, q, want[i])
+		}
+	}
+}
+
+func TestBetaBinomialTest(t *testing.T) {
+	same := []Counts{{K: 10, N: 20}, {K: 12, N: 20}, {K: 9, N: 20}}
+	alike := []Counts{{K: 11, N: 20}, {K: 10, N: 20}, {K: 10, N: 22}}
+	shifted := []Counts{{K: 19, N: 20}, {K: 18, N: 20}, {K: 20, N: 21}}
+	if _, p := BetaBinomialTest(same, alike); p < 0.5 {
+		t.Errorf("p = %g for groups of the same PSI", p)
+	}
+	if _, p := BetaBinomialTest(same, shifted); p > 1e-3 {
+		t.Errorf("p = %g for groups of PSI 0.5 and 0.95", p)
+	}
+	if _, p := BetaBinomialTest(same, []Counts{{K: 0, N: 0}}); !math.IsNaN(p) {
+		t.Errorf("p = %g for a group without reads", p)
+	}
+	fit := FitBetaBinomial(same, shifted)
+	if math.Abs(fit.Means[0]-31.0/60) > 0.02 || math.Abs(fit.Means[1]-57.0/61) > 0.02 {
+		t.Errorf("fitted means %v", fit.Means)
+	}
+	if ChiSquare1PValue(3.841459) < 0.0499 || ChiSquare1PValue(3.841459) > 0.0501 {
+		t.Errorf("chi-square p of 3.84 is %g", ChiSquare1PValue(3.841459))
+	}
+}
+
+func TestOutlierPValue(t *testing.T) {
+	sum := 0.0
+	for k := 0; k <= 30; k++ {
+		sum += BetaBinomialPMF(k, 30, 0.2, 0.05)
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("beta-binomial probabilities sum to %g", sum)
+	}
+	if p := OutlierPValue(6, 30, 0.2, 0.05); p < 0.9 {
+		t.Errorf("p = %g for the expected count", p)
+	}
+	if p := OutlierPValue(25, 30, 0.2, 0.05); p > 1e-4 {
+		t.Errorf("p = %g for an outlier", p)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+	"github.com/Hanbin/AberrantSplice/Internal/gtfparser"
+	"github.com/Hanbin/AberrantSplice/Internal/outfile"
+	"github.com/Hanbin/AberrantSplice/Internal/sjparser"
+	"github.com/Hanbin/AberrantSplice/scripts/splicetype"
+)
+
+//introncluster clusters the introns observed in the samples without the
+//annotation, as leafcutter does, and counts their usage per sample
+func main() {
+	prefix := flag.String("o", "leafcutter", "output prefix: <prefix>_perind.counts and <prefix>_clusters.tsv")
+	minClusterReads := flag.Int("min-cluster-reads", splicetype.DefaultClusterOptions.MinClusterReads, "minimum reads of a cluster over all samples")
+	minRatio := flag.Float64("min-intron-ratio", splicetype.DefaultClusterOptions.MinIntronRatio, "minimum fraction of the cluster reads for an intron")
+	maxIntron := flag.Int("max-intron", splicetype.DefaultClusterOptions.MaxIntronLength, "maximum intron length")
+	format := flag.String("format", "auto", "input format: sam, sj (STAR SJ.out.tab), junc (regtools/leafcutter) or auto by file name: sj for names ending in SJ.out.tab, junc for .junc and sam otherwise")
+	readFlags := splicetype.ReadFlags(flag.CommandLine)
+	libraryName := flag.String("library", "forward", "library type for the read strands: forward, reverse, unstranded, fr-firststrand or fr-secondstrand; "+
+		"the introns of unstranded reads take the strand of their gene, and are pooled as of undefined strand outside the genes")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <gtf> <sam|SJ.out.tab|junc>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	readOpt := *readFlags
+	library, err := splicetype.ParseLibraryType(*libraryName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	readOpt.Library = library
+	genes := gtfparser.ParsegtfConcurrent(flag.Arg(0))
+	index := splicetype.SortGeneMap(genes)
+
+	names, err := sampleNames(flag.Args()[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	samples := []*splicetype.JunctionCounter{}
+	for _, input := range flag.Args()[1:] {
+		f := *format
+		if f == "auto" {
+			f = sjparser.DetectFormat(input)
+		}
+		samples = append(samples, countJunctions(input, f, readOpt, genes, index))
+		log.Println("Counted ", len(samples[len(samples)-1].Counts), " introns of ", input)
+	}
+
+	opt := splicetype.ClusterOptions{MinClusterReads: *minClusterReads, MinIntronRatio: *minRatio, MaxIntronLength: *maxIntron}
+	clusters := splicetype.ClusterIntrons(samples, opt)
+	splicetype.AnnotateClusters(clusters, genes, index)
+	fmt.Printf("Clusters %d\n", len(clusters))
+	outfile.Write(*prefix+"_perind.counts", func(f *os.File) error { return splicetype.WriteClusterCounts(f, clusters, samples, names) })
+	outfile.Write(*prefix+"_clusters.tsv", func(f *os.File) error { return splicetype.WriteClusterGenes(f, clusters, genes) })
+}
+
+//countJunctions counts the introns of split reads or of junction records.
+//The genes only weigh the multimappers
+func countJunctions(input, format string, readOpt splicetype.ReadOptions, genes map[string]*genodatastruct.Gene, index map[string]*splicetype.GeneMapIndex) *splicetype.JunctionCounter {
+	junctions := splicetype.NewJunctionCounter()
+	if format == "sam" {
+		_, rejected := splicetype.ClassifyAlignments(input, readOpt, genes, index, 5, junctions.Add)
+		log.Println("Junctions filtered in ", input, " for short anchors ", rejected[splicetype.ShortAnchor], ", for anchor mismatches ", rejected[splicetype.AnchorMismatch])
+		if readOpt.UMITag != "" {
+			log.Println("UMI duplicates collapsed in ", input, ": ", rejected[splicetype.UMIDuplicate])
+		}
+		return junctions
+	}
+	records := sjparser.ParseJunctions(input, format)
+	for _, rec := range records {
+		if rec.Strand == "." {
+			rec.Strand = splicetype.MotifStrand(rec.Motif)
+		}
+		junctions.AddRecord(splicetype.Junction{Chromosome: rec.Chromosome, Strand: rec.Strand, Intron: rec.Intron}, rec)
+	}
+	return junctions
+}
+
+//sampleName is the file name without directory and known extensions
+func sampleName(input string) string {
+	name := filepath.Base(input)
+	for _, ext := range []string{".sam", "SJ.out.tab", ".tab", ".sj", ".junc", ".bed"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return strings.TrimRight(name, "._")
+}
+
+//sampleNames are the sample names of the inputs. Inputs of the same name in
+//different directories are told apart by their parent directories joined by
+//_, a/Aligned.out.sam and b/Aligned.out.sam are a_Aligned.out and b_Aligned.out
+func sampleNames(inputs []string) ([]string, error) {
+	names := make([]string, len(inputs))
+	dirs := make([][]string, len(inputs))
+	depth := make([]int, len(inputs))
+	for i, input := range inputs {
+		names[i] = sampleName(input)
+		if dir := filepath.Dir(filepath.Clean(input)); dir != "." && dir != string(filepath.Separator) {
+			dirs[i] = strings.Split(strings.Trim(filepath.ToSlash(dir), "/"), "/")
+		}
+	}
+	for {
+		seen := map[string][]int{}
+		for i, name := range names {
+			seen[name] = append(seen[name], i)
+		}
+		unique := true
+		for name, same := range seen {
+			if len(same) == 1 {
+				continue
+			}
+			unique = false
+			grown := false
+			for _, i := range same {
+				if depth[i] < len(dirs[i]) {
+					depth[i]++
+					names[i] = dirs[i][len(dirs[i])-depth[i]] + "_" + names[i]
+					grown = true
+				}
+			}
+			if !grown {
+				return nil, fmt.Errorf("inputs %s and %s have the same sample name %s", inputs[same[0]], inputs[same[1]], name)
+			}
+		}
+		if unique {
+			return names, nil
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSampleNames(t *testing.T) {
+	tests := []struct {
+		inputs []string
+		want   string //names joined by spaces, empty for an error
+	}{
+		{[]string{"s1.sam", "data/s2SJ.out.tab", "s3.junc"}, "s1 s2 s3"},
+		{[]string{"a/Aligned.out.sam", "b/Aligned.out.sam"}, "a_Aligned.out b_Aligned.out"},
+		{[]string{"run1/a/x.sam", "run2/a/x.sam", "y.sam"}, "run1_a_x run2_a_x y"},
+		{[]string{"x.sam", "a/x.sam"}, "x a_x"},
+		{[]string{"/data/a/x.sam", "/data/b/x.sam"}, "a_x b_x"},
+		{[]string{"a/x.sam", "./a/x.sam"}, ""},
+	}
+	for _, test := range tests {
+		names, err := sampleNames(test.inputs)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("inputs %v named %v, want an error", test.inputs, names)
+			}
+			continue
+		}
+		if err != nil || strings.Join(names, " ") != test.want {
+			t.Errorf("inputs %v named %v (%v), want %s", test.inputs, names, err, test.want)
+		}
+	}
+}
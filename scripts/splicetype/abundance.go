@@ -0,0 +1,150 @@
+package splicetype
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//DefaultFragmentLength is the mean fragment length of the effective
+//transcript lengths unless given
+const DefaultFragmentLength = 200
+
+const (
+	abundanceIterations = 10000
+	abundanceTolerance  = 1e-6 //reads
+)
+
+//shortTranscriptShare is the least effective length of a transcript as a
+//share of its length, about the mean of fragments truncated at the length of
+//a short transcript
+const shortTranscriptShare = 0.5
+
+//EffectiveLength of a transcript is the number of positions a fragment of
+//the mean length can start from, at least half the length of the transcript
+//so that it changes smoothly for transcripts around the fragment length
+func EffectiveLength(length int, fragmentLength float64) float64 {
+	return math.Max(float64(length)-fragmentLength+1, shortTranscriptShare*float64(length))
+}
+
+//TranscriptAbundance is the expression of a transcript estimated from the
+//equivalence classes of the reads
+type TranscriptAbundance struct {
+	TranscriptRef
+	GeneName        string
+	Length          int
+	EffectiveLength float64
+	Reads           float64 //reads assigned to the transcript
+	TPM             float64 //transcripts per million
+	IsoformFraction float64 //share of the TPM of the gene, NaN for a gene without reads
+}
+
+//EstimateAbundance shares the reads of each equivalence class among its
+//transcripts by expectation maximization, in proportion to the abundance of
+//the transcripts over their effective lengths, until the reads of the
+//transcripts settle. All the transcripts of the genes are given, sorted by
+//gene and transcript name
+func EstimateAbundance(classes []*EquivalenceClass, genes map[string]*genodatastruct.Gene, fragmentLength float64) []*TranscriptAbundance {
+	geneIDs := []string{}
+	for geneID := range genes {
+		geneIDs = append(geneIDs, geneID)
+	}
+	sort.Strings(geneIDs)
+	result := []*TranscriptAbundance{}
+	index := map[TranscriptRef]int{}
+	for _, geneID := range geneIDs {
+		gene := genes[geneID]
+		names := []string{}
+		for _, t := range gene.Transcripts {
+			names = append(names, t.TranscriptName)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			length := gene.Transcript(name).Length()
+			ta := &TranscriptAbundance{
+				TranscriptRef:   TranscriptRef{geneID, name},
+				GeneName:        gene.GeneName,
+				Length:          length,
+				EffectiveLength: EffectiveLength(length, fragmentLength),
+			}
+			index[ta.TranscriptRef] = len(result)
+			result = append(result, ta)
+		}
+	}
+
+	//transcripts of the classes, starting from an even share of their reads
+	members := make([][]int, len(classes))
+	reads := make([]float64, len(result))
+	for i, ec := range classes {
+		for _, tr := range ec.Transcripts {
+			if j, ok := index[tr]; ok && result[j].EffectiveLength > 0 {
+				members[i] = append(members[i], j)
+			}
+		}
+		for _, j := range members[i] {
+			reads[j] += ec.Reads / float64(len(members[i]))
+		}
+	}
+	for iter := 0; iter < abundanceIterations; iter++ {
+		next := make([]float64, len(result))
+		for i, ec := range classes {
+			total := 0.0
+			for _, j := range members[i] {
+				total += reads[j] / result[j].EffectiveLength
+			}
+			if total == 0 {
+				continue
+			}
+			for _, j := range members[i] {
+				next[j] += ec.Reads * reads[j] / result[j].EffectiveLength / total
+			}
+		}
+		change := 0.0
+		for j := range reads {
+			change = math.Max(change, math.Abs(next[j]-reads[j]))
+		}
+		reads = next
+		if change < abundanceTolerance {
+			break
+		}
+	}
+
+	rates, total := make([]float64, len(result)), 0.0
+	for j, ta := range result {
+		ta.Reads = reads[j]
+		if ta.EffectiveLength > 0 {
+			rates[j] = reads[j] / ta.EffectiveLength
+			total += rates[j]
+		}
+	}
+	geneTPM := map[string]float64{}
+	for j, ta := range result {
+		if total > 0 {
+			ta.TPM = rates[j] / total * 1e6
+		}
+		geneTPM[ta.GeneID] += ta.TPM
+	}
+	for _, ta := range result {
+		ta.IsoformFraction = math.NaN()
+		if geneTPM[ta.GeneID] > 0 {
+			ta.IsoformFraction = ta.TPM / geneTPM[ta.GeneID]
+		}
+	}
+	return result
+}
+
+//WriteAbundance writes the transcript abundances as a tab separated table
+func WriteAbundance(w io.Writer, abundances []*TranscriptAbundance) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "gene_id\tgene_name\ttranscript\tlength\teffective_length\treads\ttpm\tisoform_fraction")
+	for _, ta := range abundances {
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n", ta.GeneID, ta.GeneName, ta.TranscriptName, ta.Length,
+			strconv.FormatFloat(ta.EffectiveLength, 'f', -1, 64), FormatCount(ta.Reads), strconv.FormatFloat(ta.TPM, 'f', 4, 64), FormatRatio(ta.IsoformFraction))
+	}
+	return bw.Flush()
+}
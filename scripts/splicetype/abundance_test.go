@@ -0,0 +1,54 @@
+package splicetype
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestEstimateAbundance(t *testing.T) {
+	exons := []genodatastruct.Coor{{Start: 1, End: 500}, {Start: 1001, End: 1500}}
+	genes := map[string]*genodatastruct.Gene{
+		"G1": {GeneName: "ONE", Transcripts: []*genodatastruct.Transcript{{TranscriptName: "B", Exons: exons}, {TranscriptName: "A", Exons: exons}}},
+		"G2": {GeneName: "TWO", Transcripts: []*genodatastruct.Transcript{{TranscriptName: "C", Exons: exons[:1]}}},
+	}
+	a, b := TranscriptRef{"G1", "A"}, TranscriptRef{"G1", "B"}
+	classes := []*EquivalenceClass{
+		{Transcripts: []TranscriptRef{a}, Reads: 10},
+		{Transcripts: []TranscriptRef{b}, Reads: 30},
+		{Transcripts: []TranscriptRef{a, b}, Reads: 40},
+	}
+	//the shared reads go 1:3 as the unique ones, A = 10 + 40 A/(A+B)
+	result := EstimateAbundance(classes, genes, 200)
+	want := []struct {
+		name             string
+		effective, reads float64
+		tpm, fraction    float64
+	}{
+		{"A", 801, 20, 250000, 0.25},
+		{"B", 801, 60, 750000, 0.75},
+		{"C", 301, 0, 0, math.NaN()},
+	}
+	if len(result) != len(want) {
+		t.Fatalf("%d transcripts, want %d", len(result), len(want))
+	}
+	near := func(x, y float64) bool {
+		return (math.IsNaN(x) && math.IsNaN(y)) || math.Abs(x-y) < 0.01
+	}
+	for i, w := range want {
+		ta := result[i]
+		if ta.TranscriptName != w.name || ta.EffectiveLength != w.effective || !near(ta.Reads, w.reads) || !near(ta.TPM/1e6, w.tpm/1e6) || !near(ta.IsoformFraction, w.fraction) {
+			t.Errorf("%s: effective length %v reads %v TPM %v fraction %v, want %+v", ta.TranscriptName, ta.EffectiveLength, ta.Reads, ta.TPM, ta.IsoformFraction, w)
+		}
+	}
+	//no jump at the fragment length
+	for _, test := range []struct {
+		length int
+		want   float64
+	}{{150, 75}, {199, 99.5}, {200, 100}, {201, 100.5}, {398, 199}, {400, 201}, {1000, 801}} {
+		if got := EffectiveLength(test.length, 200); got != test.want {
+			t.Errorf("effective length of %d bases %v, want %v", test.length, got, test.want)
+		}
+	}
+}
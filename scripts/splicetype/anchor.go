@@ -0,0 +1,92 @@
+package splicetype
+
+import (
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//Reasons a junction of a split read is not trusted
+const (
+	ShortAnchor    = "shortAnchor"    //fewer aligned bases on a side of the junction than required
+	AnchorMismatch = "anchorMismatch" //too many mismatches next to the junction
+)
+
+//AnchorOptions are the requirements on the anchors of the junctions of split
+//reads, the aligned bases (M, = and X) on each side of an N operation. A
+//read with a junction failing them is not counted
+type AnchorOptions struct {
+	MinAnnotated   int //minimum anchor of the annotated junctions
+	MinNovel       int //minimum anchor of the novel junctions
+	MismatchWindow int //bases of each anchor next to the junction checked for mismatches by the MD tag, no check if 0
+	MaxMismatches  int //mismatches allowed in the window
+}
+
+var DefaultAnchorOptions = AnchorOptions{MinAnnotated: 3, MinNovel: 8, MismatchWindow: 10, MaxMismatches: 1}
+
+//AnchorChecker checks the junctions of the reads against the annotated ones
+type AnchorChecker struct {
+	AnchorOptions
+	annotated map[Junction]bool
+}
+
+func NewAnchorChecker(opt AnchorOptions, genes map[string]*genodatastruct.Gene) *AnchorChecker {
+	return &AnchorChecker{AnchorOptions: opt, annotated: AnnotatedJunctions(genes)}
+}
+
+//Check returns the reason of each junction of the read failing the anchor
+//requirements, none if the read is trusted
+func (ac *AnchorChecker) Check(samrec genodatastruct.SamRec, mr *ReadMapTranscriptome) []string {
+	if len(mr.Segment) < 2 {
+		return nil
+	}
+	var mismatches []int
+	hasMD := false
+	if ac.MismatchWindow > 0 {
+		mismatches, hasMD = samrec.Mismatches()
+	}
+	segs := mr.sortedSegments()
+	//anchors are the aligned bases of the segments, deletions left out
+	bases := samrec.AlignedBases()
+	if len(bases) != len(segs) {
+		bases = make([]int, len(segs))
+		for i, seg := range segs {
+			bases[i] = seg.End - seg.Start + 1
+		}
+	}
+	reasons := []string{}
+	for i, intron := range genodatastruct.IntervalRegions(segs) {
+		left, right := segs[i], segs[i+1]
+		min := ac.MinNovel
+		if ac.isAnnotated(mr.Chromosome, mr.Strand, intron) {
+			min = ac.MinAnnotated
+		}
+		if bases[i] < min || bases[i+1] < min {
+			reasons = append(reasons, ShortAnchor)
+			continue
+		}
+		if !hasMD {
+			continue
+		}
+		nleft, nright := 0, 0
+		for _, p := range mismatches {
+			if p >= left.Start && p <= left.End && p > left.End-ac.MismatchWindow {
+				nleft++
+			}
+			if p >= right.Start && p <= right.End && p < right.Start+ac.MismatchWindow {
+				nright++
+			}
+		}
+		if nleft > ac.MaxMismatches || nright > ac.MaxMismatches {
+			reasons = append(reasons, AnchorMismatch)
+		}
+	}
+	return reasons
+}
+
+//isAnnotated tells if a transcript has the intron, on either strand for an
+//undefined read strand
+func (ac *AnchorChecker) isAnnotated(chromosome, strand string, intron genodatastruct.Coor) bool {
+	if strand == "." {
+		return ac.annotated[Junction{chromosome, "+", intron}] || ac.annotated[Junction{chromosome, "-", intron}]
+	}
+	return ac.annotated[Junction{chromosome, strand, intron}]
+}
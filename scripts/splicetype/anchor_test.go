@@ -0,0 +1,50 @@
+package splicetype
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestAnchorChecker(t *testing.T) {
+	//an annotated intron 201-299 and a novel one 201-249
+	genes := map[string]*genodatastruct.Gene{"G1": {Transcripts: []*genodatastruct.Transcript{
+		{Chromosome: "chr1", Strand: "+", Introns: []genodatastruct.Coor{{Start: 201, End: 299}}},
+	}}}
+	ac := NewAnchorChecker(AnchorOptions{MinAnnotated: 3, MinNovel: 8, MismatchWindow: 10, MaxMismatches: 1}, genes)
+	check := func(pos int, cigar, md string) []string {
+		samrec := genodatastruct.SamRec{Chromosome: "chr1", Pos: pos, CIGAR: cigar}
+		if md != "" {
+			samrec.Tags = []string{"MD:Z:" + md}
+		}
+		mr := NewReadMapTranscriptome(samrec)
+		return ac.Check(samrec, mr)
+	}
+	tests := []struct {
+		pos       int
+		cigar, md string
+		want      []string
+	}{
+		{150, "51M99N51M", "", []string{}},
+		{196, "5M99N51M", "", []string{}},                      //annotated, 5 bases
+		{198, "3M49N51M", "", []string{ShortAnchor}},           //novel, 3 bases
+		{196, "5M49N51M", "", []string{ShortAnchor}},           //novel, 5 bases
+		{190, "3M5D3M49N51M", "", []string{ShortAnchor}},       //novel, 6 bases over 11
+		{190, "4M2I7M49N51M", "", []string{}},                  //novel, 11 bases
+		{190, "11M99N40M", "8A0A41", []string{AnchorMismatch}}, //198 and 199
+		{190, "11M99N40M", "9A1A39", []string{}},               //199 and 300, one by anchor
+		{190, "11M99N40M", "20A20T9", []string{}},              //309 and 330
+		{190, "11M99N40M", "11A0T38", []string{AnchorMismatch}},
+		{190, "11M99N2D40M", "11^AC0A0T38", []string{AnchorMismatch}},
+	}
+	for _, test := range tests {
+		if got := check(test.pos, test.cigar, test.md); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s at %d with MD %s: got %v, want %v", test.cigar, test.pos, test.md, got, test.want)
+		}
+	}
+	samrec := genodatastruct.SamRec{Pos: 100, CIGAR: "2S5M100N3M1I2M2D4M", Tags: []string{"MD:Z:0C4G4^TT1A2"}}
+	if got, _ := samrec.Mismatches(); !reflect.DeepEqual(got, []int{100, 205, 213}) {
+		t.Errorf("mismatches %v, want [100 205 213]", got)
+	}
+}
@@ -0,0 +1,200 @@
+package splicetype
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+	"github.com/Hanbin/AberrantSplice/Internal/samparser"
+)
+
+//Optional fields added to the annotated alignments
+const (
+	ClassTag      = "sc" //splice category of the read
+	GeneTag       = "gi" //genes of the transcripts the read maps to
+	TranscriptTag = "tn" //transcripts compatible with the read
+	JunctionTag   = "jn" //class of each junction of the read against the annotation
+	RejectTag     = "rj" //reason the read was left out of the counts
+)
+
+//CompatibleTranscripts are the transcripts the read may come from: its
+//junctions are introns of the transcript and its segments are within the
+//exons of the transcript
+func (mr *ReadMapTranscriptome) CompatibleTranscripts(genes map[string]*genodatastruct.Gene) []*genodatastruct.Transcript {
+	compatible := []*genodatastruct.Transcript{}
+	mr.eachCompatible(genes, func(geneID string, t *genodatastruct.Transcript) {
+		compatible = append(compatible, t)
+	})
+	return compatible
+}
+
+//eachCompatible calls f on the compatible transcripts with their gene, in
+//the order of the transcripts of the read
+func (mr *ReadMapTranscriptome) eachCompatible(genes map[string]*genodatastruct.Gene, f func(geneID string, t *genodatastruct.Transcript)) {
+	junctions := mr.Junctions()
+	for _, trancoors := range mr.MapTran {
+		if len(trancoors) == 0 {
+			continue
+		}
+		gene, ok := genes[trancoors[0].GeneID]
+		if !ok {
+			continue
+		}
+		t := gene.Transcript(trancoors[0].TranscriptName)
+		if t == nil || !mr.fitsTranscript(t, trancoors, junctions) {
+			continue
+		}
+		f(trancoors[0].GeneID, t)
+	}
+}
+
+//fitsTranscript tells if no segment is intronic or out of the transcript and
+//every junction is one of its introns
+func (mr *ReadMapTranscriptome) fitsTranscript(t *genodatastruct.Transcript, trancoors []TranCoor, junctions []genodatastruct.Coor) bool {
+	for i, tc := range trancoors {
+		if len(tc.IntronID) > 0 || !mr.Segment[i].Inside(t.Coordinate) {
+			return false
+		}
+	}
+	for _, j := range junctions {
+		if !hasIntron(t, j) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasIntron(t *genodatastruct.Transcript, intron genodatastruct.Coor) bool {
+	for _, known := range t.Introns {
+		if known == intron {
+			return true
+		}
+	}
+	return false
+}
+
+//AnnotatedWriter writes the classified alignments back as SAM or BAM with
+//their splice category, genes, compatible transcripts and junction classes
+//as optional fields, for genome browsers. The reads left out of the counts
+//are written too, with the reason in place of the classification. The
+//alignments come in the order of the classification workers
+type AnnotatedWriter struct {
+	genes     map[string]*genodatastruct.Gene
+	index     map[string]*GeneMapIndex
+	sam       *bufio.Writer
+	bam       *samparser.BamWriter
+	junctions map[Junction]string //class of the junctions seen
+	err       error
+	mu        sync.Mutex //Add and Reject run in different goroutines
+}
+
+//NewAnnotatedWriter writes the header to w, as BAM if bam is true and SAM
+//otherwise. The header of the input gets the @PG line of the run by
+//samparser.AddProgram
+func NewAnnotatedWriter(w io.Writer, header []string, bam bool, genes map[string]*genodatastruct.Gene, index map[string]*GeneMapIndex) (*AnnotatedWriter, error) {
+	aw := &AnnotatedWriter{genes: genes, index: index, junctions: map[Junction]string{}}
+	if bam {
+		var err error
+		aw.bam, err = samparser.NewBamWriter(w, header)
+		return aw, err
+	}
+	aw.sam = bufio.NewWriter(w)
+	for _, line := range header {
+		if _, err := aw.sam.WriteString(line + "\n"); err != nil {
+			return nil, err
+		}
+	}
+	return aw, nil
+}
+
+//Add writes the alignment of a classified read with its tags. The first
+//error is kept for Close
+func (aw *AnnotatedWriter) Add(mr *ReadMapTranscriptome) {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	if aw.err != nil || len(mr.Fields) < 11 {
+		return
+	}
+	aw.write(mr.Fields, aw.tags(mr))
+}
+
+//Reject writes the alignment of a read left out of the counts with the
+//reason, for the Rejected function of the read options
+func (aw *AnnotatedWriter) Reject(s genodatastruct.SamRec, reason string) {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	if aw.err != nil || len(s.Fields) < 11 {
+		return
+	}
+	aw.write(s.Fields, []string{RejectTag + ":Z:" + reason})
+}
+
+//write the alignment with the tags in place of those of a previous run
+func (aw *AnnotatedWriter) write(record []string, tags []string) {
+	fields := []string{}
+	for i, f := range record {
+		if i >= 11 && len(f) > 2 && (f[:2] == ClassTag || f[:2] == GeneTag || f[:2] == TranscriptTag || f[:2] == JunctionTag || f[:2] == RejectTag) {
+			continue
+		}
+		fields = append(fields, f)
+	}
+	fields = append(fields, tags...)
+	if aw.bam != nil {
+		aw.err = aw.bam.Write(fields)
+		return
+	}
+	_, aw.err = aw.sam.WriteString(strings.Join(fields, "\t") + "\n")
+}
+
+//tags of the classification of the read, empty values left out
+func (aw *AnnotatedWriter) tags(mr *ReadMapTranscriptome) []string {
+	tags := []string{}
+	if mr.Class != "" {
+		tags = append(tags, ClassTag+":Z:"+mr.Class)
+	}
+	geneIDs := []string{}
+	for _, trancoors := range mr.MapTran {
+		if len(trancoors) > 0 && !AnyString(geneIDs, func(s string) bool { return s == trancoors[0].GeneID }) {
+			geneIDs = append(geneIDs, trancoors[0].GeneID)
+		}
+	}
+	if len(geneIDs) > 0 {
+		tags = append(tags, GeneTag+":Z:"+strings.Join(geneIDs, ","))
+	}
+	names := []string{}
+	for _, t := range mr.CompatibleTranscripts(aw.genes) {
+		names = append(names, t.TranscriptName)
+	}
+	if len(names) > 0 {
+		tags = append(tags, TranscriptTag+":Z:"+strings.Join(names, ","))
+	}
+	classes := []string{}
+	for _, intron := range mr.Junctions() {
+		j := Junction{mr.Chromosome, mr.Strand, intron}
+		class, ok := aw.junctions[j]
+		if !ok {
+			rec := genodatastruct.JunctionRec{Chromosome: j.Chromosome, Strand: j.Strand, Intron: intron, Motif: -1}
+			jt, _ := ClassifyJunction(rec, aw.genes, aw.index)
+			class = jt.Class
+			aw.junctions[j] = class
+		}
+		classes = append(classes, class)
+	}
+	if len(classes) > 0 {
+		tags = append(tags, JunctionTag+":Z:"+strings.Join(classes, ","))
+	}
+	return tags
+}
+
+//Close flushes the alignments and returns the first error of the writer
+func (aw *AnnotatedWriter) Close() error {
+	if aw.err != nil {
+		return aw.err
+	}
+	if aw.bam != nil {
+		return aw.bam.Close()
+	}
+	return aw.sam.Flush()
+}
@@ -0,0 +1,59 @@
+package splicetype
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestAnnotatedWriterRejects(t *testing.T) {
+	genes := map[string]*genodatastruct.Gene{"G1": {GeneName: "ONE", Chromosome: "chr1", Strand: "+", Coordinate: genodatastruct.Coor{Start: 100, End: 400},
+		Transcripts: []*genodatastruct.Transcript{{TranscriptName: "T1", Chromosome: "chr1", Strand: "+", Coordinate: genodatastruct.Coor{Start: 100, End: 400},
+			Exons: []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 300, End: 400}}, Introns: []genodatastruct.Coor{{Start: 201, End: 299}}}}}}
+	sam := strings.Join([]string{
+		"@HD\tVN:1.6\tSO:coordinate",
+		"unmapped\t4\t*\t0\t0\t*\t*\t0\t0\tACGT\tFFFF",
+		"spliced\t0\tchr1\t150\t60\t51M99N51M\t*\t0\t0\t*\t*",
+		"lowmapq\t0\tchr1\t150\t10\t51M99N51M\t*\t0\t0\t*\t*",
+		"short\t0\tchr1\t196\t60\t5M49N51M\t*\t0\t0\t*\t*\tsc:Z:normal", //tag of a previous run
+	}, "\n") + "\n"
+	f, err := ioutil.TempFile("", "annotated*.sam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(sam); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	var buf bytes.Buffer
+	aw, err := NewAnnotatedWriter(&buf, []string{"@HD\tVN:1.6\tSO:unsorted"}, false, genes, SortGeneMap(genes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := DefaultReadOptions()
+	opt.Rejected = aw.Reject
+	ClassifyAlignments(f.Name(), opt, genes, SortGeneMap(genes), 2, aw.Add)
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	//every record is written back, in the order of the workers
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")[1:]
+	sort.Strings(lines)
+	want := []string{"lowmapq rj:Z:" + Filtered, "short rj:Z:" + ShortAnchor, "spliced sc:Z:normal", "unmapped rj:Z:" + Unmapped}
+	if len(lines) != len(want) {
+		t.Fatalf("records %q, want %v", lines, want)
+	}
+	for i, line := range lines {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 12 || fields[0]+" "+fields[11] != want[i] || (fields[0] == "short" && len(fields) != 12) {
+			t.Errorf("record %q, want %s", line, want[i])
+		}
+	}
+}
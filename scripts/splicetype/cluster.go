@@ -0,0 +1,251 @@
+package splicetype
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//IntronCluster is a leafcutter splicing cluster: introns of a strand linked
+//by shared donor or acceptor sites, without reference to the annotation
+type IntronCluster struct {
+	ID         string
+	Chromosome string
+	Strand     string
+	Introns    []genodatastruct.Coor //sorted by start and end
+	GeneIDs    []string              //genes overlapping the cluster, see AnnotateClusters
+}
+
+//Span of the introns of the cluster
+func (c *IntronCluster) Span() genodatastruct.Coor {
+	span := c.Introns[0]
+	for _, intron := range c.Introns {
+		if intron.End > span.End {
+			span.End = intron.End
+		}
+	}
+	return span
+}
+
+//ClusterOptions are the filters of leafcutter_cluster
+type ClusterOptions struct {
+	MinClusterReads int     //reads of all samples in a cluster
+	MinIntronRatio  float64 //reads of an intron over those of its cluster
+	MaxIntronLength int
+}
+
+//DefaultClusterOptions are the defaults of leafcutter
+var DefaultClusterOptions = ClusterOptions{MinClusterReads: 30, MinIntronRatio: 0.001, MaxIntronLength: 100000}
+
+//ClusterIntrons pools the junctions of the samples and clusters them as
+//leafcutter does: introns are grouped by overlap, split into groups sharing
+//a splice site, then rare introns are removed and the clusters linked again.
+//Clusters of a single intron are not informative and left out
+func ClusterIntrons(samples []*JunctionCounter, opt ClusterOptions) []*IntronCluster {
+	type strandKey struct{ Chromosome, Strand string }
+	pooled := map[Junction]float64{}
+	byStrand := map[strandKey][]genodatastruct.Coor{}
+	for _, sample := range samples {
+		for j, n := range sample.Counts {
+			if j.Intron.End-j.Intron.Start+1 > opt.MaxIntronLength {
+				continue
+			}
+			if _, ok := pooled[j]; !ok {
+				key := strandKey{j.Chromosome, j.Strand}
+				byStrand[key] = append(byStrand[key], j.Intron)
+			}
+			pooled[j] += n
+		}
+	}
+	keys := []strandKey{}
+	for key := range byStrand {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Chromosome != keys[j].Chromosome {
+			return keys[i].Chromosome < keys[j].Chromosome
+		}
+		return keys[i].Strand < keys[j].Strand
+	})
+	clusters := []*IntronCluster{}
+	for _, key := range keys {
+		reads := func(intron genodatastruct.Coor) float64 {
+			return pooled[Junction{key.Chromosome, key.Strand, intron}]
+		}
+		for _, group := range overlapGroups(byStrand[key]) {
+			for _, linked := range linkBySite(group) {
+				total := 0.0
+				for _, intron := range linked {
+					total += reads(intron)
+				}
+				if total < float64(opt.MinClusterReads) {
+					continue
+				}
+				kept := []genodatastruct.Coor{}
+				for _, intron := range linked {
+					if reads(intron)/total >= opt.MinIntronRatio {
+						kept = append(kept, intron)
+					}
+				}
+				for _, refined := range linkBySite(kept) {
+					total := 0.0
+					for _, intron := range refined {
+						total += reads(intron)
+					}
+					if len(refined) < 2 || total < float64(opt.MinClusterReads) {
+						continue
+					}
+					clusters = append(clusters, &IntronCluster{Chromosome: key.Chromosome, Strand: key.Strand, Introns: refined})
+				}
+			}
+		}
+	}
+	sort.SliceStable(clusters, func(i, j int) bool {
+		if clusters[i].Chromosome != clusters[j].Chromosome {
+			return clusters[i].Chromosome < clusters[j].Chromosome
+		}
+		return clusters[i].Introns[0].Start < clusters[j].Introns[0].Start
+	})
+	for i, c := range clusters {
+		strand := c.Strand
+		if strand != "+" && strand != "-" {
+			strand = "NA"
+		}
+		c.ID = fmt.Sprintf("clu_%d_%s", i+1, strand)
+	}
+	return clusters
+}
+
+//overlapGroups sorts the introns and groups the overlapping ones
+func overlapGroups(introns []genodatastruct.Coor) [][]genodatastruct.Coor {
+	sorted := append([]genodatastruct.Coor{}, introns...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Start != sorted[j].Start {
+			return sorted[i].Start < sorted[j].Start
+		}
+		return sorted[i].End < sorted[j].End
+	})
+	groups := [][]genodatastruct.Coor{}
+	end := -1
+	for _, intron := range sorted {
+		if len(groups) == 0 || intron.Start > end {
+			groups = append(groups, []genodatastruct.Coor{})
+			end = intron.End
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], intron)
+		if intron.End > end {
+			end = intron.End
+		}
+	}
+	return groups
+}
+
+//linkBySite splits sorted introns into the groups connected by shared starts or ends
+func linkBySite(introns []genodatastruct.Coor) [][]genodatastruct.Coor {
+	parent := make([]int, len(introns))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	byStart, byEnd := map[int]int{}, map[int]int{}
+	for i, intron := range introns {
+		if k, ok := byStart[intron.Start]; ok {
+			parent[find(i)] = find(k)
+		} else {
+			byStart[intron.Start] = i
+		}
+		if k, ok := byEnd[intron.End]; ok {
+			parent[find(i)] = find(k)
+		} else {
+			byEnd[intron.End] = i
+		}
+	}
+	//groups in the order of their first intron
+	index := map[int]int{}
+	groups := [][]genodatastruct.Coor{}
+	for i, intron := range introns {
+		root := find(i)
+		if _, ok := index[root]; !ok {
+			index[root] = len(groups)
+			groups = append(groups, []genodatastruct.Coor{})
+		}
+		groups[index[root]] = append(groups[index[root]], intron)
+	}
+	return groups
+}
+
+//AnnotateClusters tags the clusters with the genes containing the exonic
+//bases flanking their introns, on the strand of the cluster when known
+func AnnotateClusters(clusters []*IntronCluster, genes map[string]*genodatastruct.Gene, index map[string]*GeneMapIndex) {
+	for _, c := range clusters {
+		mr := ReadMapTranscriptome{Chromosome: c.Chromosome}
+		for _, intron := range c.Introns {
+			mr.Segment = append(mr.Segment, genodatastruct.Coor{Start: intron.Start - 1, End: intron.Start - 1},
+				genodatastruct.Coor{Start: intron.End + 1, End: intron.End + 1})
+		}
+		mr.InvolvedGeneLoci(index)
+		c.GeneIDs = nil
+		for _, geneid := range mr.GeneLoci {
+			g, ok := genes[geneid]
+			if !ok || ((c.Strand == "+" || c.Strand == "-") && g.Strand != c.Strand) {
+				continue
+			}
+			c.GeneIDs = append(c.GeneIDs, geneid)
+		}
+		sort.Strings(c.GeneIDs)
+	}
+}
+
+//WriteClusterCounts writes the leafcutter count matrix (perind.counts): a
+//header of the sample names, then a row per intron named by its chromosome,
+//start, end and cluster joined by colons, with the intron reads over the
+//cluster reads of every sample. Start is 0-based and end 1-based as in BED
+func WriteClusterCounts(w io.Writer, clusters []*IntronCluster, samples []*JunctionCounter, names []string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "chrom "+strings.Join(names, " "))
+	for _, c := range clusters {
+		totals := make([]float64, len(samples))
+		for s, sample := range samples {
+			for _, intron := range c.Introns {
+				totals[s] += sample.Count(c.Chromosome, c.Strand, intron)
+			}
+		}
+		for _, intron := range c.Introns {
+			fmt.Fprintf(bw, "%s:%d:%d:%s", c.Chromosome, intron.Start-1, intron.End, c.ID)
+			for s, sample := range samples {
+				fmt.Fprintf(bw, " %s/%s", FormatCount(sample.Count(c.Chromosome, c.Strand, intron)), FormatCount(totals[s]))
+			}
+			fmt.Fprintln(bw)
+		}
+	}
+	return bw.Flush()
+}
+
+//WriteClusterGenes writes the cluster locations and their overlapping genes
+func WriteClusterGenes(w io.Writer, clusters []*IntronCluster, genes map[string]*genodatastruct.Gene) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "cluster\tchromosome\tstart\tend\tstrand\tintrons\tgene_ids\tgene_names")
+	for _, c := range clusters {
+		ids, names := "-", "-"
+		if len(c.GeneIDs) > 0 {
+			geneNames := []string{}
+			for _, geneid := range c.GeneIDs {
+				geneNames = append(geneNames, genes[geneid].GeneName)
+			}
+			ids, names = strings.Join(c.GeneIDs, ","), strings.Join(geneNames, ",")
+		}
+		span := c.Span()
+		fmt.Fprintf(bw, "%s\t%s\t%d\t%d\t%s\t%d\t%s\t%s\n", c.ID, c.Chromosome, span.Start, span.End, c.Strand, len(c.Introns), ids, names)
+	}
+	return bw.Flush()
+}
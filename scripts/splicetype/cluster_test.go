@@ -0,0 +1,35 @@
+package splicetype
+
+import (
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestClusterIntrons(t *testing.T) {
+	a, b := NewJunctionCounter(), NewJunctionCounter()
+	add := func(jc *JunctionCounter, start, end, n int) {
+		jc.Counts[Junction{"chr1", "+", genodatastruct.Coor{Start: start, End: end}}] += float64(n)
+	}
+	//a skipping cluster, an intron sharing no site with it and a rare intron
+	add(a, 100, 200, 20)
+	add(a, 300, 400, 20)
+	add(b, 100, 400, 10)
+	add(b, 150, 350, 30)
+	add(a, 100, 250, 1)
+	opt := ClusterOptions{MinClusterReads: 30, MinIntronRatio: 0.02, MaxIntronLength: 1000}
+	clusters := ClusterIntrons([]*JunctionCounter{a, b}, opt)
+	if len(clusters) != 1 {
+		t.Fatalf("got %d clusters, want 1", len(clusters))
+	}
+	c := clusters[0]
+	want := []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 100, End: 400}, {Start: 300, End: 400}}
+	if c.ID != "clu_1_+" || len(c.Introns) != len(want) {
+		t.Fatalf("got cluster %s of %v", c.ID, c.Introns)
+	}
+	for i := range want {
+		if c.Introns[i] != want[i] {
+			t.Errorf("intron %d is %v, want %v", i, c.Introns[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package splicetype
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//crypticSegments returns the internal segments lying entirely inside a single
+//intron of the transcript while all the other segments are exonic. Such segments
+//are bounded by novel junctions on both sides, i.e. a cryptic (pseudo-)exon.
+//Return nil if the read does not follow the pattern
+func crypticSegments(trancoors []TranCoor) []int {
+	result := []int{}
+	for i, tc := range trancoors {
+		switch tc.ClassSeg() {
+		case Exonic:
+			continue
+		case Intronic:
+			if i == 0 || i == len(trancoors)-1 || len(tc.IntronID) != 1 {
+				return nil
+			}
+			result = append(result, i)
+		default:
+			return nil
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+//gap between two segments regardless of their order
+func gap(a, b genodatastruct.Coor) genodatastruct.Coor {
+	if a.Start > b.Start {
+		a, b = b, a
+	}
+	return genodatastruct.Coor{Start: a.End + 1, End: b.Start - 1}
+}
+
+//CrypticExon is a candidate novel exon found inside an annotated intron
+type CrypticExon struct {
+	GeneID     string
+	Chromosome string
+	Strand     string
+	Coordinate genodatastruct.Coor
+	HostIntron genodatastruct.Coor
+	Reads      float64 //reads carrying the exon as an internal segment
+	UpReads    float64 //reads splicing into the exon from upstream
+	DownReads  float64 //reads splicing out of the exon to downstream
+	HostReads  float64 //reads splicing over the host intron
+	hosts      map[genodatastruct.Coor]bool
+	upstream   map[genodatastruct.Coor]bool
+	downstream map[genodatastruct.Coor]bool
+}
+
+//ID is a stable identifier of the cryptic exon
+func (ce *CrypticExon) ID() string {
+	return fmt.Sprintf("CE:%s:%d-%d:%s", ce.Chromosome, ce.Coordinate.Start, ce.Coordinate.End, ce.Strand)
+}
+
+//CrypticExonFinder aggregates the cryptic exon segments across reads
+type CrypticExonFinder struct {
+	Genes     map[string]*genodatastruct.Gene
+	Junctions *JunctionCounter
+	exons     map[Junction]*CrypticExon //keyed by chromosome, strand and exon coordinate
+}
+
+func NewCrypticExonFinder(genes map[string]*genodatastruct.Gene, junctions *JunctionCounter) *CrypticExonFinder {
+	return &CrypticExonFinder{
+		Genes:     genes,
+		Junctions: junctions,
+		exons:     map[Junction]*CrypticExon{},
+	}
+}
+
+//Add collects the cryptic exon segments of a read classified as crypticExon
+func (f *CrypticExonFinder) Add(mr *ReadMapTranscriptome) {
+	if mr.Class != "crypticExon" {
+		return
+	}
+	seen := map[int]bool{} //count a read once per segment
+	for _, trancoors := range mr.MapTran {
+		for _, i := range crypticSegments(trancoors) {
+			seg := mr.Segment[i]
+			key := Junction{mr.Chromosome, mr.Strand, seg}
+			ce, ok := f.exons[key]
+			if !ok {
+				ce = &CrypticExon{
+					GeneID:     trancoors[i].GeneID,
+					Chromosome: mr.Chromosome,
+					Strand:     mr.Strand,
+					Coordinate: seg,
+					hosts:      map[genodatastruct.Coor]bool{},
+					upstream:   map[genodatastruct.Coor]bool{},
+					downstream: map[genodatastruct.Coor]bool{},
+				}
+				f.exons[key] = ce
+			}
+			if !seen[i] {
+				ce.Reads += mr.Weight
+				seen[i] = true
+			}
+			t := f.Genes[trancoors[i].GeneID].Transcript(trancoors[i].TranscriptName)
+			ce.hosts[t.Introns[trancoors[i].IntronID[0]]] = true
+			//segments are ordered along the transcript
+			ce.upstream[gap(mr.Segment[i-1], seg)] = true
+			ce.downstream[gap(seg, mr.Segment[i+1])] = true
+		}
+	}
+}
+
+//Candidates returns the cryptic exons supported by at least minReads reads,
+//with the read counts of their flanking junctions and host intron
+func (f *CrypticExonFinder) Candidates(minReads int) []*CrypticExon {
+	result := []*CrypticExon{}
+	for _, ce := range f.exons {
+		if ce.Reads < float64(minReads) {
+			continue
+		}
+		ce.UpReads, ce.DownReads = 0, 0
+		for intron := range ce.upstream {
+			ce.UpReads += f.Junctions.Count(ce.Chromosome, ce.Strand, intron)
+		}
+		for intron := range ce.downstream {
+			ce.DownReads += f.Junctions.Count(ce.Chromosome, ce.Strand, intron)
+		}
+		//the best supported intron of the hosting transcripts
+		ce.HostReads = -1
+		for intron := range ce.hosts {
+			n := f.Junctions.Count(ce.Chromosome, ce.Strand, intron)
+			if n > ce.HostReads || (n == ce.HostReads && intron.Start < ce.HostIntron.Start) {
+				ce.HostIntron, ce.HostReads = intron, n
+			}
+		}
+		result = append(result, ce)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Chromosome != result[j].Chromosome {
+			return result[i].Chromosome < result[j].Chromosome
+		}
+		return result[i].Coordinate.Start < result[j].Coordinate.Start
+	})
+	return result
+}
+
+//WriteCrypticGTF writes cryptic exons as GTF exon records for re-annotation
+func WriteCrypticGTF(w io.Writer, exons []*CrypticExon, genes map[string]*genodatastruct.Gene) error {
+	bw := bufio.NewWriter(w)
+	for _, ce := range exons {
+		genename := ""
+		if g, ok := genes[ce.GeneID]; ok {
+			genename = g.GeneName
+		}
+		fmt.Fprintf(bw, "%s\tAberrantSplice\texon\t%d\t%d\t%s\t%s\t.\t", ce.Chromosome, ce.Coordinate.Start, ce.Coordinate.End, FormatCount(ce.Reads), ce.Strand)
+		fmt.Fprintf(bw, "gene_id \"%s\"; gene_name \"%s\"; transcript_id \"%s\"; exon_id \"%s\"; ", ce.GeneID, genename, ce.ID(), ce.ID())
+		fmt.Fprintf(bw, "host_intron \"%d-%d\"; reads \"%s\"; up_junction_reads \"%s\"; down_junction_reads \"%s\"; host_intron_reads \"%s\";\n",
+			ce.HostIntron.Start, ce.HostIntron.End, FormatCount(ce.Reads), FormatCount(ce.UpReads), FormatCount(ce.DownReads), FormatCount(ce.HostReads))
+	}
+	return bw.Flush()
+}
+
+//WriteCrypticBED writes cryptic exons as BED6 (0-based, half open) records
+func WriteCrypticBED(w io.Writer, exons []*CrypticExon) error {
+	bw := bufio.NewWriter(w)
+	for _, ce := range exons {
+		fmt.Fprintf(bw, "%s\t%d\t%d\t%s|%s\t%d\t%s\n", ce.Chromosome, ce.Coordinate.Start-1, ce.Coordinate.End, ce.GeneID, ce.ID(), int(math.Round(ce.Reads)), ce.Strand)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,52 @@
+package splicetype
+
+import (
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestCrypticExonFinder(t *testing.T) {
+	t1 := &genodatastruct.Transcript{TranscriptName: "T1", Chromosome: "chr1", Strand: "+", Coordinate: genodatastruct.Coor{Start: 100, End: 600},
+		Exons: []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 500, End: 600}}}
+	t1.Introns = t1.GenerateIntrons()
+	genes := map[string]*genodatastruct.Gene{"G1": {GeneName: "ONE", Chromosome: "chr1", Strand: "+", Coordinate: genodatastruct.Coor{Start: 100, End: 600},
+		Transcripts: []*genodatastruct.Transcript{t1}}}
+	junctions := NewJunctionCounter()
+	finder := NewCrypticExonFinder(genes, junctions)
+	for _, cigar := range []string{
+		"50M99N51M149N51M", //exon 300-350 in the intron 201-499
+		"50M99N51M149N51M",
+		"50M119N31M149N51M", //exon 320-350
+		"50M299N51M",        //splicing over the host intron
+		"50M99N101M",        //intronic last segment, no cryptic exon
+	} {
+		mr := NewReadMapTranscriptome(genodatastruct.SamRec{QName: "r", Chromosome: "chr1", Pos: 151, CIGAR: cigar})
+		mr.GeneLoci = []string{"G1"}
+		mr.MapToTran(genes)
+		mr.Class = mr.SpliceType(genes)
+		junctions.Add(mr)
+		finder.Add(mr)
+	}
+
+	candidates := finder.Candidates(2)
+	if len(candidates) != 1 {
+		t.Fatalf("%d candidates of 2 reads, want 1", len(candidates))
+	}
+	ce := candidates[0]
+	//the intronic read splices into the exon too
+	want := CrypticExon{GeneID: "G1", Chromosome: "chr1", Strand: "+", Coordinate: genodatastruct.Coor{Start: 300, End: 350},
+		HostIntron: genodatastruct.Coor{Start: 201, End: 499}, Reads: 2, UpReads: 3, DownReads: 3, HostReads: 1}
+	if ce.GeneID != want.GeneID || ce.Chromosome != want.Chromosome || ce.Strand != want.Strand || ce.Coordinate != want.Coordinate ||
+		ce.HostIntron != want.HostIntron || ce.Reads != want.Reads || ce.UpReads != want.UpReads || ce.DownReads != want.DownReads || ce.HostReads != want.HostReads {
+		t.Errorf("candidate %+v, want %+v", *ce, want)
+	}
+	if id := ce.ID(); id != "CE:chr1:300-350:+" {
+		t.Errorf("ID %s", id)
+	}
+
+	candidates = finder.Candidates(1)
+	if len(candidates) != 2 || candidates[1].Coordinate != (genodatastruct.Coor{Start: 320, End: 350}) || candidates[1].Reads != 1 || candidates[1].UpReads != 1 {
+		t.Errorf("candidates of 1 read %+v, want 300-350 and 320-350 of 1 read", candidates)
+	}
+}
@@ -0,0 +1,177 @@
+package splicetype
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+	"github.com/Hanbin/AberrantSplice/Internal/splicestats"
+)
+
+//EventCount is the inclusion and exclusion reads of an event in a sample
+type EventCount struct {
+	Inclusion, Exclusion float64
+}
+
+//CountEvents merges the events of the samples and counts every event in every
+//sample, so a sample without reads classified to an event still reports the
+//junctions of both isoforms. Events need minReads classified reads over all
+//the samples. Events are sorted by location
+func CountEvents(tables []*EventTable, minReads int) ([]*Event, [][]EventCount) {
+	merged := map[string]*Event{}
+	for _, et := range tables {
+		for id, e := range et.events {
+			known, ok := merged[id]
+			if !ok {
+				copied := *e
+				copied.InclusionJunctions = append([]genodatastruct.Coor{}, e.InclusionJunctions...)
+				copied.ExclusionJunctions = append([]genodatastruct.Coor{}, e.ExclusionJunctions...)
+				copied.Reads = 0
+				known = &copied
+				merged[id] = known
+			}
+			known.InclusionJunctions = addCoor(known.InclusionJunctions, e.InclusionJunctions...)
+			known.ExclusionJunctions = addCoor(known.ExclusionJunctions, e.ExclusionJunctions...)
+			known.Reads += e.Reads
+		}
+	}
+	events := []*Event{}
+	for _, e := range merged {
+		if e.Reads >= float64(minReads) {
+			events = append(events, e)
+		}
+	}
+	sortEvents(events)
+	counts := make([][]EventCount, len(events))
+	for i, e := range events {
+		counts[i] = make([]EventCount, len(tables))
+		for s, et := range tables {
+			reads := 0.0
+			if own, ok := et.events[e.ID]; ok {
+				reads = own.Reads
+			}
+			counts[i][s].Inclusion, counts[i][s].Exclusion = e.CountIn(et.Junctions, reads)
+		}
+	}
+	return events, counts
+}
+
+//sortEvents by chromosome, start and ID
+func sortEvents(events []*Event) {
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Chromosome != events[j].Chromosome {
+			return events[i].Chromosome < events[j].Chromosome
+		}
+		if events[i].Coordinate.Start != events[j].Coordinate.Start {
+			return events[i].Coordinate.Start < events[j].Coordinate.Start
+		}
+		return events[i].ID < events[j].ID
+	})
+}
+
+//DiffResult is the differential usage of an event between two groups
+type DiffResult struct {
+	Event    *Event
+	Counts   []EventCount //per sample
+	PSI      [2]float64   //mean PSI of the informative samples of each group
+	DeltaPSI float64      //second group minus first group
+	Stat     float64
+	P, Q     float64
+}
+
+//TestEvents tests the differential usage of the events between the samples of
+//group 0 and group 1 (group -1 samples are left out) by a beta-binomial
+//likelihood ratio test on the counts normalized by isoform junctions. Samples
+//with less than minSampleReads normalized reads are not informative. Q-values
+//are Benjamini-Hochberg adjusted over the tested events
+func TestEvents(events []*Event, counts [][]EventCount, group []int, minSampleReads float64) []*DiffResult {
+	results := []*DiffResult{}
+	pvalues := []float64{}
+	for i, e := range events {
+		r := &DiffResult{Event: e, Counts: counts[i]}
+		var grouped [2][]splicestats.Counts
+		var psiSum [2]float64
+		var informative [2]int
+		for s, c := range counts[i] {
+			if group[s] < 0 {
+				continue
+			}
+			inclusion, exclusion := e.Normalize(c.Inclusion, c.Exclusion)
+			if inclusion+exclusion < minSampleReads || inclusion+exclusion <= 0 {
+				grouped[group[s]] = append(grouped[group[s]], splicestats.Counts{})
+				continue
+			}
+			grouped[group[s]] = append(grouped[group[s]], splicestats.Counts{K: inclusion, N: inclusion + exclusion})
+			psiSum[group[s]] += inclusion / (inclusion + exclusion)
+			informative[group[s]]++
+		}
+		for g := range r.PSI {
+			r.PSI[g] = math.NaN()
+			if informative[g] > 0 {
+				r.PSI[g] = psiSum[g] / float64(informative[g])
+			}
+		}
+		r.DeltaPSI = r.PSI[1] - r.PSI[0]
+		r.Stat, r.P = splicestats.BetaBinomialTest(grouped[0], grouped[1])
+		results = append(results, r)
+		pvalues = append(pvalues, r.P)
+	}
+	for i, q := range splicestats.BenjaminiHochberg(pvalues) {
+		results[i].Q = q
+	}
+	return results
+}
+
+//WriteDiff writes the differential usage of the events with the counts of
+//every sample as inclusion/exclusion
+func WriteDiff(w io.Writer, results []*DiffResult, samples []string, groups [2]string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "event_id\tgene_id\tgene_name\ttype\tchromosome\tstart\tend\tstrand\tpsi_%s\tpsi_%s\tdelta_psi\tp_value\tq_value", groups[0], groups[1])
+	for _, s := range samples {
+		fmt.Fprintf(bw, "\t%s", s)
+	}
+	fmt.Fprintln(bw)
+	for _, r := range results {
+		e := r.Event
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s", e.ID, e.GeneID, e.GeneName, e.Type, e.Chromosome,
+			e.Coordinate.Start, e.Coordinate.End, e.Strand, FormatRatio(r.PSI[0]), FormatRatio(r.PSI[1]), FormatRatio(r.DeltaPSI),
+			formatPValue(r.P), formatPValue(r.Q))
+		for _, c := range r.Counts {
+			fmt.Fprintf(bw, "\t%s/%s", FormatCount(c.Inclusion), FormatCount(c.Exclusion))
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
+
+//formatPValue prints a p-value for tables, NA for NaN
+func formatPValue(p float64) string {
+	if math.IsNaN(p) {
+		return "NA"
+	}
+	return strconv.FormatFloat(p, 'g', 4, 64)
+}
+
+//WriteEventMatrix writes the inclusion and exclusion reads of the events in
+//two columns per sample
+func WriteEventMatrix(w io.Writer, events []*Event, counts [][]EventCount, samples []string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, "event_id\tgene_id\tgene_name\ttype\tchromosome\tstart\tend\tstrand")
+	for _, s := range samples {
+		fmt.Fprintf(bw, "\t%s_inclusion\t%s_exclusion", s, s)
+	}
+	fmt.Fprintln(bw)
+	for i, e := range events {
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s", e.ID, e.GeneID, e.GeneName, e.Type, e.Chromosome,
+			e.Coordinate.Start, e.Coordinate.End, e.Strand)
+		for _, c := range counts[i] {
+			fmt.Fprintf(bw, "\t%s\t%s", FormatCount(c.Inclusion), FormatCount(c.Exclusion))
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,133 @@
+package splicetype
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestCountEvents(t *testing.T) {
+	gene := &genodatastruct.Gene{GeneName: "ONE"}
+	skipping := func(inclusion ...genodatastruct.Coor) *Event {
+		e := newEvent(gene, "G", "exonSkipping", "chr1", "+", genodatastruct.Coor{Start: 300, End: 400})
+		e.InclusionJunctions = inclusion
+		e.ExclusionJunctions = []genodatastruct.Coor{{Start: 201, End: 599}}
+		return e
+	}
+	//retained intron counted by its reads against the spliced intron
+	retention := func() *Event {
+		e := newEvent(gene, "G", "intronRetention", "chr1", "+", genodatastruct.Coor{Start: 401, End: 599})
+		e.ExclusionJunctions = []genodatastruct.Coor{{Start: 401, End: 599}}
+		return e
+	}
+	table := func(junctions map[genodatastruct.Coor]float64) *EventTable {
+		jc := NewJunctionCounter()
+		for intron, reads := range junctions {
+			jc.Counts[Junction{"chr1", "+", intron}] = reads
+		}
+		return NewEventTable(nil, jc)
+	}
+	a := table(map[genodatastruct.Coor]float64{{Start: 201, End: 299}: 10, {Start: 401, End: 599}: 8, {Start: 201, End: 599}: 2})
+	b := table(map[genodatastruct.Coor]float64{{Start: 201, End: 299}: 4, {Start: 401, End: 599}: 6, {Start: 201, End: 599}: 10})
+	//each sample saw one inclusion junction of the skipped exon
+	a.addEvent(skipping(genodatastruct.Coor{Start: 201, End: 299}), 2)
+	b.addEvent(skipping(genodatastruct.Coor{Start: 401, End: 599}), 3)
+	b.addEvent(retention(), 4)
+	rare := newEvent(gene, "G", "crypticExon", "chr1", "+", genodatastruct.Coor{Start: 250, End: 260})
+	rare.ExclusionJunctions = []genodatastruct.Coor{{Start: 201, End: 299}}
+	a.addEvent(rare, 1)
+
+	events, counts := CountEvents([]*EventTable{a, b}, 2)
+	if len(events) != 2 || events[0].Type != "exonSkipping" || events[1].Type != "intronRetention" {
+		t.Fatalf("events %v, want the exon skipping and the intron retention", events)
+	}
+	if e := events[0]; len(e.InclusionJunctions) != 2 || e.Reads != 5 {
+		t.Errorf("merged event with inclusion junctions %v and %v reads, want both junctions and 5 reads", e.InclusionJunctions, e.Reads)
+	}
+	if n := len(a.events[events[0].ID].InclusionJunctions); n != 1 {
+		t.Errorf("merging changed the event of the sample to %d inclusion junctions", n)
+	}
+	//the retention is counted in the sample without reads classified to it
+	want := [][]EventCount{
+		{{Inclusion: 18, Exclusion: 2}, {Inclusion: 10, Exclusion: 10}},
+		{{Inclusion: 0, Exclusion: 8}, {Inclusion: 4, Exclusion: 6}},
+	}
+	for i := range want {
+		for s := range want[i] {
+			if counts[i][s] != want[i][s] {
+				t.Errorf("%s in sample %d: %+v, want %+v", events[i].Type, s, counts[i][s], want[i][s])
+			}
+		}
+	}
+}
+
+func TestTestEvents(t *testing.T) {
+	event := func(id string, start int) *Event {
+		return &Event{ID: id, GeneID: "G", GeneName: "ONE", Type: "intronRetention", Chromosome: "chr1", Strand: "+",
+			Coordinate:         genodatastruct.Coor{Start: start, End: start + 100},
+			ExclusionJunctions: []genodatastruct.Coor{{Start: start, End: start + 100}}}
+	}
+	events := []*Event{event("E1", 100), event("E2", 300), event("E3", 500)}
+	//samples of groups a, a, b, b and a sample of no group
+	group := []int{0, 0, 1, 1, -1}
+	counts := [][]EventCount{
+		{{90, 10}, {85, 15}, {10, 90}, {15, 85}, {0, 1000}},
+		//the second b sample is below the minimum reads
+		{{50, 50}, {60, 40}, {2, 18}, {3, 0}, {0, 1000}},
+		//no informative b sample
+		{{50, 50}, {60, 40}, {0, 0}, {1, 1}, {0, 1000}},
+	}
+	results := TestEvents(events, counts, group, 5)
+	near := func(x, y float64) bool {
+		return (math.IsNaN(x) && math.IsNaN(y)) || math.Abs(x-y) < 1e-9
+	}
+	want := []struct {
+		psi   [2]float64
+		delta float64
+	}{
+		{[2]float64{0.875, 0.125}, -0.75},
+		{[2]float64{0.55, 0.1}, -0.45},
+		{[2]float64{0.55, math.NaN()}, math.NaN()},
+	}
+	for i, r := range results {
+		if !near(r.PSI[0], want[i].psi[0]) || !near(r.PSI[1], want[i].psi[1]) || !near(r.DeltaPSI, want[i].delta) {
+			t.Errorf("%s: PSI %v delta %v, want %v %v", r.Event.ID, r.PSI, r.DeltaPSI, want[i].psi, want[i].delta)
+		}
+	}
+	if p := results[0].P; !(p < 0.01) {
+		t.Errorf("p-value %v of the PSI shift of E1", p)
+	}
+	if r := results[2]; !math.IsNaN(r.P) || !math.IsNaN(r.Q) {
+		t.Errorf("E3 without informative sample in a group: p %v q %v, want NaN", r.P, r.Q)
+	}
+	//the q-values adjust the two tested events only
+	p1, p2 := results[0].P, results[1].P
+	if !(p1 < p2) || !near(results[1].Q, p2) || !near(results[0].Q, math.Min(2*p1, p2)) {
+		t.Errorf("p-values %v %v adjusted to %v %v", p1, p2, results[0].Q, results[1].Q)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteDiff(&buf, results, []string{"s1", "s2", "s3", "s4", "s5"}, [2]string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || lines[0] != "event_id\tgene_id\tgene_name\ttype\tchromosome\tstart\tend\tstrand\tpsi_a\tpsi_b\tdelta_psi\tp_value\tq_value\ts1\ts2\ts3\ts4\ts5" {
+		t.Fatalf("differential table %q", lines)
+	}
+	if want := "E3\tG\tONE\tintronRetention\tchr1\t500\t600\t+\t0.5500\tNA\tNA\tNA\tNA\t50/50\t60/40\t0/0\t1/1\t0/1000"; lines[3] != want {
+		t.Errorf("row of an untested event %q, want %q", lines[3], want)
+	}
+
+	buf.Reset()
+	if err := WriteEventMatrix(&buf, events[:1], counts[:1], []string{"s1", "s2", "s3", "s4", "s5"}); err != nil {
+		t.Fatal(err)
+	}
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "\ts1_inclusion\ts1_exclusion\ts2_inclusion\ts2_exclusion\ts3_inclusion\ts3_exclusion\ts4_inclusion\ts4_exclusion\ts5_inclusion\ts5_exclusion") ||
+		lines[1] != "E1\tG\tONE\tintronRetention\tchr1\t100\t200\t+\t90\t10\t85\t15\t10\t90\t15\t85\t0\t1000" {
+		t.Errorf("event matrix %q", lines)
+	}
+}
@@ -0,0 +1,196 @@
+package splicetype
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//TranscriptRef names a transcript of a gene
+type TranscriptRef struct {
+	GeneID, TranscriptName string
+}
+
+func (tr TranscriptRef) String() string {
+	return tr.GeneID + ":" + tr.TranscriptName
+}
+
+//CompatibleRefs are the transcripts of CompatibleTranscripts with their
+//genes, sorted by gene and transcript name
+func (mr *ReadMapTranscriptome) CompatibleRefs(genes map[string]*genodatastruct.Gene) []TranscriptRef {
+	refs := []TranscriptRef{}
+	mr.eachCompatible(genes, func(geneID string, t *genodatastruct.Transcript) {
+		refs = append(refs, TranscriptRef{geneID, t.TranscriptName})
+	})
+	sort.Slice(refs, func(a, b int) bool {
+		if refs[a].GeneID != refs[b].GeneID {
+			return refs[a].GeneID < refs[b].GeneID
+		}
+		return refs[a].TranscriptName < refs[b].TranscriptName
+	})
+	return refs
+}
+
+//EquivalenceClass is a set of transcripts and the fragments compatible with
+//exactly these transcripts
+type EquivalenceClass struct {
+	ID          string //EC and the rank of the class in the sorted classes
+	Transcripts []TranscriptRef
+	Reads       float64 //fragments, a pair counting once
+}
+
+//GeneIDs of the transcripts of the class, in order
+func (ec *EquivalenceClass) GeneIDs() []string {
+	ids := []string{}
+	for _, tr := range ec.Transcripts {
+		if len(ids) == 0 || ids[len(ids)-1] != tr.GeneID {
+			ids = append(ids, tr.GeneID)
+		}
+	}
+	return ids
+}
+
+//EquivalenceClassCounter groups the classified fragments by their
+//compatible transcripts. The mates of a pair (names ending in /1 and /2 at
+//the same pair of positions) make one fragment, compatible with the
+//transcripts compatible with both mates, and weighing the mean of their
+//weights. A mate whose partner never comes, such as a mate left out by the
+//filter, counts on its own
+type EquivalenceClassCounter struct {
+	Unassigned float64 //fragments in genes compatible with none of their transcripts, complete once Classes is called
+	genes      map[string]*genodatastruct.Gene
+	classes    map[string]*EquivalenceClass
+	mates      map[fragmentKey]*fragment //first mates waiting for their partner
+}
+
+//fragment is the compatible transcripts of a read or pair
+type fragment struct {
+	refs   []TranscriptRef
+	weight float64
+	inGene bool //maps to the transcripts of a gene
+}
+
+//fragmentKey pairs the mates of a fragment: the name without the mate
+//suffix, and the chromosome and leftmost position of the pair that tell
+//apart the alignments of a multimapping pair
+type fragmentKey struct {
+	name, chromosome string
+	pos              int
+}
+
+func NewEquivalenceClassCounter(genes map[string]*genodatastruct.Gene) *EquivalenceClassCounter {
+	return &EquivalenceClassCounter{genes: genes, classes: map[string]*EquivalenceClass{}, mates: map[fragmentKey]*fragment{}}
+}
+
+//Add a classified read to the class of its compatible transcripts, a mate
+//once its partner is added too
+func (c *EquivalenceClassCounter) Add(mr *ReadMapTranscriptome) {
+	f := &fragment{refs: mr.CompatibleRefs(c.genes), weight: mr.Weight, inGene: len(mr.MapTran) > 0}
+	key, paired := mr.fragmentKey()
+	if !paired {
+		c.count(f)
+		return
+	}
+	mate, ok := c.mates[key]
+	if !ok {
+		c.mates[key] = f
+		return
+	}
+	delete(c.mates, key)
+	c.count(&fragment{refs: intersectRefs(mate.refs, f.refs), weight: (mate.weight + f.weight) / 2, inGene: mate.inGene || f.inGene})
+}
+
+//fragmentKey of a mate of a pair, paired is false for a single read
+func (mr *ReadMapTranscriptome) fragmentKey() (key fragmentKey, paired bool) {
+	name := strings.TrimSuffix(strings.TrimSuffix(mr.Name, "/1"), "/2")
+	if name == mr.Name {
+		return fragmentKey{}, false
+	}
+	key = fragmentKey{name: name, chromosome: mr.Chromosome}
+	if len(mr.Fields) > 7 {
+		pos, _ := strconv.Atoi(mr.Fields[3])
+		next, _ := strconv.Atoi(mr.Fields[7])
+		if mr.Fields[6] == "=" && next > 0 && next < pos {
+			pos = next
+		}
+		key.pos = pos
+	}
+	return key, true
+}
+
+//intersectRefs are the transcripts in both sorted lists
+func intersectRefs(a, b []TranscriptRef) []TranscriptRef {
+	in := map[TranscriptRef]bool{}
+	for _, tr := range b {
+		in[tr] = true
+	}
+	both := []TranscriptRef{}
+	for _, tr := range a {
+		if in[tr] {
+			both = append(both, tr)
+		}
+	}
+	return both
+}
+
+//count the fragment in the class of its transcripts
+func (c *EquivalenceClassCounter) count(f *fragment) {
+	if !f.inGene {
+		return
+	}
+	if len(f.refs) == 0 {
+		c.Unassigned += f.weight
+		return
+	}
+	names := []string{}
+	for _, tr := range f.refs {
+		names = append(names, tr.String())
+	}
+	key := strings.Join(names, ",")
+	ec, ok := c.classes[key]
+	if !ok {
+		ec = &EquivalenceClass{Transcripts: f.refs}
+		c.classes[key] = ec
+	}
+	ec.Reads += f.weight
+}
+
+//Classes sorted by their transcripts, with IDs EC1, EC2... in this order.
+//The mates still waiting for their partner count on their own
+func (c *EquivalenceClassCounter) Classes() []*EquivalenceClass {
+	for key, f := range c.mates {
+		c.count(f)
+		delete(c.mates, key)
+	}
+	keys := []string{}
+	for key := range c.classes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := []*EquivalenceClass{}
+	for i, key := range keys {
+		ec := c.classes[key]
+		ec.ID = "EC" + strconv.Itoa(i+1)
+		result = append(result, ec)
+	}
+	return result
+}
+
+//WriteEquivalenceClasses writes the classes as a tab separated table
+func WriteEquivalenceClasses(w io.Writer, classes []*EquivalenceClass) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "class_id\tgene_ids\ttranscripts\tnum_transcripts\treads")
+	for _, ec := range classes {
+		names := []string{}
+		for _, tr := range ec.Transcripts {
+			names = append(names, tr.TranscriptName)
+		}
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%d\t%s\n", ec.ID, strings.Join(ec.GeneIDs(), ","), strings.Join(names, ","), len(names), FormatCount(ec.Reads))
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,105 @@
+package splicetype
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestEquivalenceClasses(t *testing.T) {
+	//T1 with the exons 100-200, 300-400 and 500-600, T2 without the middle one
+	t1 := &genodatastruct.Transcript{TranscriptName: "T1", Chromosome: "chr1", Strand: "+", Coordinate: genodatastruct.Coor{Start: 100, End: 600},
+		Exons: []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 300, End: 400}, {Start: 500, End: 600}}}
+	t2 := &genodatastruct.Transcript{TranscriptName: "T2", Chromosome: "chr1", Strand: "+", Coordinate: genodatastruct.Coor{Start: 100, End: 600},
+		Exons: []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 500, End: 600}}}
+	for _, tr := range []*genodatastruct.Transcript{t1, t2} {
+		tr.Introns = tr.GenerateIntrons()
+	}
+	genes := map[string]*genodatastruct.Gene{"G1": {Chromosome: "chr1", Strand: "+", Coordinate: genodatastruct.Coor{Start: 100, End: 600},
+		Transcripts: []*genodatastruct.Transcript{t1, t2}}}
+	counter := NewEquivalenceClassCounter(genes)
+	for _, read := range []struct {
+		pos   int
+		cigar string
+		nh    int
+	}{
+		{151, "50M299N51M", 1}, //T2
+		{151, "50M99N51M", 1},  //T1
+		{151, "50M99N51M", 2},  //T1, half a read
+		{110, "80M", 1},        //both
+		{520, "50M", 1},        //both
+		{181, "30M", 1},        //into the intron of both
+		{151, "50M109N41M", 1}, //novel acceptor
+	} {
+		mr := NewReadMapTranscriptome(genodatastruct.SamRec{Chromosome: "chr1", Pos: read.pos, CIGAR: read.cigar})
+		mr.GeneLoci = []string{"G1"}
+		mr.MapToTran(genes)
+		mr.Weight = 1 / float64(read.nh)
+		counter.Add(mr)
+	}
+	if counter.Unassigned != 2 {
+		t.Errorf("unassigned %v, want 2", counter.Unassigned)
+	}
+	var b bytes.Buffer
+	if err := WriteEquivalenceClasses(&b, counter.Classes()); err != nil {
+		t.Fatal(err)
+	}
+	want := "class_id\tgene_ids\ttranscripts\tnum_transcripts\treads\n" +
+		"EC1\tG1\tT1\t1\t1.5\n" +
+		"EC2\tG1\tT1,T2\t2\t2\n" +
+		"EC3\tG1\tT2\t1\t1\n"
+	if b.String() != want {
+		t.Errorf("classes\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestEquivalenceClassMates(t *testing.T) {
+	t1 := &genodatastruct.Transcript{TranscriptName: "T1", Chromosome: "chr1", Strand: "+", Coordinate: genodatastruct.Coor{Start: 100, End: 600},
+		Exons: []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 300, End: 400}, {Start: 500, End: 600}}}
+	t2 := &genodatastruct.Transcript{TranscriptName: "T2", Chromosome: "chr1", Strand: "+", Coordinate: genodatastruct.Coor{Start: 100, End: 600},
+		Exons: []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 500, End: 600}}}
+	for _, tr := range []*genodatastruct.Transcript{t1, t2} {
+		tr.Introns = tr.GenerateIntrons()
+	}
+	genes := map[string]*genodatastruct.Gene{"G1": {Chromosome: "chr1", Strand: "+", Coordinate: genodatastruct.Coor{Start: 100, End: 600},
+		Transcripts: []*genodatastruct.Transcript{t1, t2}}}
+	counter := NewEquivalenceClassCounter(genes)
+	for _, read := range []struct {
+		name      string
+		flag      int64
+		pos, next int
+		cigar     string
+		weight    float64
+	}{
+		{"a", 0x41, 110, 320, "80M", 1}, //both, then T1 by its mate
+		{"b", 0x41, 110, 520, "80M", 1}, //both
+		{"c", 0x41, 151, 320, "50M299N51M", 1},
+		{"a", 0x81, 320, 110, "50M", 1},
+		{"b", 0x81, 520, 110, "50M", 1},
+		{"c", 0x81, 320, 151, "50M", 1}, //T1 against T2 for its mate
+		{"d", 0x41, 520, 530, "50M", 1}, //mate left out
+		{"e", 0x41, 110, 320, "80M", 0.5},
+		{"e", 0x41, 520, 530, "50M", 0.5}, //other alignment of the pair
+		{"e", 0x81, 530, 520, "50M", 0.5},
+		{"e", 0x81, 320, 110, "50M", 0.5},
+	} {
+		fields := []string{read.name, strconv.FormatInt(read.flag, 10), "chr1", strconv.Itoa(read.pos), "60", read.cigar, "=", strconv.Itoa(read.next), "0", "*", "*"}
+		mr := NewReadMapTranscriptome(genodatastruct.SamRec{QName: read.name, Flag: read.flag, Chromosome: "chr1", Pos: read.pos, CIGAR: read.cigar, Fields: fields})
+		mr.GeneLoci = []string{"G1"}
+		mr.MapToTran(genes)
+		mr.Weight = read.weight
+		counter.Add(mr)
+	}
+	var b bytes.Buffer
+	if err := WriteEquivalenceClasses(&b, counter.Classes()); err != nil {
+		t.Fatal(err)
+	}
+	want := "class_id\tgene_ids\ttranscripts\tnum_transcripts\treads\n" +
+		"EC1\tG1\tT1\t1\t1.5\n" +
+		"EC2\tG1\tT1,T2\t2\t2.5\n"
+	if b.String() != want || counter.Unassigned != 1 {
+		t.Errorf("classes\n%s\nwant\n%s\nunassigned %v, want 1", b.String(), want, counter.Unassigned)
+	}
+}
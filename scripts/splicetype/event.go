@@ -0,0 +1,304 @@
+package splicetype
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//Event is a splicing event of a gene. Coordinate is the alternative region:
+//skipped exons, included intron, cryptic exon or the truncated/extended part
+//of an exon. Inclusion counts the reads supporting the region and Exclusion
+//counts the reads splicing it out
+type Event struct {
+	ID                 string
+	Type               string
+	GeneID             string
+	GeneName           string
+	Chromosome         string
+	Strand             string
+	Coordinate         genodatastruct.Coor
+	InclusionJunctions []genodatastruct.Coor //none if the inclusion is counted by reads on the region
+	ExclusionJunctions []genodatastruct.Coor
+	Reads              float64 //reads classified to the event, multimappers by their weight
+	Inclusion          float64
+	Exclusion          float64
+	Strength           *SiteStrength //nil unless scored from the genome
+}
+
+//EventID is stable across samples as it is built from the annotation and
+//coordinates only: geneID:type:chromosome:start-end:strand
+func EventID(geneID, eventType, chromosome string, region genodatastruct.Coor, strand string) string {
+	return fmt.Sprintf("%s:%s:%s:%d-%d:%s", geneID, eventType, chromosome, region.Start, region.End, strand)
+}
+
+//CountIn counts the inclusion and exclusion reads of the event in the junctions
+//of a sample. Events without inclusion junctions count the reads classified to
+//them as inclusion
+func (e *Event) CountIn(jc *JunctionCounter, reads float64) (inclusion, exclusion float64) {
+	inclusion = reads
+	if len(e.InclusionJunctions) > 0 {
+		inclusion = 0
+		for _, intron := range e.InclusionJunctions {
+			inclusion += jc.Count(e.Chromosome, e.Strand, intron)
+		}
+	}
+	for _, intron := range e.ExclusionJunctions {
+		exclusion += jc.Count(e.Chromosome, e.Strand, intron)
+	}
+	return inclusion, exclusion
+}
+
+//Total reads informative for the event
+func (e *Event) Total() float64 {
+	return e.Inclusion + e.Exclusion
+}
+
+func newEvent(gene *genodatastruct.Gene, geneID, eventType, chromosome, strand string, region genodatastruct.Coor) *Event {
+	return &Event{
+		ID:         EventID(geneID, eventType, chromosome, region, strand),
+		Type:       eventType,
+		GeneID:     geneID,
+		GeneName:   gene.GeneName,
+		Chromosome: chromosome,
+		Strand:     strand,
+		Coordinate: region,
+	}
+}
+
+//skippingEvent is the skipping of the exons between the a-th and b-th exon
+//of the transcript, with the junctions of the inclusion isoform
+func skippingEvent(gene *genodatastruct.Gene, geneID string, t *genodatastruct.Transcript, a, b int, chromosome, strand string) (*Event, []genodatastruct.Coor) {
+	skipped := genodatastruct.MergeRegions(append([]genodatastruct.Coor{}, t.Exons[a+1:b]...))
+	region := genodatastruct.Coor{Start: skipped[0].Start, End: skipped[len(skipped)-1].End}
+	inclusion := []genodatastruct.Coor{}
+	for k := a; k < b; k++ {
+		inclusion = append(inclusion, gap(t.Exons[k], t.Exons[k+1]))
+	}
+	return newEvent(gene, geneID, "exonSkipping", chromosome, strand, region), inclusion
+}
+
+//addCoor appends the region if the set does not have it
+func addCoor(set []genodatastruct.Coor, regions ...genodatastruct.Coor) []genodatastruct.Coor {
+	for _, reg := range regions {
+		has := false
+		for _, c := range set {
+			if c == reg {
+				has = true
+				break
+			}
+		}
+		if !has {
+			set = append(set, reg)
+		}
+	}
+	return set
+}
+
+//Events of the read against the transcripts agreeing with its class.
+//Counts are left empty, see EventTable
+func (mr *ReadMapTranscriptome) Events(genes map[string]*genodatastruct.Gene) []*Event {
+	found := map[string]*Event{}
+	record := func(e *Event, inclusion, exclusion []genodatastruct.Coor) {
+		if _, ok := found[e.ID]; !ok {
+			found[e.ID] = e
+		}
+		found[e.ID].InclusionJunctions = addCoor(found[e.ID].InclusionJunctions, inclusion...)
+		found[e.ID].ExclusionJunctions = addCoor(found[e.ID].ExclusionJunctions, exclusion...)
+	}
+	for _, trancoors := range mr.MapTran {
+		if len(trancoors) == 0 {
+			continue
+		}
+		geneid := trancoors[0].GeneID
+		gene := genes[geneid]
+		t := gene.Transcript(trancoors[0].TranscriptName)
+		tag, shifts := classifyTran(mr.Segment, trancoors, t)
+		if tag != mr.Class {
+			continue
+		}
+		switch tag {
+		case "exonSkipping":
+			for i := 0; i < len(trancoors)-1; i++ {
+				a, b := trancoors[i].ExonID[0], trancoors[i+1].ExonID[0]
+				if b-a <= 1 {
+					continue
+				}
+				e, inclusion := skippingEvent(gene, geneid, t, a, b, mr.Chromosome, mr.Strand)
+				record(e, inclusion, []genodatastruct.Coor{gap(mr.Segment[i], mr.Segment[i+1])})
+			}
+		case "intronInclusion":
+			for _, tc := range trancoors {
+				for _, id := range tc.IntronID {
+					intron := t.Introns[id]
+					record(newEvent(gene, geneid, tag, mr.Chromosome, mr.Strand, intron), nil, []genodatastruct.Coor{intron})
+				}
+			}
+		case "crypticExon":
+			for _, i := range crypticSegments(trancoors) {
+				seg := mr.Segment[i]
+				inclusion := []genodatastruct.Coor{gap(mr.Segment[i-1], seg), gap(seg, mr.Segment[i+1])}
+				host := t.Introns[trancoors[i].IntronID[0]]
+				e := newEvent(gene, geneid, tag, mr.Chromosome, mr.Strand, seg)
+				record(e, inclusion, []genodatastruct.Coor{host})
+			}
+		case "truncExon", "extendExon":
+			for _, s := range shifts {
+				e := newEvent(gene, geneid, s.Type, mr.Chromosome, mr.Strand, s.Region())
+				record(e, []genodatastruct.Coor{s.Junction}, []genodatastruct.Coor{s.Canonical()})
+			}
+		}
+	}
+	result := []*Event{}
+	for _, e := range found {
+		result = append(result, e)
+	}
+	return result
+}
+
+//EventTable aggregates classification results per event and per gene
+type EventTable struct {
+	Genes     map[string]*genodatastruct.Gene
+	Junctions *JunctionCounter
+	//CanonicalOnly drops events with a novel junction of known non-canonical motif
+	CanonicalOnly bool
+	events        map[string]*Event
+	geneReads     map[string]map[string]float64 //gene ID -> splice type -> reads
+}
+
+func NewEventTable(genes map[string]*genodatastruct.Gene, junctions *JunctionCounter) *EventTable {
+	return &EventTable{
+		Genes:     genes,
+		Junctions: junctions,
+		events:    map[string]*Event{},
+		geneReads: map[string]map[string]float64{},
+	}
+}
+
+//Add a classified read to its genes and events
+func (et *EventTable) Add(mr *ReadMapTranscriptome) {
+	if !AnyString(Categories, func(s string) bool { return s == mr.Class }) {
+		return
+	}
+	seen := map[string]bool{}
+	for _, trancoors := range mr.MapTran {
+		if len(trancoors) == 0 || seen[trancoors[0].GeneID] {
+			continue
+		}
+		seen[trancoors[0].GeneID] = true
+		if _, ok := et.geneReads[trancoors[0].GeneID]; !ok {
+			et.geneReads[trancoors[0].GeneID] = map[string]float64{}
+		}
+		et.geneReads[trancoors[0].GeneID][mr.Class] += mr.Weight
+	}
+	for _, e := range mr.Events(et.Genes) {
+		et.addEvent(e, mr.Weight)
+	}
+}
+
+//addEvent merges the event into the table with its classified reads
+func (et *EventTable) addEvent(e *Event, reads float64) {
+	known, ok := et.events[e.ID]
+	if !ok {
+		et.events[e.ID] = e
+		known = e
+	} else {
+		known.InclusionJunctions = addCoor(known.InclusionJunctions, e.InclusionJunctions...)
+		known.ExclusionJunctions = addCoor(known.ExclusionJunctions, e.ExclusionJunctions...)
+	}
+	known.Reads += reads
+}
+
+//Events with at least minReads classified reads, counted and sorted by location
+func (et *EventTable) Events(minReads int) []*Event {
+	var annotated map[Junction]bool
+	if et.CanonicalOnly {
+		annotated = AnnotatedJunctions(et.Genes)
+	}
+	result := []*Event{}
+	for _, e := range et.events {
+		if e.Reads < float64(minReads) {
+			continue
+		}
+		if et.CanonicalOnly && et.nonCanonical(e, annotated) {
+			continue
+		}
+		e.Inclusion, e.Exclusion = e.CountIn(et.Junctions, e.Reads)
+		result = append(result, e)
+	}
+	sortEvents(result)
+	return result
+}
+
+//nonCanonical tells whether a junction of the event is novel and has a
+//known non-canonical motif
+func (et *EventTable) nonCanonical(e *Event, annotated map[Junction]bool) bool {
+	for _, intron := range append(append([]genodatastruct.Coor{}, e.InclusionJunctions...), e.ExclusionJunctions...) {
+		j := Junction{e.Chromosome, e.Strand, intron}
+		if annotated[j] {
+			continue
+		}
+		if canonical, known := et.Junctions.Canonical(j); known && !canonical {
+			return true
+		}
+	}
+	return false
+}
+
+//GeneReads is the number of reads of each splice type in the gene
+func (et *EventTable) GeneReads(geneID string) map[string]float64 {
+	return et.geneReads[geneID]
+}
+
+//WriteEvents writes events as a tab separated table with their PSI, its
+//confidence interval at the given z score and the splice site strengths
+func WriteEvents(w io.Writer, events []*Event, z float64) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "event_id\tgene_id\tgene_name\ttype\tchromosome\tstart\tend\tstrand\tinclusion\texclusion\ttotal\tpsi\tpsi_low\tpsi_high\tdonor_score\tacceptor_score\tref_donor_score\tref_acceptor_score")
+	for _, e := range events {
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t", e.ID, e.GeneID, e.GeneName, e.Type, e.Chromosome,
+			e.Coordinate.Start, e.Coordinate.End, e.Strand, FormatCount(e.Inclusion), FormatCount(e.Exclusion), FormatCount(e.Total()))
+		psi := e.PSI(z)
+		strength := e.Strength
+		if strength == nil {
+			strength = &SiteStrength{math.NaN(), math.NaN(), math.NaN(), math.NaN()}
+		}
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%s\n", FormatRatio(psi.Value), FormatRatio(psi.Low), FormatRatio(psi.High),
+			formatScores(strength.Donor, strength.Acceptor, strength.RefDonor, strength.RefAcceptor))
+	}
+	return bw.Flush()
+}
+
+//WriteGeneSummary writes the reads of each splice type and the number of
+//reported events per gene as a tab separated table
+func (et *EventTable) WriteGeneSummary(w io.Writer, events []*Event) error {
+	nevent := map[string]int{}
+	for _, e := range events {
+		nevent[e.GeneID]++
+	}
+	geneids := []string{}
+	for geneid := range et.geneReads {
+		geneids = append(geneids, geneid)
+	}
+	sort.Strings(geneids)
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, "gene_id\tgene_name")
+	for _, c := range Categories {
+		fmt.Fprintf(bw, "\t%s", c)
+	}
+	fmt.Fprintln(bw, "\ttotal\tevents")
+	for _, geneid := range geneids {
+		fmt.Fprintf(bw, "%s\t%s", geneid, et.Genes[geneid].GeneName)
+		total := 0.0
+		for _, c := range Categories {
+			fmt.Fprintf(bw, "\t%s", FormatCount(et.geneReads[geneid][c]))
+			total += et.geneReads[geneid][c]
+		}
+		fmt.Fprintf(bw, "\t%s\t%d\n", FormatCount(total), nevent[geneid])
+	}
+	return bw.Flush()
+}
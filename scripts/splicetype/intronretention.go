@@ -0,0 +1,304 @@
+package splicetype
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//Warnings of an intron retention measurement
+const (
+	LowCover              = "LowCover"              //intron depth plus splice reads below the minimum
+	LowSplicing           = "LowSplicing"           //few reads splicing at the intron flanks
+	NonUniformIntronCover = "NonUniformIntronCover" //a quarter of the intron much less covered than another
+)
+
+//IntronRetention measures the retention of a gene level intron, the interval
+//of the merged exons of a gene (Gene.IntervalOfExons)
+type IntronRetention struct {
+	GeneID            string
+	GeneName          string
+	Chromosome        string
+	Strand            string
+	Intron            genodatastruct.Coor
+	Transcripts       []string              //transcripts having an intron containing it
+	Measurable        []genodatastruct.Coor //intron without the exons of any gene
+	Depth             float64               //median depth of the measurable bases
+	ExonToIntronLeft  float64               //reads crossing the left exon-intron boundary
+	ExonToIntronRight float64
+	SpliceLeft        float64 //reads splicing at the left boundary of the intron
+	SpliceRight       float64
+	SpliceExact       float64 //reads splicing exactly over the intron
+	Ratio             float64
+	Warnings          []string
+	cover             map[int]float64 //depth changes at the intron positions, nil until a read covers the intron
+}
+
+//addCover adds the weight of a read to the depth of the intron bases of a
+//segment clipped to the intron. Only the depth changes at the segment ends are
+//kept, introns may span megabases
+func (ir *IntronRetention) addCover(seg genodatastruct.Coor, weight float64) {
+	if ir.cover == nil {
+		ir.cover = map[int]float64{}
+	}
+	ir.cover[seg.Start] += weight
+	ir.cover[seg.End+1] -= weight
+}
+
+//Measured bases of the intron
+func (ir *IntronRetention) Measured() int {
+	n := 0
+	for _, reg := range ir.Measurable {
+		n += reg.End - reg.Start + 1
+	}
+	return n
+}
+
+//IRCollector collects intronic coverage and flanking junctions of gene introns
+type IRCollector struct {
+	Genes     map[string]*genodatastruct.Gene
+	Junctions *JunctionCounter
+	introns   map[string][]*IntronRetention //gene ID -> introns
+}
+
+//NewIRCollector prepares the introns of every gene. Measurable regions leave out
+//the exons of all the genes on the chromosome
+func NewIRCollector(genes map[string]*genodatastruct.Gene, junctions *JunctionCounter) *IRCollector {
+	exons := map[string][]genodatastruct.Coor{}
+	for _, g := range genes {
+		exons[g.Chromosome] = append(exons[g.Chromosome], g.MergeExons()...)
+	}
+	for chr := range exons {
+		exons[chr] = genodatastruct.MergeRegions(exons[chr])
+	}
+	c := &IRCollector{Genes: genes, Junctions: junctions, introns: map[string][]*IntronRetention{}}
+	for geneid, g := range genes {
+		for _, intron := range g.IntervalOfExons() {
+			ir := &IntronRetention{
+				GeneID:     geneid,
+				GeneName:   g.GeneName,
+				Chromosome: g.Chromosome,
+				Strand:     g.Strand,
+				Intron:     intron,
+				Measurable: genodatastruct.SubtractRegions(intron, exons[g.Chromosome]),
+			}
+			for _, t := range g.Transcripts {
+				for _, tIntron := range t.Introns {
+					if intron.Inside(tIntron) {
+						ir.Transcripts = append(ir.Transcripts, t.TranscriptName)
+						break
+					}
+				}
+			}
+			c.introns[geneid] = append(c.introns[geneid], ir)
+		}
+	}
+	return c
+}
+
+//Add the intronic coverage of a read to the introns of its genes
+func (c *IRCollector) Add(mr *ReadMapTranscriptome) {
+	for _, geneid := range mr.GeneLoci {
+		g, ok := c.Genes[geneid]
+		if !ok || g.Strand != mr.Strand {
+			continue
+		}
+		for _, ir := range c.introns[geneid] {
+			for _, seg := range mr.Segment {
+				if !seg.Intersect(ir.Intron) {
+					continue
+				}
+				clipped := seg
+				if clipped.Start < ir.Intron.Start {
+					clipped.Start = ir.Intron.Start
+					ir.ExonToIntronLeft += mr.Weight
+				}
+				if clipped.End > ir.Intron.End {
+					clipped.End = ir.Intron.End
+					ir.ExonToIntronRight += mr.Weight
+				}
+				ir.addCover(clipped, mr.Weight)
+			}
+		}
+	}
+}
+
+//depthRun is a stretch of measurable bases with the same depth
+type depthRun struct {
+	length int
+	depth  float64
+}
+
+//depthRuns sweeps the depth changes over the measurable regions
+func (ir *IntronRetention) depthRuns() []depthRun {
+	runs := []depthRun{}
+	add := func(length int, depth float64) {
+		if n := len(runs); n > 0 && runs[n-1].depth == depth {
+			runs[n-1].length += length
+		} else {
+			runs = append(runs, depthRun{length, depth})
+		}
+	}
+	breaks := make([]int, 0, len(ir.cover))
+	for pos := range ir.cover {
+		breaks = append(breaks, pos)
+	}
+	sort.Ints(breaks)
+	k, depth := 0, 0.0
+	for _, reg := range ir.Measurable {
+		for pos := reg.Start; pos <= reg.End; {
+			for ; k < len(breaks) && breaks[k] <= pos; k++ {
+				depth += ir.cover[breaks[k]]
+			}
+			next := reg.End + 1
+			if k < len(breaks) && breaks[k] < next {
+				next = breaks[k]
+			}
+			add(next-pos, depth)
+			pos = next
+		}
+	}
+	return runs
+}
+
+//medianDepth of the runs
+func medianDepth(runs []depthRun) float64 {
+	total := 0
+	for _, r := range runs {
+		total += r.length
+	}
+	if total == 0 {
+		return 0
+	}
+	sorted := append([]depthRun{}, runs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].depth < sorted[j].depth })
+	half, walked := (total+1)/2, 0
+	for _, r := range sorted {
+		walked += r.length
+		if walked >= half {
+			return r.depth
+		}
+	}
+	return sorted[len(sorted)-1].depth
+}
+
+//quarterDepths are the mean depths of the four quarters of the measurable bases
+func quarterDepths(runs []depthRun) [4]float64 {
+	total := 0
+	for _, r := range runs {
+		total += r.length
+	}
+	var means [4]float64
+	for q := range means {
+		from, to := q*total/4, (q+1)*total/4
+		if to <= from {
+			continue
+		}
+		sum, walked := 0.0, 0
+		for _, r := range runs {
+			//overlap of the run with the quarter
+			lo, hi := walked, walked+r.length
+			if lo < from {
+				lo = from
+			}
+			if hi > to {
+				hi = to
+			}
+			if hi > lo {
+				sum += float64(hi-lo) * r.depth
+			}
+			walked += r.length
+		}
+		means[q] = sum / float64(to-from)
+	}
+	return means
+}
+
+//Report computes depth, flanking junctions, IR ratio and warnings of the
+//introns with any intronic or splice read
+func (c *IRCollector) Report(minCover int) []*IntronRetention {
+	type site struct {
+		Chromosome, Strand string
+		Pos                int
+	}
+	left, right := map[site]float64{}, map[site]float64{}
+	for j, n := range c.Junctions.Counts {
+		left[site{j.Chromosome, j.Strand, j.Intron.Start}] += n
+		right[site{j.Chromosome, j.Strand, j.Intron.End}] += n
+	}
+	result := []*IntronRetention{}
+	for _, introns := range c.introns {
+		for _, ir := range introns {
+			ir.SpliceLeft = left[site{ir.Chromosome, ir.Strand, ir.Intron.Start}]
+			ir.SpliceRight = right[site{ir.Chromosome, ir.Strand, ir.Intron.End}]
+			ir.SpliceExact = c.Junctions.Count(ir.Chromosome, ir.Strand, ir.Intron)
+			if ir.cover == nil && ir.SpliceLeft+ir.SpliceRight == 0 {
+				continue
+			}
+			runs := ir.depthRuns()
+			ir.Depth = medianDepth(runs)
+			splice := ir.SpliceLeft
+			if ir.SpliceRight > splice {
+				splice = ir.SpliceRight
+			}
+			ir.Ratio = 0
+			if ir.Depth+splice > 0 {
+				ir.Ratio = ir.Depth / (ir.Depth + splice)
+			}
+			ir.Warnings = nil
+			if ir.Depth+splice < float64(minCover) {
+				ir.Warnings = append(ir.Warnings, LowCover)
+			}
+			if splice < 4 {
+				ir.Warnings = append(ir.Warnings, LowSplicing)
+			}
+			if ir.Measured() >= 4 {
+				q := quarterDepths(runs)
+				lo, hi := q[0], q[0]
+				for _, d := range q {
+					if d < lo {
+						lo = d
+					}
+					if d > hi {
+						hi = d
+					}
+				}
+				if hi >= 1 && lo < hi/2 {
+					ir.Warnings = append(ir.Warnings, NonUniformIntronCover)
+				}
+			}
+			result = append(result, ir)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Chromosome != result[j].Chromosome {
+			return result[i].Chromosome < result[j].Chromosome
+		}
+		return result[i].Intron.Start < result[j].Intron.Start
+	})
+	return result
+}
+
+//WriteIntronRetention writes the intron retention report as a tab separated table
+func WriteIntronRetention(w io.Writer, introns []*IntronRetention) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "gene_id\tgene_name\tchromosome\tstart\tend\tstrand\ttranscripts\tmeasured_bases\tintron_depth\texon_to_intron_left\texon_to_intron_right\tsplice_left\tsplice_right\tsplice_exact\tir_ratio\twarnings")
+	for _, ir := range introns {
+		transcripts, warnings := strings.Join(ir.Transcripts, ","), strings.Join(ir.Warnings, ",")
+		if transcripts == "" {
+			transcripts = "-"
+		}
+		if warnings == "" {
+			warnings = "-"
+		}
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%d\t%d\t%s\t%s\t%d\t%g\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", ir.GeneID, ir.GeneName, ir.Chromosome,
+			ir.Intron.Start, ir.Intron.End, ir.Strand, transcripts, ir.Measured(), ir.Depth, FormatCount(ir.ExonToIntronLeft),
+			FormatCount(ir.ExonToIntronRight), FormatCount(ir.SpliceLeft), FormatCount(ir.SpliceRight), FormatCount(ir.SpliceExact),
+			FormatRatio(ir.Ratio), warnings)
+	}
+	return bw.Flush()
+}
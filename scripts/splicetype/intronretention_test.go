@@ -0,0 +1,66 @@
+package splicetype
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestIntronDepth(t *testing.T) {
+	//the bases 121-150 are exonic in another gene
+	ir := &IntronRetention{Intron: genodatastruct.Coor{Start: 101, End: 200},
+		Measurable: []genodatastruct.Coor{{Start: 101, End: 120}, {Start: 151, End: 200}}}
+	if runs := ir.depthRuns(); len(runs) != 1 || runs[0] != (depthRun{70, 0}) {
+		t.Errorf("runs of an uncovered intron %v, want 70 bases of depth 0", runs)
+	}
+	ir.addCover(genodatastruct.Coor{Start: 111, End: 160}, 1)
+	ir.addCover(genodatastruct.Coor{Start: 121, End: 130}, 0.5)
+	ir.addCover(genodatastruct.Coor{Start: 141, End: 200}, 2)
+	runs := ir.depthRuns()
+	want := []depthRun{{10, 0}, {10, 1}, {10, 3}, {40, 2}}
+	if len(runs) != len(want) {
+		t.Fatalf("runs %v, want %v", runs, want)
+	}
+	for i := range want {
+		if runs[i] != want[i] {
+			t.Errorf("runs %v, want %v", runs, want)
+			break
+		}
+	}
+	if d := medianDepth(runs); d != 2 {
+		t.Errorf("median depth %v, want 2", d)
+	}
+	//quarters of 17, 18, 17 and 18 bases
+	q := quarterDepths(runs)
+	for i, w := range [4]float64{7.0 / 17, 43.0 / 18, 2, 2} {
+		if math.Abs(q[i]-w) > 1e-9 {
+			t.Errorf("quarter depths %v, want %v in quarter %d", q, w, i+1)
+		}
+	}
+
+	for _, test := range []struct {
+		runs []depthRun
+		want float64
+	}{
+		{nil, 0},
+		{[]depthRun{{1, 5}, {2, 1}}, 1},
+		{[]depthRun{{2, 5}, {1, 1}}, 5},
+		{[]depthRun{{1, 3}, {1, 1}}, 1}, //lower of the two middle bases
+	} {
+		if got := medianDepth(test.runs); got != test.want {
+			t.Errorf("median depth of %v: %v, want %v", test.runs, got, test.want)
+		}
+	}
+	if q := quarterDepths([]depthRun{{2, 1}}); q != [4]float64{0, 1, 0, 1} {
+		t.Errorf("quarter depths of 2 bases %v, want the empty quarters 0", q)
+	}
+
+	//a read in a megabase intron keeps two depth changes
+	long := &IntronRetention{Intron: genodatastruct.Coor{Start: 1000001, End: 3000000},
+		Measurable: []genodatastruct.Coor{{Start: 1000001, End: 3000000}}}
+	long.addCover(genodatastruct.Coor{Start: 2000001, End: 2000100}, 1)
+	if runs := long.depthRuns(); len(long.cover) != 2 || len(runs) != 3 || runs[0] != (depthRun{1000000, 0}) || runs[1] != (depthRun{100, 1}) || runs[2] != (depthRun{999900, 0}) {
+		t.Errorf("%d depth changes, runs %v of a read in a megabase intron", len(long.cover), runs)
+	}
+}
@@ -0,0 +1,301 @@
+package splicetype
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+	"github.com/Hanbin/AberrantSplice/Internal/splicestats"
+)
+
+//IsoformUsage is the isoform fraction of a transcript in two groups of samples
+type IsoformUsage struct {
+	TranscriptRef
+	GeneName  string
+	Fractions []float64  //isoform fraction per sample, NaN for a sample without reads of the gene
+	Reads     []float64  //reads of the transcript per sample
+	IF        [2]float64 //mean isoform fraction of the informative samples of each group
+	DeltaIF   float64    //second group minus first group
+	Stat      float64
+	P, Q      float64
+}
+
+//TestIsoformUsage tests the change of the isoform fractions of the
+//transcripts of multi-isoform genes between the samples of group 0 and
+//group 1 (group -1 samples are left out). The abundances of the samples
+//are the EstimateAbundance results over the same genes. The isoform
+//fraction, the share of the TPM of the gene, is tested as it is reported:
+//each sample counts IsoformFraction of the reads of the gene out of these
+//reads, by the beta-binomial likelihood ratio test of TestEvents. Samples
+//with less than minSampleReads reads of the gene are not informative.
+//Q-values are Benjamini-Hochberg adjusted over the tested transcripts
+func TestIsoformUsage(abundances [][]*TranscriptAbundance, group []int, minSampleReads float64) []*IsoformUsage {
+	results := []*IsoformUsage{}
+	if len(abundances) == 0 {
+		return results
+	}
+	pvalues := []float64{}
+	for start, end := 0, 0; start < len(abundances[0]); start = end {
+		geneID := abundances[0][start].GeneID
+		for end = start; end < len(abundances[0]) && abundances[0][end].GeneID == geneID; end++ {
+		}
+		if end-start < 2 {
+			continue
+		}
+		geneReads := make([]float64, len(abundances))
+		for s, sample := range abundances {
+			for _, ta := range sample[start:end] {
+				geneReads[s] += ta.Reads
+			}
+		}
+		for i := start; i < end; i++ {
+			u := &IsoformUsage{TranscriptRef: abundances[0][i].TranscriptRef, GeneName: abundances[0][i].GeneName}
+			var grouped [2][]splicestats.Counts
+			var ifSum [2]float64
+			var informative [2]int
+			for s, sample := range abundances {
+				ta := sample[i]
+				u.Fractions = append(u.Fractions, ta.IsoformFraction)
+				u.Reads = append(u.Reads, ta.Reads)
+				if group[s] < 0 {
+					continue
+				}
+				if geneReads[s] < minSampleReads || geneReads[s] <= 0 || math.IsNaN(ta.IsoformFraction) {
+					grouped[group[s]] = append(grouped[group[s]], splicestats.Counts{})
+					continue
+				}
+				grouped[group[s]] = append(grouped[group[s]], splicestats.Counts{K: ta.IsoformFraction * geneReads[s], N: geneReads[s]})
+				ifSum[group[s]] += ta.IsoformFraction
+				informative[group[s]]++
+			}
+			for g := range u.IF {
+				u.IF[g] = math.NaN()
+				if informative[g] > 0 {
+					u.IF[g] = ifSum[g] / float64(informative[g])
+				}
+			}
+			u.DeltaIF = u.IF[1] - u.IF[0]
+			u.Stat, u.P = splicestats.BetaBinomialTest(grouped[0], grouped[1])
+			results = append(results, u)
+			pvalues = append(pvalues, u.P)
+		}
+	}
+	for i, q := range splicestats.BenjaminiHochberg(pvalues) {
+		results[i].Q = q
+	}
+	return results
+}
+
+//IsoformSwitch is a gene whose dominant isoform, the one of the highest mean
+//isoform fraction, differs between the groups
+type IsoformSwitch struct {
+	GeneID, GeneName string
+	Down, Up         *IsoformUsage //dominant isoform of the first group and of the second group
+	Q                float64       //larger q-value of the two isoforms
+	Differences      []IsoformDifference
+}
+
+//IsoformSwitches finds the genes switching their dominant isoform in the
+//tested isoform usages, annotated by the differences of the two isoforms.
+//Both isoforms must change significantly, with a q-value up to maxQ, and by
+//at least minDeltaIF, the dominant isoform of the first group going down and
+//that of the second group going up
+func IsoformSwitches(usages []*IsoformUsage, genes map[string]*genodatastruct.Gene, maxQ, minDeltaIF float64) []*IsoformSwitch {
+	switches := []*IsoformSwitch{}
+	for start, end := 0, 0; start < len(usages); start = end {
+		geneID := usages[start].GeneID
+		for end = start; end < len(usages) && usages[end].GeneID == geneID; end++ {
+		}
+		var dominant [2]*IsoformUsage
+		for _, u := range usages[start:end] {
+			for g := range dominant {
+				if !math.IsNaN(u.IF[g]) && (dominant[g] == nil || u.IF[g] > dominant[g].IF[g]) {
+					dominant[g] = u
+				}
+			}
+		}
+		if dominant[0] == nil || dominant[1] == nil || dominant[0] == dominant[1] {
+			continue
+		}
+		down, up := dominant[0], dominant[1]
+		if !(down.Q <= maxQ && up.Q <= maxQ && -down.DeltaIF >= minDeltaIF && up.DeltaIF >= minDeltaIF) {
+			continue
+		}
+		sw := &IsoformSwitch{GeneID: geneID, GeneName: usages[start].GeneName, Down: down, Up: up, Q: math.Max(down.Q, up.Q)}
+		if gene, ok := genes[geneID]; ok {
+			down, up := gene.Transcript(sw.Down.TranscriptName), gene.Transcript(sw.Up.TranscriptName)
+			if down != nil && up != nil {
+				sw.Differences = CompareIsoforms(down, up)
+			}
+		}
+		switches = append(switches, sw)
+	}
+	return switches
+}
+
+//Types of the differences between two isoforms
+const (
+	AlternativeStart    = "alternativeStart"    //first exons apart, the region is the first exon of the isoform
+	AlternativeEnd      = "alternativeEnd"      //last exons apart, the region is the last exon of the isoform
+	AlternativeDonor    = "alternativeDonor"    //the region is the exon extension of the isoform up to its donor
+	AlternativeAcceptor = "alternativeAcceptor" //the region is the exon extension of the isoform from its acceptor
+)
+
+//IsoformDifference is a splice event distinguishing two isoforms: the
+//isoform skips an exon of the other one (exonSkipping), retains an intron of
+//the other one (intronInclusion), has another splice site or another end
+type IsoformDifference struct {
+	Type           string
+	Region         genodatastruct.Coor
+	TranscriptName string //isoform showing the event
+}
+
+func (d IsoformDifference) String() string {
+	return fmt.Sprintf("%s:%d-%d:%s", d.Type, d.Region.Start, d.Region.End, d.TranscriptName)
+}
+
+//CompareIsoforms lists the skipped exons, retained introns, alternative
+//splice sites and alternative ends between two transcripts of a gene, sorted
+//by location
+func CompareIsoforms(a, b *genodatastruct.Transcript) []IsoformDifference {
+	diffs := []IsoformDifference{}
+	sorted := func(t *genodatastruct.Transcript) []genodatastruct.Coor {
+		exons := append([]genodatastruct.Coor{}, t.Exons...)
+		sort.Slice(exons, func(i, j int) bool { return exons[i].Start < exons[j].Start })
+		return exons
+	}
+	exons := [2][]genodatastruct.Coor{sorted(a), sorted(b)}
+	names := [2]string{a.TranscriptName, b.TranscriptName}
+	if len(exons[0]) == 0 || len(exons[1]) == 0 {
+		return diffs
+	}
+	forward := a.Strand != "-"
+	for x := 0; x < 2; x++ {
+		y := 1 - x
+		span := genodatastruct.Coor{Start: exons[x][0].Start, End: exons[x][len(exons[x])-1].End}
+		//exons of the other isoform within an intron of this one
+		for i, exon := range exons[y] {
+			if i == 0 || i == len(exons[y])-1 || !exon.Inside(span) || overlapsAny(exon, exons[x]) {
+				continue
+			}
+			diffs = append(diffs, IsoformDifference{"exonSkipping", exon, names[x]})
+		}
+		//introns of the other isoform within an exon of this one
+		for _, intron := range genodatastruct.IntervalRegions(exons[y]) {
+			for _, exon := range exons[x] {
+				if exon.Start < intron.Start && exon.End > intron.End {
+					diffs = append(diffs, IsoformDifference{"intronInclusion", intron, names[x]})
+					break
+				}
+			}
+		}
+		//the splice sites of exons overlapping a single exon of the other isoform,
+		//the extension is reported for the isoform of the longer exon
+		for i, exon := range exons[x] {
+			j := singleOverlap(exon, exons[y])
+			if j < 0 || singleOverlap(exons[y][j], exons[x]) != i {
+				continue
+			}
+			other := exons[y][j]
+			if i > 0 && j > 0 && exon.Start < other.Start {
+				site := AlternativeAcceptor
+				if !forward {
+					site = AlternativeDonor
+				}
+				diffs = append(diffs, IsoformDifference{site, genodatastruct.Coor{Start: exon.Start, End: other.Start - 1}, names[x]})
+			}
+			if i < len(exons[x])-1 && j < len(exons[y])-1 && exon.End > other.End {
+				site := AlternativeDonor
+				if !forward {
+					site = AlternativeAcceptor
+				}
+				diffs = append(diffs, IsoformDifference{site, genodatastruct.Coor{Start: other.End + 1, End: exon.End}, names[x]})
+			}
+		}
+	}
+	//first and last exons apart, by the strand of the transcripts
+	first, last := [2]genodatastruct.Coor{exons[0][0], exons[1][0]}, [2]genodatastruct.Coor{exons[0][len(exons[0])-1], exons[1][len(exons[1])-1]}
+	start, end := AlternativeStart, AlternativeEnd
+	if !forward {
+		start, end = end, start
+	}
+	for x := 0; x < 2; x++ {
+		if !first[0].Intersect(first[1]) {
+			diffs = append(diffs, IsoformDifference{start, first[x], names[x]})
+		}
+		if !last[0].Intersect(last[1]) {
+			diffs = append(diffs, IsoformDifference{end, last[x], names[x]})
+		}
+	}
+	sort.SliceStable(diffs, func(i, j int) bool {
+		if diffs[i].Region.Start != diffs[j].Region.Start {
+			return diffs[i].Region.Start < diffs[j].Region.Start
+		}
+		return diffs[i].Region.End < diffs[j].Region.End
+	})
+	return diffs
+}
+
+func overlapsAny(region genodatastruct.Coor, exons []genodatastruct.Coor) bool {
+	for _, exon := range exons {
+		if exon.Intersect(region) {
+			return true
+		}
+	}
+	return false
+}
+
+//singleOverlap is the index of the only exon overlapping the region, -1 for
+//none or several
+func singleOverlap(region genodatastruct.Coor, exons []genodatastruct.Coor) int {
+	found := -1
+	for i, exon := range exons {
+		if exon.Intersect(region) {
+			if found >= 0 {
+				return -1
+			}
+			found = i
+		}
+	}
+	return found
+}
+
+//WriteIsoformUsage writes the isoform usages with the isoform fraction of
+//every sample
+func WriteIsoformUsage(w io.Writer, usages []*IsoformUsage, samples []string, groups [2]string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "gene_id\tgene_name\ttranscript\tif_%s\tif_%s\tdelta_if\tp_value\tq_value", groups[0], groups[1])
+	for _, s := range samples {
+		fmt.Fprintf(bw, "\t%s", s)
+	}
+	fmt.Fprintln(bw)
+	for _, u := range usages {
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s", u.GeneID, u.GeneName, u.TranscriptName,
+			FormatRatio(u.IF[0]), FormatRatio(u.IF[1]), FormatRatio(u.DeltaIF), formatPValue(u.P), formatPValue(u.Q))
+		for _, f := range u.Fractions {
+			fmt.Fprintf(bw, "\t%s", FormatRatio(f))
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
+
+//WriteIsoformSwitches writes the switching genes with the differences of
+//their dominant isoforms as type:start-end:transcript
+func WriteIsoformSwitches(w io.Writer, switches []*IsoformSwitch, groups [2]string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "gene_id\tgene_name\tisoform_%s\tisoform_%s\tdelta_if_down\tdelta_if_up\tq_value\tdifferences\n", groups[0], groups[1])
+	for _, sw := range switches {
+		diffs := []string{}
+		for _, d := range sw.Differences {
+			diffs = append(diffs, d.String())
+		}
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", sw.GeneID, sw.GeneName, sw.Down.TranscriptName, sw.Up.TranscriptName,
+			FormatRatio(sw.Down.DeltaIF), FormatRatio(sw.Up.DeltaIF), formatPValue(sw.Q), orDot(strings.Join(diffs, ",")))
+	}
+	return bw.Flush()
+}
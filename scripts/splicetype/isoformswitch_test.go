@@ -0,0 +1,97 @@
+package splicetype
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestCompareIsoforms(t *testing.T) {
+	transcript := func(name string, exons ...genodatastruct.Coor) *genodatastruct.Transcript {
+		return &genodatastruct.Transcript{TranscriptName: name, Strand: "+", Exons: exons}
+	}
+	a := transcript("A", genodatastruct.Coor{Start: 100, End: 200}, genodatastruct.Coor{Start: 300, End: 400}, genodatastruct.Coor{Start: 500, End: 600}, genodatastruct.Coor{Start: 700, End: 800})
+	tests := []struct {
+		other *genodatastruct.Transcript
+		want  []string
+	}{
+		//skips 300-400 and splices 500-620 to 700
+		{transcript("B", genodatastruct.Coor{Start: 100, End: 200}, genodatastruct.Coor{Start: 500, End: 620}, genodatastruct.Coor{Start: 700, End: 800}),
+			[]string{"exonSkipping:300-400:B", "alternativeDonor:601-620:B"}},
+		//keeps the intron 201-299
+		{transcript("C", genodatastruct.Coor{Start: 100, End: 400}, genodatastruct.Coor{Start: 500, End: 600}, genodatastruct.Coor{Start: 700, End: 800}),
+			[]string{"intronInclusion:201-299:C"}},
+		//ends in another last exon
+		{transcript("D", genodatastruct.Coor{Start: 100, End: 200}, genodatastruct.Coor{Start: 300, End: 400}, genodatastruct.Coor{Start: 900, End: 1000}),
+			[]string{"exonSkipping:500-600:D", "alternativeEnd:700-800:A", "alternativeEnd:900-1000:D"}},
+	}
+	for _, test := range tests {
+		got := []string{}
+		for _, d := range CompareIsoforms(a, test.other) {
+			got = append(got, d.String())
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("A against %s: %v, want %v", test.other.TranscriptName, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("A against %s: %v, want %v", test.other.TranscriptName, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestIsoformSwitches(t *testing.T) {
+	genes := map[string]*genodatastruct.Gene{"G1": {Transcripts: []*genodatastruct.Transcript{
+		{TranscriptName: "T1", Strand: "+", Exons: []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 300, End: 400}, {Start: 500, End: 600}}},
+		{TranscriptName: "T2", Strand: "+", Exons: []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 500, End: 600}}},
+	}}}
+	//T1 dominates the first group and T2 the second one, G2 has a single
+	//isoform. T4 and T5 of G3 keep even reads but change their fractions, as
+	//isoforms of different lengths would
+	sample := func(t1, t2, if4 float64) []*TranscriptAbundance {
+		return []*TranscriptAbundance{
+			{TranscriptRef: TranscriptRef{"G1", "T1"}, Reads: t1, IsoformFraction: t1 / (t1 + t2)},
+			{TranscriptRef: TranscriptRef{"G1", "T2"}, Reads: t2, IsoformFraction: t2 / (t1 + t2)},
+			{TranscriptRef: TranscriptRef{"G2", "T3"}, Reads: 50, IsoformFraction: 1},
+			{TranscriptRef: TranscriptRef{"G3", "T4"}, Reads: 50, IsoformFraction: if4},
+			{TranscriptRef: TranscriptRef{"G3", "T5"}, Reads: 50, IsoformFraction: 1 - if4},
+		}
+	}
+	abundances := [][]*TranscriptAbundance{sample(90, 10, 0.9), sample(80, 20, 0.8), sample(10, 90, 0.1), sample(20, 80, 0.2), sample(0, 0, math.NaN())}
+	usages := TestIsoformUsage(abundances, []int{0, 0, 1, 1, 1}, 1)
+	if len(usages) != 4 {
+		t.Fatalf("%d isoforms tested, want 4", len(usages))
+	}
+	if math.Abs(usages[0].IF[0]-0.85) > 1e-9 || math.Abs(usages[0].DeltaIF+0.7) > 1e-9 || !(usages[0].Q < 0.05) {
+		t.Errorf("T1: IF %v delta %v q %v", usages[0].IF, usages[0].DeltaIF, usages[0].Q)
+	}
+	//the fractions are tested, not the read shares
+	if math.Abs(usages[2].DeltaIF+0.7) > 1e-9 || !(usages[2].Q < 0.05) || math.Abs(usages[2].Q-usages[0].Q) > 1e-9 {
+		t.Errorf("T4: IF %v delta %v q %v, want the q %v of T1", usages[2].IF, usages[2].DeltaIF, usages[2].Q, usages[0].Q)
+	}
+	switches := IsoformSwitches(usages, genes, 0.05, 0.1)
+	if len(switches) != 2 {
+		t.Fatalf("%d switches, want 2", len(switches))
+	}
+	sw := switches[0]
+	if sw.Down.TranscriptName != "T1" || sw.Up.TranscriptName != "T2" || !(sw.Q < 0.05) {
+		t.Errorf("switch %s to %s q %v", sw.Down.TranscriptName, sw.Up.TranscriptName, sw.Q)
+	}
+	if len(sw.Differences) != 1 || sw.Differences[0].String() != "exonSkipping:300-400:T2" {
+		t.Errorf("differences %v", sw.Differences)
+	}
+	if switches[1].GeneID != "G3" || switches[1].Differences != nil {
+		t.Errorf("switch of %s with differences %v, want G3 without annotation", switches[1].GeneID, switches[1].Differences)
+	}
+	//changes below the thresholds are not switches
+	if n := len(IsoformSwitches(usages, genes, 0.05, 0.8)); n != 0 {
+		t.Errorf("%d switches changing by 0.8, want 0", n)
+	}
+	if n := len(IsoformSwitches(usages, genes, 1e-12, 0.1)); n != 0 {
+		t.Errorf("%d switches at q 1e-12, want 0", n)
+	}
+}
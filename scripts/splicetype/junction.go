@@ -0,0 +1,178 @@
+package splicetype
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//Junction is a splice junction observed from the N operation of
+//split reads. Intron is the skipped region of the reference
+type Junction struct {
+	Chromosome string
+	Strand     string
+	Intron     genodatastruct.Coor
+}
+
+//Junctions of a read are the gaps between its segments, reported
+//in ascending genomic order regardless of the read strand
+func (mr *ReadMapTranscriptome) Junctions() []genodatastruct.Coor {
+	return genodatastruct.IntervalRegions(mr.sortedSegments())
+}
+
+//sortedSegments are the segments in ascending genomic order
+func (mr *ReadMapTranscriptome) sortedSegments() []genodatastruct.Coor {
+	segs := make([]genodatastruct.Coor, len(mr.Segment))
+	copy(segs, mr.Segment)
+	genodatastruct.SortCoors(segs, true)
+	return segs
+}
+
+//JunctionStat is the read support of a junction
+type JunctionStat struct {
+	Unique      int //reads aligned once (NH=1)
+	Multi       int //reads with multiple alignments
+	MaxOverhang int //the largest shorter anchor among the reads
+	MaxLeft     int //longest anchor on the left of the junction
+	MaxRight    int //longest anchor on the right
+}
+
+//JunctionCounter tallies the reads spanning each junction
+type JunctionCounter struct {
+	Counts map[Junction]float64 //reads, multimappers by their weight
+	Stats  map[Junction]*JunctionStat
+	Motifs map[Junction]int //STAR motif codes of the junctions with known sequence
+}
+
+func NewJunctionCounter() *JunctionCounter {
+	return &JunctionCounter{Counts: map[Junction]float64{}, Stats: map[Junction]*JunctionStat{}, Motifs: map[Junction]int{}}
+}
+
+//Add counts every junction of a read
+func (jc *JunctionCounter) Add(mr *ReadMapTranscriptome) {
+	if len(mr.Segment) < 2 {
+		return
+	}
+	segs := mr.sortedSegments()
+	for i, intron := range genodatastruct.IntervalRegions(segs) {
+		j := Junction{mr.Chromosome, mr.Strand, intron}
+		jc.Counts[j] += mr.Weight
+		stat, ok := jc.Stats[j]
+		if !ok {
+			stat = &JunctionStat{}
+			jc.Stats[j] = stat
+		}
+		if mr.NH > 1 {
+			stat.Multi++
+		} else {
+			stat.Unique++
+		}
+		left, right := segs[i].End-segs[i].Start+1, segs[i+1].End-segs[i+1].Start+1
+		overhang := left
+		if right < overhang {
+			overhang = right
+		}
+		if overhang > stat.MaxOverhang {
+			stat.MaxOverhang = overhang
+		}
+		if left > stat.MaxLeft {
+			stat.MaxLeft = left
+		}
+		if right > stat.MaxRight {
+			stat.MaxRight = right
+		}
+	}
+}
+
+//Count of reads spanning the intron
+func (jc *JunctionCounter) Count(chromosome, strand string, intron genodatastruct.Coor) float64 {
+	return jc.Counts[Junction{chromosome, strand, intron}]
+}
+
+//Sorted junctions by chromosome, start and end
+func (jc *JunctionCounter) Sorted() []Junction {
+	result := []Junction{}
+	for j := range jc.Counts {
+		result = append(result, j)
+	}
+	sort.Slice(result, func(a, b int) bool {
+		if result[a].Chromosome != result[b].Chromosome {
+			return result[a].Chromosome < result[b].Chromosome
+		}
+		if result[a].Intron.Start != result[b].Intron.Start {
+			return result[a].Intron.Start < result[b].Intron.Start
+		}
+		if result[a].Intron.End != result[b].Intron.End {
+			return result[a].Intron.End < result[b].Intron.End
+		}
+		return result[a].Strand < result[b].Strand
+	})
+	return result
+}
+
+//AnnotatedJunctions are the introns of all the transcripts
+func AnnotatedJunctions(genes map[string]*genodatastruct.Gene) map[Junction]bool {
+	annotated := map[Junction]bool{}
+	for _, g := range genes {
+		for _, t := range g.Transcripts {
+			for _, intron := range t.Introns {
+				annotated[Junction{t.Chromosome, t.Strand, intron}] = true
+			}
+		}
+	}
+	return annotated
+}
+
+//starStrand codes the strand as STAR does: 0 undefined, 1 +, 2 -
+func starStrand(strand string) int {
+	switch strand {
+	case "+":
+		return 1
+	case "-":
+		return 2
+	}
+	return 0
+}
+
+//WriteSJTab writes the junctions in the format of STAR SJ.out.tab: chromosome,
+//first and last base of the intron, strand, motif, annotated, unique reads,
+//multi-mapping reads and maximum overhang. The motif is 0 (non-canonical)
+//unless annotated from the genome, an undefined strand is taken from it
+func (jc *JunctionCounter) WriteSJTab(w io.Writer, annotated map[Junction]bool) error {
+	bw := bufio.NewWriter(w)
+	for _, j := range jc.Sorted() {
+		stat := jc.Stats[j]
+		known := 0
+		if annotated[j] {
+			known = 1
+		}
+		motif, strand := jc.Motifs[j], j.Strand
+		if strand != "+" && strand != "-" {
+			strand = MotifStrand(motif)
+		}
+		fmt.Fprintf(bw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n", j.Chromosome, j.Intron.Start, j.Intron.End, starStrand(strand),
+			motif, known, stat.Unique, stat.Multi, stat.MaxOverhang)
+	}
+	return bw.Flush()
+}
+
+//WriteBED12 writes the junctions as regtools style BED12 records: two blocks
+//of the longest anchors on both sides, score is the number of reads rounded
+func (jc *JunctionCounter) WriteBED12(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for i, j := range jc.Sorted() {
+		stat := jc.Stats[j]
+		start, end := j.Intron.Start-1-stat.MaxLeft, j.Intron.End+stat.MaxRight
+		strand := j.Strand
+		if strand != "+" && strand != "-" {
+			strand = "."
+		}
+		fmt.Fprintf(bw, "%s\t%d\t%d\tJUNC%08d\t%d\t%s\t%d\t%d\t255,0,0\t2\t%d,%d\t0,%d\n", j.Chromosome, start, end, i+1,
+			int(math.Round(jc.Counts[j])), strand, start, end, stat.MaxLeft, stat.MaxRight, end-start-stat.MaxRight)
+	}
+	return bw.Flush()
+}
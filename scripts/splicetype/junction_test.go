@@ -0,0 +1,67 @@
+package splicetype
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+	"github.com/Hanbin/AberrantSplice/Internal/sjparser"
+)
+
+func TestWriteJunctionTables(t *testing.T) {
+	jc := NewJunctionCounter()
+	for _, s := range []genodatastruct.SamRec{
+		{QName: "unique", Chromosome: "chr1", Pos: 101, CIGAR: "20M100N30M"},
+		{QName: "multi", Chromosome: "chr1", Pos: 91, CIGAR: "30M100N10M", Tags: []string{"NH:i:2"}},
+		{QName: "unstranded", Chromosome: "chr1", Pos: 401, CIGAR: "25M50N25M"},
+	} {
+		mr := NewReadMapTranscriptome(s)
+		if s.QName == "unstranded" {
+			mr.Strand = "."
+		}
+		jc.Add(mr)
+	}
+	//the motif tells the strand of the unstranded junction
+	jc.Motifs[Junction{"chr1", ".", genodatastruct.Coor{Start: 426, End: 475}}] = 2
+	annotated := map[Junction]bool{{"chr1", "+", genodatastruct.Coor{Start: 121, End: 220}}: true}
+
+	var sj bytes.Buffer
+	if err := jc.WriteSJTab(&sj, annotated); err != nil {
+		t.Fatal(err)
+	}
+	want := "chr1\t121\t220\t1\t0\t1\t1\t1\t20\n" +
+		"chr1\t426\t475\t2\t2\t0\t1\t0\t25\n"
+	if sj.String() != want {
+		t.Errorf("SJ.out.tab\n%s\nwant\n%s", sj.String(), want)
+	}
+	var bed bytes.Buffer
+	if err := jc.WriteBED12(&bed); err != nil {
+		t.Fatal(err)
+	}
+	want = "chr1\t90\t250\tJUNC00000001\t2\t+\t90\t250\t255,0,0\t2\t30,30\t0,130\n" +
+		"chr1\t400\t500\tJUNC00000002\t1\t.\t400\t500\t255,0,0\t2\t25,25\t0,75\n"
+	if bed.String() != want {
+		t.Errorf("BED12\n%s\nwant\n%s", bed.String(), want)
+	}
+
+	//both read back to the same introns
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{"test.SJ.out.tab": sj.Bytes(), "test.junc": bed.Bytes()} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		recs := sjparser.ParseJunctions(path, sjparser.DetectFormat(path))
+		introns := []string{}
+		for _, rec := range recs {
+			introns = append(introns, fmt.Sprintf("%d-%d", rec.Intron.Start, rec.Intron.End))
+		}
+		if strings.Join(introns, " ") != "121-220 426-475" {
+			t.Errorf("introns %v read back from %s", introns, name)
+		}
+	}
+}
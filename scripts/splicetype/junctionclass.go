@@ -0,0 +1,228 @@
+package splicetype
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//Values of junction classification against the gene models
+const (
+	AnnotatedJunction = "annotated"
+	NovelDonor        = "novelDonor"
+	NovelAcceptor     = "novelAcceptor"
+	NovelJunction     = "novelJunction" //neither site annotated
+	NoGene            = "noGene"
+)
+
+//junctionPrecedence orders the classes when transcripts of a junction disagree
+var junctionPrecedence = []string{AnnotatedJunction, "exonSkipping", NovelDonor, NovelAcceptor, NovelJunction}
+
+//JunctionType is the classification of a junction with its read support
+type JunctionType struct {
+	Junction
+	Reads   int
+	Class   string
+	GeneIDs []string
+	Motif   int //STAR motif code, -1 if unknown
+}
+
+//junctionShift is the shifted site at pos of a junction without the read
+//segments: a site in an intron extends the exon facing the junction
+func junctionShift(t *genodatastruct.Transcript, pos int, site string, forward bool) (SiteShift, bool) {
+	seg := genodatastruct.Coor{Start: pos, End: pos}
+	for _, intron := range t.Introns {
+		if seg.Inside(intron) {
+			if (site == "donor") == forward {
+				seg.Start = intron.Start - 1
+			} else {
+				seg.End = intron.End + 1
+			}
+		}
+	}
+	return shiftedSite(t, seg, pos, site, forward)
+}
+
+//classifyJunctionTran classifies an intron against a single transcript with
+//the event it implies, nil for annotated or fully novel junctions
+func classifyJunctionTran(intron genodatastruct.Coor, gene *genodatastruct.Gene, geneID string, t *genodatastruct.Transcript) (string, *Event, []genodatastruct.Coor) {
+	for _, known := range t.Introns {
+		if known == intron {
+			return AnnotatedJunction, nil, nil
+		}
+	}
+	forward := t.Strand == "+"
+	donor, acceptor := intron.Start-1, intron.End+1
+	if !forward {
+		donor, acceptor = acceptor, donor
+	}
+	donorIdx, acceptorIdx := -1, -1
+	for i, exon := range t.Exons {
+		if (forward && exon.End == donor) || (!forward && exon.Start == donor) {
+			donorIdx = i
+		}
+		if (forward && exon.Start == acceptor) || (!forward && exon.End == acceptor) {
+			acceptorIdx = i
+		}
+	}
+	shiftEvent := func(pos int, site string) (*Event, []genodatastruct.Coor) {
+		s, ok := junctionShift(t, pos, site, forward)
+		if !ok {
+			return nil, nil
+		}
+		s.Junction, s.GeneID, s.TranscriptName = intron, geneID, t.TranscriptName
+		e := newEvent(gene, geneID, s.Type, t.Chromosome, t.Strand, s.Region())
+		e.ExclusionJunctions = []genodatastruct.Coor{s.Canonical()}
+		return e, []genodatastruct.Coor{intron}
+	}
+	switch {
+	case donorIdx >= 0 && acceptorIdx > donorIdx+1:
+		e, inclusion := skippingEvent(gene, geneID, t, donorIdx, acceptorIdx, t.Chromosome, t.Strand)
+		e.ExclusionJunctions = []genodatastruct.Coor{intron}
+		return "exonSkipping", e, inclusion
+	case donorIdx >= 0 && acceptorIdx < 0:
+		e, inclusion := shiftEvent(acceptor, "acceptor")
+		return NovelAcceptor, e, inclusion
+	case donorIdx < 0 && acceptorIdx >= 0:
+		e, inclusion := shiftEvent(donor, "donor")
+		return NovelDonor, e, inclusion
+	}
+	return NovelJunction, nil, nil
+}
+
+//ClassifyJunction classifies a junction against the transcripts of the genes it
+//falls in. A junction of undefined strand takes the strand of the best matching
+//gene, or of its motif if canonical. Return the classification and the events
+//implied by it
+func ClassifyJunction(rec genodatastruct.JunctionRec, genes map[string]*genodatastruct.Gene, index map[string]*GeneMapIndex) (JunctionType, []*Event) {
+	if rec.Strand == "." {
+		rec.Strand = MotifStrand(rec.Motif)
+	}
+	jt := JunctionType{Junction: Junction{rec.Chromosome, rec.Strand, rec.Intron}, Reads: rec.Unique + rec.Multi, Class: NoGene, Motif: rec.Motif}
+	//the donor and acceptor bases as a read of two 1bp segments
+	mr := ReadMapTranscriptome{
+		Chromosome: rec.Chromosome,
+		Segment:    []genodatastruct.Coor{{Start: rec.Intron.Start - 1, End: rec.Intron.Start - 1}, {Start: rec.Intron.End + 1, End: rec.Intron.End + 1}},
+	}
+	mr.InvolvedGeneLoci(index)
+	type call struct {
+		class, geneID, strand string
+		event                 *Event
+		inclusion             []genodatastruct.Coor
+	}
+	calls := []call{}
+	for _, geneid := range mr.GeneLoci {
+		gene, ok := genes[geneid]
+		if !ok || (rec.Strand != "." && rec.Strand != gene.Strand) {
+			continue
+		}
+		for _, t := range gene.Transcripts {
+			class, e, inclusion := classifyJunctionTran(rec.Intron, gene, geneid, t)
+			calls = append(calls, call{class, geneid, gene.Strand, e, inclusion})
+		}
+	}
+	events := []*Event{}
+	for _, class := range junctionPrecedence {
+		for _, c := range calls {
+			if c.class != class {
+				continue
+			}
+			jt.Class, jt.Strand = class, c.strand
+			if !AnyString(jt.GeneIDs, func(s string) bool { return s == c.geneID }) {
+				jt.GeneIDs = append(jt.GeneIDs, c.geneID)
+			}
+			if c.event != nil && !AnyString(eventIDs(events), func(s string) bool { return s == c.event.ID }) {
+				c.event.InclusionJunctions = c.inclusion
+				events = append(events, c.event)
+			}
+		}
+		if jt.Class != NoGene {
+			break
+		}
+	}
+	return jt, events
+}
+
+func eventIDs(events []*Event) []string {
+	ids := []string{}
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+//AddRecord counts a junction reported by an aligner
+func (jc *JunctionCounter) AddRecord(j Junction, rec genodatastruct.JunctionRec) {
+	jc.Counts[j] += float64(rec.Unique + rec.Multi)
+	stat, ok := jc.Stats[j]
+	if !ok {
+		stat = &JunctionStat{}
+		jc.Stats[j] = stat
+	}
+	stat.Unique += rec.Unique
+	stat.Multi += rec.Multi
+	if rec.Motif >= 0 {
+		jc.Motifs[j] = rec.Motif
+	}
+	if rec.MaxOverhang > stat.MaxOverhang {
+		stat.MaxOverhang = rec.MaxOverhang
+	}
+	if rec.MaxOverhang > stat.MaxLeft {
+		stat.MaxLeft = rec.MaxOverhang
+	}
+	if rec.MaxOverhang > stat.MaxRight {
+		stat.MaxRight = rec.MaxOverhang
+	}
+}
+
+//junctionCategory is the read category matching a junction class
+func junctionCategory(jt JunctionType, events []*Event) string {
+	switch jt.Class {
+	case AnnotatedJunction:
+		return "normal"
+	case "exonSkipping":
+		return "exonSkipping"
+	case NovelDonor, NovelAcceptor:
+		if len(events) > 0 {
+			return events[0].Type
+		}
+	}
+	return ""
+}
+
+//AddJunction classifies a junction record and adds its reads to the
+//junction counter, the genes and the events of the table
+func (et *EventTable) AddJunction(rec genodatastruct.JunctionRec, index map[string]*GeneMapIndex) JunctionType {
+	jt, events := ClassifyJunction(rec, et.Genes, index)
+	et.Junctions.AddRecord(jt.Junction, rec)
+	if category := junctionCategory(jt, events); category != "" {
+		for _, geneid := range jt.GeneIDs {
+			if _, ok := et.geneReads[geneid]; !ok {
+				et.geneReads[geneid] = map[string]float64{}
+			}
+			et.geneReads[geneid][category] += float64(jt.Reads)
+		}
+	}
+	for _, e := range events {
+		et.addEvent(e, float64(jt.Reads))
+	}
+	return jt
+}
+
+//WriteJunctionTypes writes the junction classification as a tab separated table
+func WriteJunctionTypes(w io.Writer, types []JunctionType) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "chromosome\tstart\tend\tstrand\treads\tmotif\tclass\tgene_ids")
+	for _, jt := range types {
+		geneids := strings.Join(jt.GeneIDs, ",")
+		if geneids == "" {
+			geneids = "-"
+		}
+		fmt.Fprintf(bw, "%s\t%d\t%d\t%s\t%d\t%s\t%s\t%s\n", jt.Chromosome, jt.Intron.Start, jt.Intron.End, jt.Strand, jt.Reads,
+			MotifName(jt.Motif), jt.Class, geneids)
+	}
+	return bw.Flush()
+}
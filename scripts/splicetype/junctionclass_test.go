@@ -0,0 +1,50 @@
+package splicetype
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestClassifyJunction(t *testing.T) {
+	gene := graphGene("+", []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 300, End: 400}, {Start: 600, End: 700}})
+	genes := map[string]*genodatastruct.Gene{"G": gene}
+	index := SortGeneMap(genes)
+	tests := []struct {
+		strand  string
+		motif   int
+		intron  genodatastruct.Coor
+		class   string
+		jstrand string
+		events  string //types of the implied events
+	}{
+		{"+", 1, genodatastruct.Coor{Start: 201, End: 299}, AnnotatedJunction, "+", ""},
+		{"+", 1, genodatastruct.Coor{Start: 201, End: 599}, "exonSkipping", "+", "exonSkipping"},
+		{"+", 1, genodatastruct.Coor{Start: 201, End: 349}, NovelAcceptor, "+", "truncExon"},
+		{"+", 1, genodatastruct.Coor{Start: 251, End: 299}, NovelDonor, "+", "extendExon"},
+		{"+", 1, genodatastruct.Coor{Start: 451, End: 549}, NovelJunction, "+", ""},
+		//undefined strand, of the motif or else of the gene
+		{".", 1, genodatastruct.Coor{Start: 201, End: 299}, AnnotatedJunction, "+", ""},
+		{".", 0, genodatastruct.Coor{Start: 201, End: 299}, AnnotatedJunction, "+", ""},
+		{".", 2, genodatastruct.Coor{Start: 201, End: 299}, NoGene, "-", ""},
+		{"-", 2, genodatastruct.Coor{Start: 201, End: 299}, NoGene, "-", ""},
+		{"+", 1, genodatastruct.Coor{Start: 801, End: 899}, NoGene, "+", ""},
+	}
+	for _, test := range tests {
+		rec := genodatastruct.JunctionRec{Chromosome: "chr1", Strand: test.strand, Intron: test.intron, Unique: 3, Multi: 1, Motif: test.motif}
+		jt, events := ClassifyJunction(rec, genes, index)
+		types := []string{}
+		for _, e := range events {
+			types = append(types, e.Type)
+		}
+		genesOK := len(jt.GeneIDs) == 0
+		if jt.Class != NoGene {
+			genesOK = len(jt.GeneIDs) == 1 && jt.GeneIDs[0] == "G"
+		}
+		if jt.Class != test.class || jt.Strand != test.jstrand || jt.Reads != 4 || !genesOK || strings.Join(types, ",") != test.events {
+			t.Errorf("%s %v: class %s strand %s reads %d genes %v events %v, want %s %s 4 reads events %q",
+				test.strand, test.intron, jt.Class, jt.Strand, jt.Reads, jt.GeneIDs, types, test.class, test.jstrand, test.events)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package splicetype
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//LibraryType tells the transcript strand of a read from its alignment
+type LibraryType int
+
+const (
+	Forward      LibraryType = iota //every read on the transcript strand
+	Reverse                         //every read on the opposite strand
+	Unstranded                      //strand from the XS tag or the overlapping genes
+	FirstStrand                     //fr-firststrand (dUTP): read 1 opposite, read 2 on the transcript strand
+	SecondStrand                    //fr-secondstrand (ligation): read 1 on the transcript strand, read 2 opposite
+)
+
+var libraryNames = map[string]LibraryType{
+	"forward":         Forward,
+	"reverse":         Reverse,
+	"unstranded":      Unstranded,
+	"fr-firststrand":  FirstStrand,
+	"fr-secondstrand": SecondStrand,
+}
+
+//ParseLibraryType parses forward, reverse, unstranded, fr-firststrand or
+//fr-secondstrand. An empty name is forward, the strand of the alignment
+func ParseLibraryType(name string) (LibraryType, error) {
+	if name == "" {
+		return Forward, nil
+	}
+	if l, ok := libraryNames[strings.ToLower(name)]; ok {
+		return l, nil
+	}
+	return Forward, fmt.Errorf("unknown library type %q", name)
+}
+
+func (l LibraryType) String() string {
+	for name, v := range libraryNames {
+		if v == l {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+func flip(strand string) string {
+	if strand == "+" {
+		return "-"
+	}
+	return "+"
+}
+
+//ReadStrand is the transcript strand of the read. Unstranded reads take the
+//XS tag of the aligner, "." without it
+func (l LibraryType) ReadStrand(s genodatastruct.SamRec) string {
+	strand := s.Strand()
+	second := s.Flag&0x1 != 0 && s.Flag&0x80 != 0
+	switch l {
+	case Reverse:
+		return flip(strand)
+	case Unstranded:
+		if xs, ok := s.Tag("XS"); ok && (xs == "+" || xs == "-") {
+			return xs
+		}
+		return "."
+	case FirstStrand:
+		if !second {
+			return flip(strand)
+		}
+	case SecondStrand:
+		if second {
+			return flip(strand)
+		}
+	}
+	return strand
+}
+
+//orderSegments puts the segments in the transcript direction of the read
+//strand, which differs from the alignment strand of RegionAligned for reverse
+//libraries and unstranded reads taking the gene strand
+func (mr *ReadMapTranscriptome) orderSegments() {
+	if mr.Strand == "+" || mr.Strand == "-" {
+		genodatastruct.SortCoors(mr.Segment, mr.Strand == "+")
+	}
+}
+
+//geneStrand is the strand shared by all the genes of the read, "." if they
+//disagree or the read is not genic
+func (mr *ReadMapTranscriptome) geneStrand(genes map[string]*genodatastruct.Gene) string {
+	strand := "."
+	for _, geneid := range mr.GeneLoci {
+		gene, ok := genes[geneid]
+		if !ok {
+			return "."
+		}
+		if strand != "." && gene.Strand != strand {
+			return "."
+		}
+		strand = gene.Strand
+	}
+	return strand
+}
@@ -0,0 +1,103 @@
+package splicetype
+
+import (
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestReadStrand(t *testing.T) {
+	const (
+		paired  = 0x1
+		reverse = 0x10
+		read1   = 0x40
+		read2   = 0x80
+	)
+	tests := []struct {
+		library string
+		flag    int64
+		tags    []string
+		want    string
+	}{
+		{"forward", 0, nil, "+"},
+		{"forward", reverse, nil, "-"},
+		{"reverse", 0, nil, "-"},
+		{"reverse", reverse, nil, "+"},
+		{"unstranded", reverse, []string{"XS:A:+"}, "+"},
+		{"unstranded", 0, nil, "."},
+		//dUTP: read 1 opposite to the transcript, read 2 on it
+		{"fr-firststrand", paired | read1, nil, "-"},
+		{"fr-firststrand", paired | read1 | reverse, nil, "+"},
+		{"fr-firststrand", paired | read2, nil, "+"},
+		{"fr-firststrand", paired | read2 | reverse, nil, "-"},
+		{"fr-firststrand", reverse, nil, "+"}, //single end reads as read 1
+		{"fr-secondstrand", paired | read1, nil, "+"},
+		{"fr-secondstrand", paired | read1 | reverse, nil, "-"},
+		{"fr-secondstrand", paired | read2, nil, "-"},
+		{"fr-secondstrand", paired | read2 | reverse, nil, "+"},
+		{"FR-SecondStrand", 0, nil, "+"},
+	}
+	for _, test := range tests {
+		library, err := ParseLibraryType(test.library)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := library.ReadStrand(genodatastruct.SamRec{Flag: test.flag, Tags: test.tags}); got != test.want {
+			t.Errorf("%s read of flag %d: strand %s, want %s", test.library, test.flag, got, test.want)
+		}
+	}
+	if _, err := ParseLibraryType("stranded"); err == nil {
+		t.Error("unknown library type parsed")
+	}
+}
+
+func TestReadGroupFilter(t *testing.T) {
+	mapq := func(s genodatastruct.SamRec) bool { return s.MAPQ > 10 }
+	tests := []struct {
+		rg   string
+		rec  genodatastruct.SamRec
+		want bool
+	}{
+		{"rg1", genodatastruct.SamRec{MAPQ: 60, Tags: []string{"RG:Z:rg1"}}, true},
+		{"rg1", genodatastruct.SamRec{MAPQ: 5, Tags: []string{"RG:Z:rg1"}}, false},
+		{"rg1", genodatastruct.SamRec{MAPQ: 60, Tags: []string{"RG:Z:rg2"}}, false},
+		{"rg1", genodatastruct.SamRec{MAPQ: 60}, false},
+		{"", genodatastruct.SamRec{MAPQ: 60, Tags: []string{"RG:Z:rg2"}}, true},
+		{"", genodatastruct.SamRec{MAPQ: 5}, false},
+	}
+	for _, test := range tests {
+		if got := ReadGroupFilter(test.rg, mapq)(test.rec); got != test.want {
+			t.Errorf("read group %q filter of %+v: %t, want %t", test.rg, test.rec, got, test.want)
+		}
+	}
+}
+
+func TestSampleOptions(t *testing.T) {
+	opt := DefaultReadOptions()
+	opt.Library = Reverse
+	rec := genodatastruct.SamRec{MAPQ: 60, Tags: []string{"RG:Z:rg2"}}
+	tests := []struct {
+		rg, library string
+		want        LibraryType
+		kept        bool
+	}{
+		{"", "", Reverse, true}, //the library of the command
+		{"rg1", "unstranded", Unstranded, false},
+		{"rg2", "fr-firststrand", FirstStrand, true},
+	}
+	for _, test := range tests {
+		sampleOpt, err := opt.SampleOptions(test.rg, test.library)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sampleOpt.Library != test.want || sampleOpt.Filter(rec) != test.kept {
+			t.Errorf("sample of read group %q and library %q: library %v, keeps rg2 %t, want %v %t", test.rg, test.library, sampleOpt.Library, sampleOpt.Filter(rec), test.want, test.kept)
+		}
+	}
+	if opt.Library != Reverse || !opt.Filter(genodatastruct.SamRec{MAPQ: 60}) {
+		t.Error("sample options changed the options of the command")
+	}
+	if _, err := opt.SampleOptions("", "stranded"); err == nil {
+		t.Error("unknown library type of a sample accepted")
+	}
+}
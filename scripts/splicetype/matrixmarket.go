@@ -0,0 +1,74 @@
+package splicetype
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+//WriteMatrixMarket writes the non zero values of the matrix in the sparse
+//coordinate Matrix Market format, indexes from 1. The matrix is of integers
+//unless a value is fractional, from weighted multimappers
+func WriteMatrixMarket(w io.Writer, matrix [][]float64) error {
+	bw := bufio.NewWriter(w)
+	cols, entries, field := 0, 0, "integer"
+	for _, row := range matrix {
+		if len(row) > cols {
+			cols = len(row)
+		}
+		for _, v := range row {
+			if v != 0 {
+				entries++
+			}
+			if v != math.Trunc(v) {
+				field = "real"
+			}
+		}
+	}
+	fmt.Fprintf(bw, "%%%%MatrixMarket matrix coordinate %s general\n", field)
+	fmt.Fprintf(bw, "%d %d %d\n", len(matrix), cols, entries)
+	for i, row := range matrix {
+		for j, v := range row {
+			if v != 0 {
+				fmt.Fprintf(bw, "%d %d %s\n", i+1, j+1, strconv.FormatFloat(v, 'f', -1, 64))
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+//EventMatrices splits the counts of the events in each sample into the
+//inclusion and the exclusion matrices of samples (rows) by events (columns)
+func EventMatrices(counts [][]EventCount, samples int) (inclusion, exclusion [][]float64) {
+	for s := 0; s < samples; s++ {
+		inc, exc := make([]float64, len(counts)), make([]float64, len(counts))
+		for i := range counts {
+			inc[i], exc[i] = counts[i][s].Inclusion, counts[i][s].Exclusion
+		}
+		inclusion, exclusion = append(inclusion, inc), append(exclusion, exc)
+	}
+	return inclusion, exclusion
+}
+
+//WriteEventFeatures writes the events naming the columns of the event
+//matrices, one by line
+func WriteEventFeatures(w io.Writer, events []*Event) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range events {
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%s\n", e.ID, e.GeneID, e.GeneName, e.Type)
+	}
+	return bw.Flush()
+}
+
+//WriteJunctionFeatures writes the junctions naming the columns of the
+//junction matrix, one by line
+func WriteJunctionFeatures(w io.Writer, junctions []Junction) error {
+	bw := bufio.NewWriter(w)
+	for _, j := range junctions {
+		fmt.Fprintf(bw, "%s:%d-%d:%s\t%s\t%d\t%d\t%s\n", j.Chromosome, j.Intron.Start, j.Intron.End, j.Strand,
+			j.Chromosome, j.Intron.Start, j.Intron.End, j.Strand)
+	}
+	return bw.Flush()
+}
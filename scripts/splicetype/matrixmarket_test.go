@@ -0,0 +1,32 @@
+package splicetype
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteMatrixMarket(t *testing.T) {
+	tests := []struct {
+		name   string
+		matrix [][]float64
+		want   string
+	}{
+		{"integer", [][]float64{{0, 3, 0}, {1, 0, 0}},
+			"%%MatrixMarket matrix coordinate integer general\n2 3 2\n1 2 3\n2 1 1\n"},
+		//a weighted multimapper makes the matrix real
+		{"real", [][]float64{{0, 2.5}, {4, 0}},
+			"%%MatrixMarket matrix coordinate real general\n2 2 2\n1 2 2.5\n2 1 4\n"},
+		//the columns of the longest row
+		{"empty rows", [][]float64{{}, {0, 0, 0, 2}},
+			"%%MatrixMarket matrix coordinate integer general\n2 4 1\n2 4 2\n"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := WriteMatrixMarket(&buf, test.matrix); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.want {
+			t.Errorf("%s matrix\n%s\nwant\n%s", test.name, buf.String(), test.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package splicetype
+
+import (
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//Splice motifs coded as STAR does. Odd codes are motifs of + strand introns,
+//even codes the same motifs read on the - strand
+const (
+	NonCanonical = 0
+	GTAG         = 1
+	CTAC         = 2
+	GCAG         = 3
+	CTGC         = 4
+	ATAC         = 5
+	GTAT         = 6
+)
+
+//motifNames of the codes, donor/acceptor on the + strand
+var motifNames = []string{"non-canonical", "GT/AG", "CT/AC", "GC/AG", "CT/GC", "AT/AC", "GT/AT"}
+
+//MotifOf codes the first two and last two bases of an intron on the + strand
+func MotifOf(first, last string) int {
+	for code := 1; code < len(motifNames); code++ {
+		if motifNames[code] == first+"/"+last {
+			return code
+		}
+	}
+	return NonCanonical
+}
+
+//MotifName of the code, NA for an unknown motif
+func MotifName(code int) string {
+	if code < 0 || code >= len(motifNames) {
+		return "NA"
+	}
+	return motifNames[code]
+}
+
+//MotifStrand is the strand of the transcript implied by a canonical motif,
+//. for non-canonical or unknown motifs
+func MotifStrand(code int) string {
+	switch {
+	case code <= 0 || code >= len(motifNames):
+		return "."
+	case code%2 == 1:
+		return "+"
+	}
+	return "-"
+}
+
+//JunctionMotif reads the motif of the intron from the genome. The motif is
+//-1 if the intron is not within a sequence of the FASTA
+func JunctionMotif(fa *genodatastruct.Fasta, chromosome string, intron genodatastruct.Coor) (int, error) {
+	if _, ok := fa.Index[genodatastruct.ChroSym(chromosome)]; !ok {
+		return -1, nil
+	}
+	first, err := fa.Fetch(chromosome, genodatastruct.Coor{Start: intron.Start, End: intron.Start + 1})
+	if err != nil {
+		return -1, err
+	}
+	last, err := fa.Fetch(chromosome, genodatastruct.Coor{Start: intron.End - 1, End: intron.End})
+	if err != nil {
+		return -1, err
+	}
+	if len(first) < 2 || len(last) < 2 {
+		return -1, nil
+	}
+	return MotifOf(first, last), nil
+}
+
+//AnnotateMotifs reads the motif of every counted junction
+func (jc *JunctionCounter) AnnotateMotifs(fa *genodatastruct.Fasta) error {
+	for j := range jc.Counts {
+		motif, err := JunctionMotif(fa, j.Chromosome, j.Intron)
+		if err != nil {
+			return err
+		}
+		if motif >= 0 {
+			jc.Motifs[j] = motif
+		}
+	}
+	return nil
+}
+
+//RecordMotifs reads the motif of the junction records from the genome
+//replacing the one reported by the aligner
+func RecordMotifs(fa *genodatastruct.Fasta, records []genodatastruct.JunctionRec) error {
+	for i := range records {
+		motif, err := JunctionMotif(fa, records[i].Chromosome, records[i].Intron)
+		if err != nil {
+			return err
+		}
+		if motif >= 0 {
+			records[i].Motif = motif
+		}
+	}
+	return nil
+}
+
+//Canonical tells whether the junction has a canonical motif agreeing with its
+//strand. known is false when the motif was not annotated
+func (jc *JunctionCounter) Canonical(j Junction) (canonical, known bool) {
+	motif, ok := jc.Motifs[j]
+	if !ok {
+		return false, false
+	}
+	strand := MotifStrand(motif)
+	return strand != "." && (j.Strand == "." || j.Strand == strand), true
+}
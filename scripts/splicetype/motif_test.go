@@ -0,0 +1,161 @@
+package splicetype
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//motifIntrons of the test genome, 10 bases each
+var motifIntrons = []struct {
+	first, last string
+	intron      genodatastruct.Coor
+	motif       int
+	strand      string
+}{
+	{"GT", "AG", genodatastruct.Coor{Start: 11, End: 20}, GTAG, "+"},
+	{"CT", "AC", genodatastruct.Coor{Start: 21, End: 30}, CTAC, "-"},
+	{"GC", "AG", genodatastruct.Coor{Start: 31, End: 40}, GCAG, "+"},
+	{"CT", "GC", genodatastruct.Coor{Start: 41, End: 50}, CTGC, "-"},
+	{"AT", "AC", genodatastruct.Coor{Start: 51, End: 60}, ATAC, "+"},
+	{"GT", "AT", genodatastruct.Coor{Start: 61, End: 70}, GTAT, "-"},
+	{"GG", "CC", genodatastruct.Coor{Start: 71, End: 80}, NonCanonical, "."},
+	{"AA", "AA", genodatastruct.Coor{Start: 86, End: 95}, NonCanonical, "."},
+}
+
+//motifFasta writes chr1 of 100 bases holding the test introns in lines of 30
+func motifFasta(t *testing.T) *genodatastruct.Fasta {
+	bases := []byte(strings.Repeat("A", 100))
+	for _, mi := range motifIntrons {
+		copy(bases[mi.intron.Start-1:], mi.first)
+		copy(bases[mi.intron.End-2:], mi.last)
+	}
+	fasta := ">chr1\n"
+	for i := 0; i < len(bases); i += 30 {
+		end := i + 30
+		if end > len(bases) {
+			end = len(bases)
+		}
+		fasta += string(bases[i:end]) + "\n"
+	}
+	path := filepath.Join(t.TempDir(), "genome.fa")
+	if err := ioutil.WriteFile(path, []byte(fasta), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fa, err := genodatastruct.OpenFasta(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fa
+}
+
+func TestJunctionMotif(t *testing.T) {
+	fa := motifFasta(t)
+	for _, mi := range motifIntrons {
+		if code := MotifOf(mi.first, mi.last); code != mi.motif {
+			t.Errorf("motif %s/%s coded %d, want %d", mi.first, mi.last, code, mi.motif)
+		}
+		if strand := MotifStrand(mi.motif); strand != mi.strand {
+			t.Errorf("%s/%s motif on strand %s, want %s", mi.first, mi.last, strand, mi.strand)
+		}
+		if mi.motif != NonCanonical && MotifName(mi.motif) != mi.first+"/"+mi.last {
+			t.Errorf("motif %d named %s", mi.motif, MotifName(mi.motif))
+		}
+		code, err := JunctionMotif(fa, "chr1", mi.intron)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != mi.motif {
+			t.Errorf("motif %d of the intron %v, want %d", code, mi.intron, mi.motif)
+		}
+	}
+	if MotifName(NonCanonical) != "non-canonical" || MotifName(-1) != "NA" || MotifStrand(-1) != "." {
+		t.Error("names or strand of the unknown motifs")
+	}
+	//introns off the sequences have no motif
+	for _, test := range []struct {
+		chromosome string
+		intron     genodatastruct.Coor
+	}{
+		{"chr2", genodatastruct.Coor{Start: 11, End: 20}},
+		{"chr1", genodatastruct.Coor{Start: 95, End: 105}},
+	} {
+		if code, err := JunctionMotif(fa, test.chromosome, test.intron); err != nil || code != -1 {
+			t.Errorf("motif %d (%v) of the intron %s:%v off the genome, want -1", code, err, test.chromosome, test.intron)
+		}
+	}
+
+	jc := NewJunctionCounter()
+	for _, j := range []Junction{
+		{"chr1", "+", genodatastruct.Coor{Start: 11, End: 20}},
+		{"chr1", "+", genodatastruct.Coor{Start: 21, End: 30}}, //- strand motif
+		{"chr1", ".", genodatastruct.Coor{Start: 41, End: 50}},
+		{"chr1", "+", genodatastruct.Coor{Start: 71, End: 80}},
+		{"chr2", "+", genodatastruct.Coor{Start: 11, End: 20}},
+	} {
+		jc.Counts[j] = 1
+	}
+	if err := jc.AnnotateMotifs(fa); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		j                Junction
+		canonical, known bool
+	}{
+		{Junction{"chr1", "+", genodatastruct.Coor{Start: 11, End: 20}}, true, true},
+		{Junction{"chr1", "+", genodatastruct.Coor{Start: 21, End: 30}}, false, true},
+		{Junction{"chr1", ".", genodatastruct.Coor{Start: 41, End: 50}}, true, true},
+		{Junction{"chr1", "+", genodatastruct.Coor{Start: 71, End: 80}}, false, true},
+		{Junction{"chr2", "+", genodatastruct.Coor{Start: 11, End: 20}}, false, false},
+	} {
+		if canonical, known := jc.Canonical(test.j); canonical != test.canonical || known != test.known {
+			t.Errorf("junction %+v: canonical %t known %t, want %t %t", test.j, canonical, known, test.canonical, test.known)
+		}
+	}
+}
+
+func TestCanonicalOnly(t *testing.T) {
+	fa := motifFasta(t)
+	//the transcript intron 71-80 is non-canonical
+	tr := &genodatastruct.Transcript{TranscriptName: "T1", Chromosome: "chr1", Strand: "+", Coordinate: genodatastruct.Coor{Start: 1, End: 85},
+		Exons: []genodatastruct.Coor{{Start: 1, End: 70}, {Start: 81, End: 85}}, Introns: []genodatastruct.Coor{{Start: 71, End: 80}}}
+	genes := map[string]*genodatastruct.Gene{"G": {GeneName: "ONE", Chromosome: "chr1", Strand: "+", Coordinate: tr.Coordinate, Transcripts: []*genodatastruct.Transcript{tr}}}
+	jc := NewJunctionCounter()
+	for _, intron := range []genodatastruct.Coor{{Start: 11, End: 20}, {Start: 21, End: 30}, {Start: 71, End: 80}, {Start: 86, End: 95}} {
+		jc.Counts[Junction{"chr1", "+", intron}] = 5
+	}
+	if err := jc.AnnotateMotifs(fa); err != nil {
+		t.Fatal(err)
+	}
+	events := func(canonicalOnly bool) string {
+		et := NewEventTable(genes, jc)
+		et.CanonicalOnly = canonicalOnly
+		for _, e := range []struct {
+			id       string
+			junction genodatastruct.Coor
+		}{
+			{"novelCanonical", genodatastruct.Coor{Start: 11, End: 20}},
+			{"novelOtherStrand", genodatastruct.Coor{Start: 21, End: 30}},
+			{"annotated", genodatastruct.Coor{Start: 71, End: 80}},
+			{"novelNonCanonical", genodatastruct.Coor{Start: 86, End: 95}},
+			{"unknownMotif", genodatastruct.Coor{Start: 5, End: 8}},
+		} {
+			et.addEvent(&Event{ID: e.id, GeneID: "G", Chromosome: "chr1", Strand: "+", Coordinate: e.junction,
+				ExclusionJunctions: []genodatastruct.Coor{e.junction}}, 5)
+		}
+		ids := []string{}
+		for _, e := range et.Events(1) {
+			ids = append(ids, e.ID)
+		}
+		return strings.Join(ids, " ")
+	}
+	if got := events(false); got != "unknownMotif novelCanonical novelOtherStrand annotated novelNonCanonical" {
+		t.Errorf("events %s, want them all", got)
+	}
+	if got := events(true); got != "unknownMotif novelCanonical annotated" {
+		t.Errorf("canonical only events %s, want unknownMotif novelCanonical annotated", got)
+	}
+}
@@ -0,0 +1,173 @@
+package splicetype
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/Hanbin/AberrantSplice/Internal/splicestats"
+)
+
+//OutlierOptions are the coverage filters of the outlier scoring
+type OutlierOptions struct {
+	MinPatientReads float64 //minimum normalized reads of the patient
+	MinControlReads float64 //minimum normalized reads of a control to be informative
+	MinControls     int     //minimum informative controls
+	MinSD           float64 //floor of the control PSI standard deviation for the z-score
+}
+
+//DefaultOutlierOptions for a cohort of tens of controls
+var DefaultOutlierOptions = OutlierOptions{MinPatientReads: 10, MinControlReads: 5, MinControls: 5, MinSD: 0.01}
+
+//OutlierResult is the score of an event of a patient against the controls
+type OutlierResult struct {
+	Sample      string
+	Event       *Event
+	Count       EventCount //patient reads
+	PSI         float64    //patient PSI
+	ControlMean float64    //mean PSI of the informative controls
+	ControlSD   float64
+	Controls    int //informative controls
+	Z           float64
+	DeltaPSI    float64 //patient minus control mean
+	P, Q        float64
+	GeneP       float64 //smallest p-value of the gene, Bonferroni adjusted over its events
+	GeneRank    int     //rank of the gene in the patient, from 1
+}
+
+//ScoreOutliers scores the events of the patient sample against the control
+//samples. The z-score is on the PSI, the p-value is the two sided tail of the
+//patient counts under a beta-binomial fitted to the controls. Events failing
+//the coverage filters have NaN scores. Q-values are Benjamini-Hochberg adjusted
+//over the scored events. The results are ranked by gene, the genes by their
+//adjusted smallest p-value, then by the p-value of the events
+func ScoreOutliers(sample string, events []*Event, counts [][]EventCount, patient int, controls []int, opt OutlierOptions) []*OutlierResult {
+	results := []*OutlierResult{}
+	pvalues := []float64{}
+	for i, e := range events {
+		r := &OutlierResult{Sample: sample, Event: e, Count: counts[i][patient], PSI: math.NaN(), ControlMean: math.NaN(),
+			ControlSD: math.NaN(), Z: math.NaN(), DeltaPSI: math.NaN(), P: math.NaN(), Q: math.NaN()}
+		inclusion, exclusion := e.Normalize(r.Count.Inclusion, r.Count.Exclusion)
+		if inclusion+exclusion > 0 {
+			r.PSI = inclusion / (inclusion + exclusion)
+		}
+		cohort := []splicestats.Counts{}
+		psis := []float64{}
+		for _, s := range controls {
+			ci, ce := e.Normalize(counts[i][s].Inclusion, counts[i][s].Exclusion)
+			if ci+ce < opt.MinControlReads || ci+ce <= 0 {
+				continue
+			}
+			cohort = append(cohort, splicestats.Counts{K: ci, N: ci + ce})
+			psis = append(psis, ci/(ci+ce))
+		}
+		r.Controls = len(psis)
+		if r.Controls > 0 {
+			r.ControlMean, r.ControlSD = meanSD(psis)
+			r.DeltaPSI = r.PSI - r.ControlMean
+		}
+		if inclusion+exclusion >= opt.MinPatientReads && inclusion+exclusion > 0 && r.Controls >= opt.MinControls {
+			r.Z = r.DeltaPSI / math.Max(r.ControlSD, opt.MinSD)
+			fit := splicestats.FitBetaBinomial(cohort)
+			n := int(math.Round(inclusion + exclusion))
+			r.P = splicestats.OutlierPValue(int(math.Round(inclusion)), n, fit.Means[0], fit.Phi)
+		}
+		results = append(results, r)
+		pvalues = append(pvalues, r.P)
+	}
+	for i, q := range splicestats.BenjaminiHochberg(pvalues) {
+		results[i].Q = q
+	}
+	rankGenes(results)
+	return results
+}
+
+//meanSD is the mean and the sample standard deviation, 0 for a single value
+func meanSD(vs []float64) (float64, float64) {
+	mean := 0.0
+	for _, v := range vs {
+		mean += v
+	}
+	mean /= float64(len(vs))
+	if len(vs) < 2 {
+		return mean, 0
+	}
+	ss := 0.0
+	for _, v := range vs {
+		ss += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(ss / float64(len(vs)-1))
+}
+
+//rankGenes sets the gene p-values and ranks and sorts the results by gene rank
+//and p-value. Unscored events sort last
+func rankGenes(results []*OutlierResult) {
+	best := map[string]float64{}
+	tested := map[string]int{}
+	for _, r := range results {
+		if math.IsNaN(r.P) {
+			continue
+		}
+		tested[r.Event.GeneID]++
+		if p, ok := best[r.Event.GeneID]; !ok || r.P < p {
+			best[r.Event.GeneID] = r.P
+		}
+	}
+	genes := []string{}
+	geneP := map[string]float64{}
+	for g, p := range best {
+		genes = append(genes, g)
+		geneP[g] = math.Min(1, p*float64(tested[g]))
+	}
+	sort.Slice(genes, func(i, j int) bool {
+		if geneP[genes[i]] != geneP[genes[j]] {
+			return geneP[genes[i]] < geneP[genes[j]]
+		}
+		return genes[i] < genes[j]
+	})
+	rank := map[string]int{}
+	for i, g := range genes {
+		rank[g] = i + 1
+	}
+	for _, r := range results {
+		r.GeneP = math.NaN()
+		if p, ok := geneP[r.Event.GeneID]; ok {
+			r.GeneP, r.GeneRank = p, rank[r.Event.GeneID]
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if (a.GeneRank == 0) != (b.GeneRank == 0) {
+			return b.GeneRank == 0
+		}
+		if a.GeneRank != b.GeneRank {
+			return a.GeneRank < b.GeneRank
+		}
+		if math.IsNaN(a.P) != math.IsNaN(b.P) {
+			return math.IsNaN(b.P)
+		}
+		return a.P < b.P
+	})
+}
+
+//WriteOutliers writes the scored events of the patients, each patient ranked
+//by gene
+func WriteOutliers(w io.Writer, results []*OutlierResult) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "sample\tgene_rank\tgene_p_value\tgene_id\tgene_name\tevent_id\ttype\tchromosome\tstart\tend\tstrand\tinclusion\texclusion\tpsi\tcontrol_psi\tcontrol_sd\tcontrols\tdelta_psi\tz_score\tp_value\tq_value")
+	for _, r := range results {
+		e := r.Event
+		rank := "NA"
+		if r.GeneRank > 0 {
+			rank = strconv.Itoa(r.GeneRank)
+		}
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n", r.Sample, rank,
+			formatPValue(r.GeneP), e.GeneID, e.GeneName, e.ID, e.Type, e.Chromosome, e.Coordinate.Start, e.Coordinate.End,
+			e.Strand, FormatCount(r.Count.Inclusion), FormatCount(r.Count.Exclusion), FormatRatio(r.PSI), FormatRatio(r.ControlMean), FormatRatio(r.ControlSD),
+			r.Controls, FormatRatio(r.DeltaPSI), formatScores(r.Z), formatPValue(r.P), formatPValue(r.Q))
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,87 @@
+package splicetype
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestScoreOutliers(t *testing.T) {
+	event := func(id, geneID string) *Event {
+		return &Event{ID: id, GeneID: geneID, Type: "intronRetention", Chromosome: "chr1", Strand: "+",
+			ExclusionJunctions: []genodatastruct.Coor{{Start: 100, End: 200}}}
+	}
+	events := []*Event{event("B1", "GB"), event("C1", "GC"), event("A2", "GA"), event("B2", "GB"), event("C2", "GC"), event("A1", "GA")}
+	spread := []EventCount{{40, 60}, {50, 50}, {60, 40}, {45, 55}, {55, 45}}
+	//the patient is the first sample, the controls the others
+	counts := [][]EventCount{
+		append([]EventCount{{5, 3}}, spread...), //patient under the minimum reads
+		append([]EventCount{{52, 48}}, spread...),
+		append([]EventCount{{70, 30}}, spread...),
+		{{90, 10}, {40, 60}, {50, 50}, {2, 1}, {1, 2}, {0, 0}}, //2 informative controls
+		append([]EventCount{{47, 53}}, spread...),
+		{{100, 0}, {50, 50}, {50, 50}, {50, 50}, {50, 50}, {50, 50}}, //controls without spread
+	}
+	opt := OutlierOptions{MinPatientReads: 10, MinControlReads: 5, MinControls: 3, MinSD: 0.01}
+	results := ScoreOutliers("P1", events, counts, 0, []int{1, 2, 3, 4, 5}, opt)
+	byID := map[string]*OutlierResult{}
+	ids := []string{}
+	for _, r := range results {
+		byID[r.Event.ID] = r
+		ids = append(ids, r.Event.ID)
+	}
+
+	//coverage filters leave the PSI but not the scores
+	for _, id := range []string{"B1", "B2"} {
+		r := byID[id]
+		if !math.IsNaN(r.Z) || !math.IsNaN(r.P) || !math.IsNaN(r.Q) || !math.IsNaN(r.GeneP) || r.GeneRank != 0 {
+			t.Errorf("%s: z %v p %v q %v gene p %v rank %d, want NaN scores and no rank", id, r.Z, r.P, r.Q, r.GeneP, r.GeneRank)
+		}
+	}
+	if r := byID["B1"]; r.PSI != 0.625 || r.Controls != 5 {
+		t.Errorf("B1: PSI %v of %d controls, want 0.625 of 5", r.PSI, r.Controls)
+	}
+	if r := byID["B2"]; r.Controls != 2 || r.ControlMean != 0.45 {
+		t.Errorf("B2: %d controls of mean %v, want 2 of mean 0.45", r.Controls, r.ControlMean)
+	}
+
+	//the standard deviation is floored by MinSD
+	if r := byID["A1"]; r.ControlSD != 0 || r.DeltaPSI != 0.5 || math.Abs(r.Z-50) > 1e-9 {
+		t.Errorf("A1: control SD %v delta %v z %v, want 0, 0.5 and 0.5/MinSD", r.ControlSD, r.DeltaPSI, r.Z)
+	}
+	if r := byID["A2"]; math.Abs(r.ControlSD-math.Sqrt(0.00625)) > 1e-9 || math.Abs(r.Z-0.2/math.Sqrt(0.00625)) > 1e-9 {
+		t.Errorf("A2: control SD %v z %v", r.ControlSD, r.Z)
+	}
+
+	//gene p-values are the smallest of their events times the events tested
+	for _, gene := range [][2]string{{"A1", "A2"}, {"C1", "C2"}} {
+		a, b := byID[gene[0]], byID[gene[1]]
+		want := math.Min(1, 2*math.Min(a.P, b.P))
+		if a.GeneP != want || b.GeneP != want {
+			t.Errorf("gene %s: p %v and %v, gene p %v %v, want %v", a.Event.GeneID, a.P, b.P, a.GeneP, b.GeneP, want)
+		}
+	}
+	//2 * 0.73 is capped
+	if p := byID["C1"].GeneP; p != 1 {
+		t.Errorf("gene p-value %v of GC, want 1", p)
+	}
+	//genes by their p-value, events by theirs, unscored genes last
+	if got := strings.Join(ids, " "); got != "A1 A2 C2 C1 B1 B2" {
+		t.Errorf("ranked events %s, want A1 A2 C2 C1 B1 B2", got)
+	}
+	if byID["A1"].GeneRank != 1 || byID["C1"].GeneRank != 2 {
+		t.Errorf("gene ranks %d %d, want 1 2", byID["A1"].GeneRank, byID["C1"].GeneRank)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteOutliers(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 7 || !strings.HasPrefix(lines[1], "P1\t1\t") || !strings.HasPrefix(lines[5], "P1\tNA\tNA\tGB\t") {
+		t.Errorf("outlier table %q", lines)
+	}
+}
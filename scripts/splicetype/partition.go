@@ -0,0 +1,220 @@
+package splicetype
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//Partition splits the classified reads by the value of an optional tag of
+//their alignments, RG for read groups or CB for cell barcodes, into an event
+//table per value for pseudobulk tables. With groups, the values are pooled
+//by group, such as the cells of a cluster. UMI duplicates are collapsed
+//upstream by the read options, the partition only counts them
+type Partition struct {
+	Tag        string
+	Whitelist  map[string]bool   //tag values kept, all of them if nil
+	Groups     map[string]string //group of the tag values, values without group are left out; a partition per value if nil
+	Tables     map[string]*EventTable
+	Classes    map[string]map[string]float64 //reads of each splice type by partition
+	Duplicates map[string]int                //UMI duplicates by partition
+	genes      map[string]*genodatastruct.Gene
+	members    map[string]map[string]bool //tag values of each group
+	mu         sync.Mutex                 //guards Duplicates
+}
+
+//NewPartition of the reads by the tag
+func NewPartition(tag string, whitelist map[string]bool, genes map[string]*genodatastruct.Gene) *Partition {
+	return &Partition{
+		Tag:        tag,
+		Whitelist:  whitelist,
+		Tables:     map[string]*EventTable{},
+		Classes:    map[string]map[string]float64{},
+		Duplicates: map[string]int{},
+		genes:      genes,
+		members:    map[string]map[string]bool{},
+	}
+}
+
+//ReadWhitelist reads the tag values to keep, one per line. Cell Ranger
+//barcodes with the -1 suffix are given as is
+func ReadWhitelist(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	whitelist := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if v := strings.TrimSpace(scanner.Text()); v != "" && !strings.HasPrefix(v, "#") {
+			whitelist[v] = true
+		}
+	}
+	return whitelist, scanner.Err()
+}
+
+//ReadGroups reads the group of each tag value, such as a barcode and its
+//cluster, a value and its group by line separated by a tab or a comma. A
+//first line of barcode or cell is a header
+func ReadGroups(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	groups := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	first := true //first line after the comments
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sep := "\t"
+		if !strings.Contains(line, sep) {
+			sep = ","
+		}
+		fields := strings.Split(line, sep)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s: no group in line %q", path, line)
+		}
+		value, group := strings.TrimSpace(fields[0]), strings.TrimSpace(fields[1])
+		header := first && (strings.EqualFold(value, "barcode") || strings.EqualFold(value, "cell"))
+		first = false
+		if header {
+			continue
+		}
+		groups[value] = group
+	}
+	return groups, scanner.Err()
+}
+
+//name of the partition of a tag value, ok is false for the values out of
+//the whitelist or without group
+func (p *Partition) name(value string) (name string, ok bool) {
+	if p.Whitelist != nil && !p.Whitelist[value] {
+		return "", false
+	}
+	if p.Groups != nil {
+		name, ok = p.Groups[value]
+		return name, ok
+	}
+	return value, true
+}
+
+//Add a classified read to the event table of its partition. Reads without
+//the tag, out of the whitelist or without group are left out
+func (p *Partition) Add(mr *ReadMapTranscriptome) {
+	value, ok := mr.Tag(p.Tag)
+	if !ok {
+		return
+	}
+	name, ok := p.name(value)
+	if !ok {
+		return
+	}
+	et, ok := p.Tables[name]
+	if !ok {
+		et = NewEventTable(p.genes, NewJunctionCounter())
+		p.Tables[name] = et
+		p.Classes[name] = map[string]float64{}
+		p.members[name] = map[string]bool{}
+	}
+	p.members[name][value] = true
+	et.Junctions.Add(mr)
+	et.Add(mr)
+	p.Classes[name][mr.Class] += mr.Weight
+}
+
+//Reject counts the UMI duplicates of the partitions, for the Rejected
+//function of the read options
+func (p *Partition) Reject(s genodatastruct.SamRec, reason string) {
+	if reason != UMIDuplicate {
+		return
+	}
+	value, ok := s.Tag(p.Tag)
+	if !ok {
+		return
+	}
+	if name, ok := p.name(value); ok {
+		p.mu.Lock()
+		p.Duplicates[name]++
+		p.mu.Unlock()
+	}
+}
+
+//Names of the partitions in order
+func (p *Partition) Names() []string {
+	names := []string{}
+	for name := range p.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//EventTables of the partitions in the order of the names
+func (p *Partition) EventTables() []*EventTable {
+	tables := []*EventTable{}
+	for _, name := range p.Names() {
+		tables = append(tables, p.Tables[name])
+	}
+	return tables
+}
+
+//JunctionMatrix is the reads of the junctions of all the partitions (columns)
+//in each partition (rows) in the order of the names
+func (p *Partition) JunctionMatrix() ([]Junction, [][]float64) {
+	all := NewJunctionCounter()
+	for _, et := range p.Tables {
+		for j, n := range et.Junctions.Counts {
+			all.Counts[j] += n
+		}
+	}
+	junctions := all.Sorted()
+	matrix := [][]float64{}
+	for _, name := range p.Names() {
+		row := make([]float64, len(junctions))
+		for i, j := range junctions {
+			row[i] = p.Tables[name].Junctions.Counts[j]
+		}
+		matrix = append(matrix, row)
+	}
+	return junctions, matrix
+}
+
+//WritePartitionSummary writes the reads, UMI duplicates and reads of each
+//splice type of the partitions, and the number of tag values of each group
+func WritePartitionSummary(w io.Writer, p *Partition) error {
+	bw := bufio.NewWriter(w)
+	tag := strings.ToLower(p.Tag)
+	if p.Groups != nil {
+		fmt.Fprintf(bw, "group\t%s_count", tag)
+	} else {
+		fmt.Fprint(bw, tag)
+	}
+	fmt.Fprintf(bw, "\treads\tduplicates\t%s\n", strings.Join(Categories, "\t"))
+	for _, name := range p.Names() {
+		total := 0.0
+		for _, n := range p.Classes[name] {
+			total += n
+		}
+		fmt.Fprint(bw, name)
+		if p.Groups != nil {
+			fmt.Fprintf(bw, "\t%d", len(p.members[name]))
+		}
+		fmt.Fprintf(bw, "\t%s\t%d", FormatCount(total), p.Duplicates[name])
+		for _, c := range Categories {
+			fmt.Fprintf(bw, "\t%s", FormatCount(p.Classes[name][c]))
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
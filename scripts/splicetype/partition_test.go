@@ -0,0 +1,103 @@
+package splicetype
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestPartition(t *testing.T) {
+	p := NewPartition("CB", map[string]bool{"AAA": true, "BBB": true}, nil)
+	read := func(cb, ub string, start int) *ReadMapTranscriptome {
+		return &ReadMapTranscriptome{
+			Chromosome: "chr1",
+			Strand:     "+",
+			Segment:    []genodatastruct.Coor{{Start: start, End: 200}, {Start: 300, End: 350}},
+			Weight:     1,
+			Tags:       []string{"CB:Z:" + cb, "UB:Z:" + ub},
+		}
+	}
+	duplicate := func(cb string) genodatastruct.SamRec {
+		return genodatastruct.SamRec{Chromosome: "chr1", Tags: []string{"CB:Z:" + cb, "UB:Z:U1"}}
+	}
+	p.Add(read("AAA", "U1", 150))
+	p.Reject(duplicate("AAA"), UMIDuplicate)
+	p.Reject(duplicate("BBB"), ShortAnchor)  //not a duplicate
+	p.Reject(duplicate("CCC"), UMIDuplicate) //out of the whitelist
+	p.Add(read("AAA", "U1", 160))
+	p.Add(read("BBB", "U1", 150)) //same UMI, other cell
+	p.Add(read("CCC", "U2", 150)) //out of the whitelist
+	p.Add(&ReadMapTranscriptome{Chromosome: "chr1", Strand: "+", Segment: []genodatastruct.Coor{{Start: 150, End: 200}}})
+	if names := p.Names(); len(names) != 2 || names[0] != "AAA" || names[1] != "BBB" {
+		t.Fatalf("partitions %v", names)
+	}
+	if p.Duplicates["AAA"] != 1 || p.Duplicates["BBB"] != 0 {
+		t.Errorf("duplicates %v", p.Duplicates)
+	}
+	intron := Junction{"chr1", "+", genodatastruct.Coor{Start: 201, End: 299}}
+	if n := p.Tables["AAA"].Junctions.Counts[intron]; n != 2 {
+		t.Errorf("AAA has %g junction reads, want 2", n)
+	}
+	if n := p.Tables["BBB"].Junctions.Counts[intron]; n != 1 {
+		t.Errorf("BBB has %g junction reads, want 1", n)
+	}
+
+	//cells pooled by cluster, duplicates counted by cluster
+	clusters := NewPartition("CB", nil, nil)
+	clusters.Groups = map[string]string{"AAA": "T", "BBB": "T"}
+	clusters.Add(read("AAA", "U1", 150))
+	clusters.Add(read("BBB", "U1", 150))
+	clusters.Reject(duplicate("BBB"), UMIDuplicate)
+	clusters.Add(read("CCC", "U3", 150))
+	if names := clusters.Names(); len(names) != 1 || clusters.Duplicates["T"] != 1 {
+		t.Fatalf("clusters %v with duplicates %v", names, clusters.Duplicates)
+	}
+	junctions, matrix := clusters.JunctionMatrix()
+	if len(junctions) != 1 || junctions[0] != intron || matrix[0][0] != 2 {
+		t.Errorf("junction matrix %v %v", junctions, matrix)
+	}
+}
+
+func TestReadGroups(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name, content string
+		want          map[string]string
+	}{
+		{"header.csv", "barcode,cluster\nAAA-1,T cells\nBBB-1,B cells\n", map[string]string{"AAA-1": "T cells", "BBB-1": "B cells"}},
+		//the header after comments is still the first line
+		{"comment.tsv", "# clusters of run 1\n\nCell\tcluster\nAAA-1\t1\n", map[string]string{"AAA-1": "1"}},
+		{"plain.tsv", "AAA-1\t1\nBBB-1\t2\n", map[string]string{"AAA-1": "1", "BBB-1": "2"}},
+		//only the first line is a header
+		{"late.tsv", "AAA-1\t1\ncell\t2\n", map[string]string{"AAA-1": "1", "cell": "2"}},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name)
+		if err := ioutil.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		groups, err := ReadGroups(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(groups) != len(test.want) {
+			t.Errorf("%s: groups %v, want %v", test.name, groups, test.want)
+			continue
+		}
+		for value, group := range test.want {
+			if groups[value] != group {
+				t.Errorf("%s: groups %v, want %v", test.name, groups, test.want)
+				break
+			}
+		}
+	}
+	path := filepath.Join(dir, "nogroup.tsv")
+	if err := ioutil.WriteFile(path, []byte("AAA-1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadGroups(path); err == nil {
+		t.Error("line without group read")
+	}
+}
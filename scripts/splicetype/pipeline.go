@@ -0,0 +1,329 @@
+package splicetype
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+	"github.com/Hanbin/AberrantSplice/Internal/samparser"
+	"github.com/Hanbin/AberrantSplice/Internal/sjparser"
+)
+
+//MapqFilter keeps the alignments of mapping quality above min
+func MapqFilter(min int) func(genodatastruct.SamRec) bool {
+	return func(s genodatastruct.SamRec) bool {
+		return s.MAPQ > min
+	}
+}
+
+//ReadGroupFilter keeps the alignments of the read group (RG tag) passing the
+//filter, all the alignments passing it for an empty read group
+func ReadGroupFilter(rg string, filter func(genodatastruct.SamRec) bool) func(genodatastruct.SamRec) bool {
+	if rg == "" {
+		return filter
+	}
+	return func(s genodatastruct.SamRec) bool {
+		if tag, ok := s.Tag("RG"); !ok || tag != rg {
+			return false
+		}
+		return filter(s)
+	}
+}
+
+//SampleOptions are the read options of a sample of a sheet: the alignments
+//of its read group, and its library type unless empty
+func (opt ReadOptions) SampleOptions(readGroup, library string) (ReadOptions, error) {
+	opt.Filter = ReadGroupFilter(readGroup, opt.Filter)
+	if library != "" {
+		l, err := ParseLibraryType(library)
+		if err != nil {
+			return opt, err
+		}
+		opt.Library = l
+	}
+	return opt, nil
+}
+
+//Multimappers tells how the reads aligned to several loci (NH above 1) are
+//counted
+type Multimappers int
+
+const (
+	//UniqueMultimappers leaves the multimappers to the filter, each kept
+	//alignment counts a read
+	UniqueMultimappers Multimappers = iota
+	//FractionMultimappers keeps the multimappers, each alignment counting
+	//1/NH of the read
+	FractionMultimappers
+	//EMMultimappers keeps the multimappers and shares each read among its
+	//alignments by the expected abundance of their loci
+	EMMultimappers
+)
+
+//ParseMultimappers reads the multimapper mode of its name: unique, fraction
+//or em
+func ParseMultimappers(name string) (Multimappers, error) {
+	switch strings.ToLower(name) {
+	case "", "unique":
+		return UniqueMultimappers, nil
+	case "fraction":
+		return FractionMultimappers, nil
+	case "em":
+		return EMMultimappers, nil
+	}
+	return UniqueMultimappers, fmt.Errorf("unknown multimapper mode %q, want unique, fraction or em", name)
+}
+
+//String is the name of the multimapper mode
+func (m Multimappers) String() string {
+	switch m {
+	case FractionMultimappers:
+		return "fraction"
+	case EMMultimappers:
+		return "em"
+	}
+	return "unique"
+}
+
+//Set the multimapper mode of its name, as a flag value
+func (m *Multimappers) Set(name string) error {
+	mode, err := ParseMultimappers(name)
+	if err != nil {
+		return err
+	}
+	*m = mode
+	return nil
+}
+
+//ReadOptions select the alignments of a sample and weigh them
+type ReadOptions struct {
+	Filter         func(genodatastruct.SamRec) bool
+	Library        LibraryType //read strands
+	Multimappers   Multimappers
+	Anchors        AnchorOptions
+	SkipDuplicates bool   //leave out the reads flagged as duplicates (0x400)
+	UMITag         string //collapse the reads of the same alignment and UMI of this optional field, no deduplication if empty
+	CellTag        string //optional field of the cell barcode separating the UMIs of different cells
+	//Rejected, if set, is given each read left out with the reason: Unmapped,
+	//Filtered, UMIDuplicate or the failed anchor checks, comma separated. It
+	//is called from the reading goroutines and must be safe for concurrent use
+	Rejected func(s genodatastruct.SamRec, reason string)
+}
+
+//Reasons a read is left out before classification
+const (
+	Unmapped     = "unmapped"
+	Filtered     = "filtered"     //failed the filter of the read options
+	UMIDuplicate = "umiDuplicate" //collapsed into another read of its UMI
+)
+
+//DefaultReadOptions keeps the alignments of mapping quality above 30 of a
+//forward library, multimappers left to the mapping quality, with the
+//default anchors
+func DefaultReadOptions() ReadOptions {
+	return ReadOptions{Filter: MapqFilter(30), Anchors: DefaultAnchorOptions}
+}
+
+//filter of the alignments. Kept multimappers pass the filter on all but
+//their mapping quality, low by definition
+func (opt ReadOptions) filter() func(genodatastruct.SamRec) bool {
+	filter := opt.Filter
+	if filter == nil {
+		filter = func(genodatastruct.SamRec) bool { return true }
+	}
+	return func(s genodatastruct.SamRec) bool {
+		if opt.SkipDuplicates && s.Flag&0x400 != 0 {
+			return false
+		}
+		if opt.Multimappers != UniqueMultimappers && s.NH() > 1 {
+			s.MAPQ = 255
+		}
+		return filter(s)
+	}
+}
+
+//ClassifyAlignments runs nworker read classification workers on the
+//alignments selected by the options, hands every classified read to collect
+//and returns the reads of each splice type and the reads left out by reason:
+//the junctions failing the anchor checks and the UMI duplicates.
+//Multimappers are weighted after all the unique reads are seen in EM mode
+func ClassifyAlignments(sam string, opt ReadOptions, genes map[string]*genodatastruct.Gene, index map[string]*GeneMapIndex, nworker int, collect func(*ReadMapTranscriptome)) (map[string]float64, map[string]int) {
+	var dropped func(genodatastruct.SamRec)
+	if opt.Rejected != nil {
+		dropped = func(s genodatastruct.SamRec) {
+			if s.Flag&0x4 != 0 {
+				opt.Rejected(s, Unmapped)
+			} else {
+				opt.Rejected(s, Filtered)
+			}
+		}
+	}
+	samchan := samparser.ParseSamAll(sam, opt.filter(), dropped)
+	var dedup *samparser.UMIDedup
+	if opt.UMITag != "" {
+		dedup = &samparser.UMIDedup{Tag: opt.UMITag, CellTag: opt.CellTag}
+		if opt.Rejected != nil {
+			dedup.Duplicate = func(s genodatastruct.SamRec) { opt.Rejected(s, UMIDuplicate) }
+		}
+		samchan = dedup.Collapse(samchan)
+	}
+	anchors := NewAnchorChecker(opt.Anchors, genes)
+	var out []chan *ReadMapTranscriptome
+	for i := 0; i < nworker; i++ {
+		o := make(chan *ReadMapTranscriptome)
+		out = append(out, o)
+		worker := RMTConstructor{
+			In:       samchan,
+			Out:      o,
+			Index:    index,
+			Genes:    genes,
+			Library:  opt.Library,
+			Anchors:  anchors,
+			Rejected: opt.Rejected,
+		}
+		go worker.Construct()
+	}
+	//merge chan
+	var wg sync.WaitGroup
+	wg.Add(nworker)
+	mergechan := make(chan *ReadMapTranscriptome)
+	output := func(c chan *ReadMapTranscriptome) {
+		for v := range c {
+			mergechan <- v
+		}
+		wg.Done()
+	}
+	for _, o := range out {
+		go output(o)
+	}
+	go func() {
+		wg.Wait()
+		close(mergechan)
+	}()
+	//take results
+	classes := map[string]float64{}
+	rejected := map[string]int{}
+	unique := map[string]float64{}
+	multi := []*ReadMapTranscriptome{}
+	for mr := range mergechan {
+		if len(mr.Rejected) > 0 {
+			for _, reason := range mr.Rejected {
+				rejected[reason]++
+			}
+			continue
+		}
+		if mr.NH > 1 && opt.Multimappers == FractionMultimappers {
+			mr.Weight = 1 / float64(mr.NH)
+		}
+		if opt.Multimappers == EMMultimappers {
+			if mr.NH > 1 {
+				multi = append(multi, mr)
+				continue
+			}
+			unique[mr.locus()] += mr.Weight
+		}
+		collect(mr)
+		classes[mr.Class] += mr.Weight
+	}
+	WeighMultimappers(multi, unique)
+	for _, mr := range multi {
+		collect(mr)
+		classes[mr.Class] += mr.Weight
+	}
+	if dedup != nil {
+		rejected[UMIDuplicate] = dedup.Duplicates
+	}
+	return classes, rejected
+}
+
+//locus of an alignment for the multimapper EM: the gene of its transcripts,
+//else a gene it overlaps, else its chromosome
+func (mr *ReadMapTranscriptome) locus() string {
+	for _, trancoors := range mr.MapTran {
+		if len(trancoors) > 0 {
+			return trancoors[0].GeneID
+		}
+	}
+	if len(mr.GeneLoci) > 0 && mr.GeneLoci[0] != "Intergenic" && mr.GeneLoci[0] != "No Chromosome" {
+		return mr.GeneLoci[0]
+	}
+	return "intergenic:" + mr.Chromosome
+}
+
+const (
+	emIterations = 100
+	emTolerance  = 1e-4
+)
+
+//WeighMultimappers shares each multimapping read among its alignments by
+//expectation maximization. The abundance of a locus is its unique reads
+//plus the weights of the multimappers aligned to it, and the alignments of
+//a read are weighted by the abundance of their loci until the weights
+//settle. The alignments of a read share its name
+func WeighMultimappers(multi []*ReadMapTranscriptome, unique map[string]float64) {
+	reads := map[string][]int{}
+	names := []string{}
+	loci := make([]string, len(multi))
+	for i, mr := range multi {
+		if _, ok := reads[mr.Name]; !ok {
+			names = append(names, mr.Name)
+		}
+		reads[mr.Name] = append(reads[mr.Name], i)
+		loci[i] = mr.locus()
+	}
+	for _, name := range names {
+		for _, i := range reads[name] {
+			multi[i].Weight = 1 / float64(len(reads[name]))
+		}
+	}
+	for iter := 0; iter < emIterations; iter++ {
+		abundance := map[string]float64{}
+		for locus, n := range unique {
+			abundance[locus] = n
+		}
+		for i, mr := range multi {
+			abundance[loci[i]] += mr.Weight
+		}
+		change := 0.0
+		for _, name := range names {
+			total := 0.0
+			for _, i := range reads[name] {
+				total += abundance[loci[i]]
+			}
+			for _, i := range reads[name] {
+				w := abundance[loci[i]] / total
+				change = math.Max(change, math.Abs(w-multi[i].Weight))
+				multi[i].Weight = w
+			}
+		}
+		if change < emTolerance {
+			return
+		}
+	}
+}
+
+//SampleEvents classifies the alignments (format sam) or the junction records
+//(sj or junc) of a sample into a new event table. The read options apply to
+//alignments only, whose classified reads are also handed to the collect
+//functions
+func SampleEvents(input, format string, opt ReadOptions, genes map[string]*genodatastruct.Gene, index map[string]*GeneMapIndex, nworker int,
+	collect ...func(*ReadMapTranscriptome)) *EventTable {
+	junctions := NewJunctionCounter()
+	events := NewEventTable(genes, junctions)
+	if format == "sam" {
+		ClassifyAlignments(input, opt, genes, index, nworker, func(mr *ReadMapTranscriptome) {
+			junctions.Add(mr)
+			events.Add(mr)
+			for _, c := range collect {
+				c(mr)
+			}
+		})
+		return events
+	}
+	for _, rec := range sjparser.ParseJunctions(input, format) {
+		events.AddJunction(rec, index)
+	}
+	return events
+}
@@ -0,0 +1,74 @@
+package splicetype
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+	"github.com/Hanbin/AberrantSplice/Internal/readfilter"
+)
+
+func TestWeighMultimappers(t *testing.T) {
+	align := func(name, chromosome string, loci ...string) *ReadMapTranscriptome {
+		return &ReadMapTranscriptome{Name: name, Chromosome: chromosome, GeneLoci: loci, NH: 2, Weight: 1}
+	}
+	//a read of two genes, one of nine unique reads, and a read of two
+	//chromosomes without gene nor unique reads
+	multi := []*ReadMapTranscriptome{
+		align("r1", "chr1", "A"),
+		align("r1", "chr1", "B"),
+		align("r2", "chr2"),
+		align("r2", "chr3"),
+	}
+	WeighMultimappers(multi, map[string]float64{"A": 9, "B": 1})
+	//the share w of A settles at (9+w)/11
+	want := []float64{0.9, 0.1, 0.5, 0.5}
+	for i, mr := range multi {
+		if math.Abs(mr.Weight-want[i]) > 1e-3 {
+			t.Errorf("alignment %d of %s weighs %g, want %g", i, mr.Name, mr.Weight, want[i])
+		}
+	}
+}
+
+func TestClassifyAlignmentsUnmapped(t *testing.T) {
+	genes := map[string]*genodatastruct.Gene{"G": graphGene("+", []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 300, End: 400}})}
+	sam := filepath.Join(t.TempDir(), "paired.sam")
+	lines := []string{
+		"pair\t99\tchr1\t150\t60\t51M99N51M\t=\t150\t252\t*\t*",
+		"pair\t147\tchr1\t150\t60\t51M99N51M\t=\t150\t-252\t*\t*",
+		"mate\t73\tchr1\t150\t60\t51M99N51M\t=\t150\t0\t*\t*",
+		"mate\t133\tchr1\t150\t0\t*\t=\t150\t0\tACGT\tFFFF",
+		"both\t77\t*\t0\t0\t*\t*\t0\t0\tACGT\tFFFF",
+		"both\t141\t*\t0\t0\t*\t*\t0\t0\tACGT\tFFFF",
+	}
+	if err := ioutil.WriteFile(sam, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opt := DefaultReadOptions()
+	opt.Library = SecondStrand
+	//unmapped records pass a filter without mapping quality
+	filter, err := readfilter.Compile("!secondary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt.Filter = filter
+	var mu sync.Mutex
+	rejected := map[string]int{}
+	opt.Rejected = func(s genodatastruct.SamRec, reason string) {
+		mu.Lock()
+		rejected[reason]++
+		mu.Unlock()
+	}
+	reads := 0
+	classes, _ := ClassifyAlignments(sam, opt, genes, SortGeneMap(genes), 2, func(*ReadMapTranscriptome) { reads++ })
+	if reads != 3 || classes["normal"] != 3 {
+		t.Errorf("%d reads classified %v, want the 3 mapped records normal", reads, classes)
+	}
+	if len(rejected) != 1 || rejected[Unmapped] != 3 {
+		t.Errorf("rejected %v, want the 3 unmapped records", rejected)
+	}
+}
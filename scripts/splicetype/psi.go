@@ -0,0 +1,90 @@
+package splicetype
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//Z95 is the z score of a two sided 95% confidence interval
+const Z95 = 1.959964
+
+//PSI (percent spliced-in) of an event as a fraction in [0, 1] with its
+//confidence interval. Values are NaN when the event has no informative read
+type PSI struct {
+	Value, Low, High float64
+}
+
+//PSI of the event. Inclusion and exclusion reads are divided by the number of
+//junctions of their isoform, so an exon skipping event compares the reads per
+//junction of the inclusion isoform to those of the skipping junction. The
+//interval is the Wilson score interval on the normalized counts
+func (e *Event) PSI(z float64) PSI {
+	inclusion, exclusion := e.Normalize(e.Inclusion, e.Exclusion)
+	return WilsonPSI(inclusion, exclusion, z)
+}
+
+//Normalize inclusion and exclusion reads by the junctions of their isoform,
+//counted over all the junctions gathered for the event
+func (e *Event) Normalize(inclusion, exclusion float64) (float64, float64) {
+	incl, excl := inclusion, exclusion
+	if n := junctionPositions(e.InclusionJunctions); n > 1 {
+		incl /= float64(n)
+	}
+	if n := junctionPositions(e.ExclusionJunctions); n > 1 {
+		excl /= float64(n)
+	}
+	return incl, excl
+}
+
+//junctionPositions is the number of junctions a read of the isoform goes
+//through, the longest chain of junctions not overlapping each other.
+//Overlapping junctions are alternatives at the same position, such as the
+//introns of two transcripts before the same exon, and their reads add up
+func junctionPositions(junctions []genodatastruct.Coor) int {
+	sorted := append([]genodatastruct.Coor{}, junctions...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].End < sorted[j].End })
+	n, end := 0, 0
+	for _, j := range sorted {
+		if n == 0 || j.Start > end {
+			n++
+			end = j.End
+		}
+	}
+	return n
+}
+
+//WilsonPSI computes the ratio of inclusion to the sum of inclusion and exclusion
+//with the Wilson score interval at the z score
+func WilsonPSI(inclusion, exclusion, z float64) PSI {
+	n := inclusion + exclusion
+	if n <= 0 {
+		return PSI{math.NaN(), math.NaN(), math.NaN()}
+	}
+	p := inclusion / n
+	z2 := z * z
+	center := (p + z2/(2*n)) / (1 + z2/n)
+	half := z / (1 + z2/n) * math.Sqrt(p*(1-p)/n+z2/(4*n*n))
+	return PSI{p, math.Max(0, center-half), math.Min(1, center+half)}
+}
+
+//DeltaPSI of event b relative to event a, NaN if either one is not informative
+func DeltaPSI(a, b PSI) float64 {
+	return b.Value - a.Value
+}
+
+//FormatRatio prints a ratio for tables, NA for NaN
+func FormatRatio(v float64) string {
+	if math.IsNaN(v) {
+		return "NA"
+	}
+	return strconv.FormatFloat(v, 'f', 4, 64)
+}
+
+//FormatCount prints a read count for tables, whole counts as integers and
+//counts of fractional multimappers with two decimals at most
+func FormatCount(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,77 @@
+package splicetype
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestEventPSI(t *testing.T) {
+	//exon skipping: 2 inclusion junctions with 20 reads against 10 skipping reads
+	e := Event{Inclusion: 20, Exclusion: 10,
+		InclusionJunctions: []genodatastruct.Coor{{Start: 201, End: 299}, {Start: 401, End: 499}}, ExclusionJunctions: []genodatastruct.Coor{{Start: 201, End: 499}}}
+	psi := e.PSI(Z95)
+	if math.Abs(psi.Value-0.5) > 1e-9 {
+		t.Errorf("psi %f, want 0.5", psi.Value)
+	}
+	if !(psi.Low < psi.Value && psi.Value < psi.High) || psi.Low < 0 || psi.High > 1 {
+		t.Errorf("interval [%f, %f] does not bracket %f", psi.Low, psi.High, psi.Value)
+	}
+	//more reads give a narrower interval
+	wide := WilsonPSI(5, 5, Z95)
+	narrow := WilsonPSI(500, 500, Z95)
+	if narrow.High-narrow.Low >= wide.High-wide.Low {
+		t.Errorf("interval does not narrow with coverage")
+	}
+	if empty := (&Event{}).PSI(Z95); !math.IsNaN(empty.Value) || FormatRatio(empty.Value) != "NA" {
+		t.Errorf("uninformative event psi %f", empty.Value)
+	}
+	if all := WilsonPSI(10, 0, Z95); all.Value != 1 || math.Abs(all.High-1) > 1e-9 {
+		t.Errorf("full inclusion psi %+v", all)
+	}
+}
+
+func TestEventNormalize(t *testing.T) {
+	//the exon 300-400 skipped in two transcripts of other flanking exons
+	t1 := &genodatastruct.Transcript{TranscriptName: "T1", Chromosome: "chr1", Strand: "+", Coordinate: genodatastruct.Coor{Start: 100, End: 600},
+		Exons: []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 300, End: 400}, {Start: 500, End: 600}}}
+	t2 := &genodatastruct.Transcript{TranscriptName: "T2", Chromosome: "chr1", Strand: "+", Coordinate: genodatastruct.Coor{Start: 100, End: 700},
+		Exons: []genodatastruct.Coor{{Start: 100, End: 150}, {Start: 300, End: 400}, {Start: 600, End: 700}}}
+	for _, tr := range []*genodatastruct.Transcript{t1, t2} {
+		tr.Introns = tr.GenerateIntrons()
+	}
+	genes := map[string]*genodatastruct.Gene{"G1": {GeneName: "ONE", Chromosome: "chr1", Strand: "+", Coordinate: genodatastruct.Coor{Start: 100, End: 700},
+		Transcripts: []*genodatastruct.Transcript{t1, t2}}}
+	junctions := NewJunctionCounter()
+	events := NewEventTable(genes, junctions)
+	add := func(cigar string, pos, n int) {
+		for i := 0; i < n; i++ {
+			mr := NewReadMapTranscriptome(genodatastruct.SamRec{Chromosome: "chr1", Flag: 0, Pos: pos, CIGAR: cigar})
+			mr.GeneLoci = []string{"G1"}
+			mr.MapToTran(genes)
+			mr.Class = mr.SpliceType(genes)
+			junctions.Add(mr)
+			events.Add(mr)
+		}
+	}
+	add("21M299N21M", 180, 4)  //T1 skipping 201-499
+	add("21M449N21M", 130, 6)  //T2 skipping 151-599
+	add("21M99N21M", 180, 10)  //T1 inclusion 201-299
+	add("21M99N21M", 380, 10)  //T1 inclusion 401-499
+	add("21M149N21M", 130, 10) //T2 inclusion 151-299
+	add("21M199N21M", 380, 10) //T2 inclusion 401-599
+	found := events.Events(1)
+	if len(found) != 1 {
+		t.Fatalf("%d events, want 1", len(found))
+	}
+	e := found[0]
+	if len(e.InclusionJunctions) != 4 || len(e.ExclusionJunctions) != 2 {
+		t.Fatalf("junctions %v and %v", e.InclusionJunctions, e.ExclusionJunctions)
+	}
+	//40 inclusion reads over the two sides of the exon against 10 skipping reads
+	inclusion, exclusion := e.Normalize(e.Inclusion, e.Exclusion)
+	if inclusion != 20 || exclusion != 10 {
+		t.Errorf("normalized %v/%v, want 20/10", inclusion, exclusion)
+	}
+}
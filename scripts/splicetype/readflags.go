@@ -0,0 +1,52 @@
+package splicetype
+
+import (
+	"flag"
+	"log"
+
+	"github.com/Hanbin/AberrantSplice/Internal/readfilter"
+)
+
+//ReadFlags defines the flags of the read options shared by the commands on
+//the flag set: -filter, the anchor checks, -skip-duplicates, -umi-dedup,
+//-umi-cell-tag and -multimappers. The options start from the defaults with
+//the default filter expression and are set as the flags are parsed
+func ReadFlags(fs *flag.FlagSet) *ReadOptions {
+	opt := DefaultReadOptions()
+	filter := &filterFlag{opt: &opt}
+	if err := filter.Set(readfilter.Default); err != nil {
+		log.Fatal(err)
+	}
+	fs.Var(filter, "filter", "alignments kept, an `expression` such as 'mapq>=20 && !secondary && nm<=4 && tag(NH)==1' "+
+		"of the fields mapq, flag, pos, nh, nm, as, chr, name, cigar and tag(XX), the flag bits paired, proper, reverse, read1, read2, secondary, qcfail, duplicate, supplementary and spliced, "+
+		"compared by == != < <= > >= and combined by && || ! ( )")
+	fs.IntVar(&opt.Anchors.MinAnnotated, "min-anchor-annotated", opt.Anchors.MinAnnotated, "minimum aligned bases on each side of an annotated junction of a split read")
+	fs.IntVar(&opt.Anchors.MinNovel, "min-anchor", opt.Anchors.MinNovel, "minimum aligned bases on each side of a novel junction of a split read")
+	fs.IntVar(&opt.Anchors.MismatchWindow, "anchor-mismatch-window", opt.Anchors.MismatchWindow, "bases of each anchor next to a junction checked for mismatches by the MD tag, 0 for no check")
+	fs.IntVar(&opt.Anchors.MaxMismatches, "max-anchor-mismatches", opt.Anchors.MaxMismatches, "mismatches allowed in the -anchor-mismatch-window of an anchor")
+	fs.BoolVar(&opt.SkipDuplicates, "skip-duplicates", false, "leave out the reads flagged as PCR or optical duplicates (0x400)")
+	fs.StringVar(&opt.UMITag, "umi-dedup", "", "optional field of the UMI (UB, RX) to collapse the duplicates of coordinate sorted alignments by position, strand, junctions and UMI, with directional UMI error correction")
+	opt.CellTag = "CB"
+	fs.StringVar(&opt.CellTag, "umi-cell-tag", opt.CellTag, "optional field of the cell barcode for -umi-dedup, reads of different cells are never duplicates")
+	fs.Var(&opt.Multimappers, "multimappers", "`mode` of the multimapping reads (NH tag above 1): unique leaves them to the mapping quality filter, fraction counts 1/NH of a read per alignment, em shares a read by the abundance of its loci")
+	return &opt
+}
+
+//filterFlag compiles the -filter expression into the filter of the options
+type filterFlag struct {
+	expr string
+	opt  *ReadOptions
+}
+
+func (f *filterFlag) String() string {
+	return f.expr
+}
+
+func (f *filterFlag) Set(expr string) error {
+	filter, err := readfilter.Compile(expr)
+	if err != nil {
+		return err
+	}
+	f.expr, f.opt.Filter = expr, filter
+	return nil
+}
@@ -0,0 +1,155 @@
+package splicetype
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//ReadReport is how a read was classified: its segments, the genes they
+//overlap, and the exons and introns hit in each transcript of the genes
+type ReadReport struct {
+	Name        string          `json:"name"`
+	Chromosome  string          `json:"chromosome"`
+	Strand      string          `json:"strand"`
+	Segments    [][2]int        `json:"segments"` //start and end of the aligned segments
+	GeneLoci    []string        `json:"gene_loci"`
+	Class       string          `json:"class"`
+	Weight      float64         `json:"weight"`
+	Transcripts []TranscriptHit `json:"transcripts"`
+}
+
+//TranscriptHit is a read against a transcript, the exon and intron numbers
+//are given for each segment of the read as the 0-based indices of the TranCoor
+//in the Exons and Introns of the transcript
+type TranscriptHit struct {
+	GeneID         string  `json:"gene_id"`
+	TranscriptName string  `json:"transcript"`
+	ExonID         [][]int `json:"exons"`
+	IntronID       [][]int `json:"introns"`
+	Class          string  `json:"class"`      //category of the read against this transcript alone
+	Compatible     bool    `json:"compatible"` //segments within the exons and junctions among the introns of the transcript
+}
+
+//NewReadReport of a classified read
+func NewReadReport(mr *ReadMapTranscriptome, genes map[string]*genodatastruct.Gene) ReadReport {
+	r := ReadReport{
+		Name:        mr.Name,
+		Chromosome:  mr.Chromosome,
+		Strand:      mr.Strand,
+		GeneLoci:    mr.GeneLoci,
+		Class:       mr.Class,
+		Weight:      mr.Weight,
+		Transcripts: []TranscriptHit{},
+	}
+	for _, seg := range mr.Segment {
+		r.Segments = append(r.Segments, [2]int{seg.Start, seg.End})
+	}
+	if r.GeneLoci == nil {
+		r.GeneLoci = []string{}
+	}
+	junctions := mr.Junctions()
+	for _, trancoors := range mr.MapTran {
+		if len(trancoors) == 0 {
+			continue
+		}
+		hit := TranscriptHit{GeneID: trancoors[0].GeneID, TranscriptName: trancoors[0].TranscriptName, ExonID: [][]int{}, IntronID: [][]int{}, Class: "No Class"}
+		for _, tc := range trancoors {
+			hit.ExonID = append(hit.ExonID, append([]int{}, tc.ExonID...))
+			hit.IntronID = append(hit.IntronID, append([]int{}, tc.IntronID...))
+		}
+		if gene, ok := genes[hit.GeneID]; ok {
+			if t := gene.Transcript(hit.TranscriptName); t != nil {
+				if len(mr.Segment) > 1 {
+					hit.Class, _ = classifyTran(mr.Segment, trancoors, t)
+				}
+				hit.Compatible = mr.fitsTranscript(t, trancoors, junctions)
+			}
+		}
+		r.Transcripts = append(r.Transcripts, hit)
+	}
+	return r
+}
+
+//ReadReportWriter writes the report of each classified read, as JSON Lines
+//or as a table with a line per read and transcript
+type ReadReportWriter struct {
+	genes map[string]*genodatastruct.Gene
+	bw    *bufio.Writer
+	enc   *json.Encoder
+	err   error
+}
+
+//NewReadReportWriter writes JSON Lines to w if jsonLines is true and a tab
+//separated table with its header otherwise
+func NewReadReportWriter(w io.Writer, jsonLines bool, genes map[string]*genodatastruct.Gene) (*ReadReportWriter, error) {
+	rw := &ReadReportWriter{genes: genes, bw: bufio.NewWriter(w)}
+	if jsonLines {
+		rw.enc = json.NewEncoder(rw.bw)
+		return rw, nil
+	}
+	_, err := fmt.Fprintln(rw.bw, "read\tchromosome\tstrand\tsegments\tgene_loci\tclass\tweight\tgene_id\ttranscript\texons\tintrons\ttranscript_class\tcompatible")
+	return rw, err
+}
+
+//Add writes the report of a read. The first error is kept for Close
+func (rw *ReadReportWriter) Add(mr *ReadMapTranscriptome) {
+	if rw.err != nil {
+		return
+	}
+	r := NewReadReport(mr, rw.genes)
+	if rw.enc != nil {
+		rw.err = rw.enc.Encode(r)
+		return
+	}
+	segments := []string{}
+	for _, s := range r.Segments {
+		segments = append(segments, fmt.Sprintf("%d-%d", s[0], s[1]))
+	}
+	read := strings.Join([]string{r.Name, r.Chromosome, r.Strand, strings.Join(segments, ","), orDot(strings.Join(r.GeneLoci, ",")),
+		orDot(r.Class), strconv.FormatFloat(r.Weight, 'g', -1, 64)}, "\t")
+	if len(r.Transcripts) == 0 {
+		_, rw.err = fmt.Fprintln(rw.bw, read+"\t.\t.\t.\t.\t.\t.")
+		return
+	}
+	for _, hit := range r.Transcripts {
+		if _, rw.err = fmt.Fprintf(rw.bw, "%s\t%s\t%s\t%s\t%s\t%s\t%t\n", read, hit.GeneID, hit.TranscriptName,
+			segmentIDs(hit.ExonID), segmentIDs(hit.IntronID), hit.Class, hit.Compatible); rw.err != nil {
+			return
+		}
+	}
+}
+
+//Close flushes the reports and returns the first error of the writer
+func (rw *ReadReportWriter) Close() error {
+	if rw.err != nil {
+		return rw.err
+	}
+	return rw.bw.Flush()
+}
+
+//segmentIDs joins the numbers of a segment by commas and the segments by
+//semicolons, . for a segment without any
+func segmentIDs(ids [][]int) string {
+	segments := []string{}
+	for _, seg := range ids {
+		nums := []string{}
+		for _, id := range seg {
+			nums = append(nums, strconv.Itoa(id))
+		}
+		segments = append(segments, orDot(strings.Join(nums, ",")))
+	}
+	return strings.Join(segments, ";")
+}
+
+func orDot(s string) string {
+	if s == "" {
+		return "."
+	}
+	return s
+}
@@ -0,0 +1,71 @@
+package splicetype
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestReadReport(t *testing.T) {
+	//T1 has the middle exon 300-400 skipped by the read, T2 does not
+	t1 := &genodatastruct.Transcript{TranscriptName: "T1", Chromosome: "chr1", Strand: "+", Coordinate: genodatastruct.Coor{Start: 100, End: 600},
+		Exons: []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 300, End: 400}, {Start: 500, End: 600}}}
+	t2 := &genodatastruct.Transcript{TranscriptName: "T2", Chromosome: "chr1", Strand: "+", Coordinate: genodatastruct.Coor{Start: 100, End: 600},
+		Exons: []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 500, End: 600}}}
+	for _, tr := range []*genodatastruct.Transcript{t1, t2} {
+		tr.Introns = tr.GenerateIntrons()
+	}
+	genes := map[string]*genodatastruct.Gene{"G1": {Chromosome: "chr1", Strand: "+", Coordinate: genodatastruct.Coor{Start: 100, End: 600},
+		Transcripts: []*genodatastruct.Transcript{t1, t2}}}
+	mr := NewReadMapTranscriptome(genodatastruct.SamRec{QName: "r1", Flag: 0x41, Chromosome: "chr1", Pos: 151, CIGAR: "50M299N51M"})
+	mr.GeneLoci = []string{"G1"}
+	mr.MapToTran(genes)
+	mr.Class = mr.SpliceType(genes)
+
+	r := NewReadReport(mr, genes)
+	if r.Name != "r1/1" || r.Class != "normal" || len(r.Transcripts) != 2 {
+		t.Fatalf("report %+v", r)
+	}
+	want := []struct {
+		class      string
+		compatible bool
+	}{{"exonSkipping", false}, {"normal", true}}
+	for i, hit := range r.Transcripts {
+		if hit.Class != want[i].class || hit.Compatible != want[i].compatible {
+			t.Errorf("%s: class %s compatible %t, want %s %t", hit.TranscriptName, hit.Class, hit.Compatible, want[i].class, want[i].compatible)
+		}
+	}
+
+	var b bytes.Buffer
+	rw, err := NewReadReportWriter(&b, false, genes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw.Add(mr)
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 || lines[1] != "r1/1\tchr1\t+\t151-200,500-550\tG1\tnormal\t1\tG1\tT1\t0;2\t.;.\texonSkipping\tfalse" {
+		t.Errorf("table\n%s", b.String())
+	}
+
+	b.Reset()
+	if rw, err = NewReadReportWriter(&b, true, genes); err != nil {
+		t.Fatal(err)
+	}
+	rw.Add(mr)
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var decoded ReadReport
+	if err := json.Unmarshal(b.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Segments[1] != [2]int{500, 550} || len(decoded.Transcripts[1].ExonID) != 2 || decoded.Transcripts[1].ExonID[1][0] != 1 {
+		t.Errorf("JSON %s", b.String())
+	}
+}
@@ -0,0 +1,271 @@
+package splicetype
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//Frame effect of a shifted splice site on the coding sequence
+const (
+	InFrame    = "inFrame"
+	FrameShift = "frameShift"
+	NonCoding  = "nonCoding" //site outside the CDS span
+	NoCDS      = "NA"        //transcript without CDS annotation
+)
+
+//SiteShift is a junction end landing away from the annotated exon boundary.
+//A site inside the exon truncates it (truncExon) while a site inside the
+//adjacent intron extends it (extendExon)
+type SiteShift struct {
+	Type           string //truncExon or extendExon
+	Site           string //donor or acceptor
+	GeneID         string
+	TranscriptName string
+	Exon           genodatastruct.Coor //the annotated exon
+	Position       int                 //observed splice site, the exonic base next to the junction
+	Annotated      int                 //annotated splice site
+	Bases          int                 //bases lost (truncExon) or gained (extendExon)
+	Frame          string
+	Junction       genodatastruct.Coor //the observed junction
+}
+
+//Region of the exon lost by truncation or gained by extension
+func (s SiteShift) Region() genodatastruct.Coor {
+	if s.Type == "truncExon" {
+		if s.Position < s.Annotated {
+			return genodatastruct.Coor{Start: s.Position + 1, End: s.Annotated}
+		}
+		return genodatastruct.Coor{Start: s.Annotated, End: s.Position - 1}
+	}
+	if s.Position > s.Annotated {
+		return genodatastruct.Coor{Start: s.Annotated + 1, End: s.Position}
+	}
+	return genodatastruct.Coor{Start: s.Position, End: s.Annotated - 1}
+}
+
+//Canonical junction using the annotated splice site instead of the observed one
+func (s SiteShift) Canonical() genodatastruct.Coor {
+	if s.Position == s.Junction.Start-1 {
+		return genodatastruct.Coor{Start: s.Annotated + 1, End: s.Junction.End}
+	}
+	return genodatastruct.Coor{Start: s.Junction.Start, End: s.Annotated - 1}
+}
+
+//siteShifts compares both ends of every junction of the read to the
+//exon boundaries of a transcript. Segments are in transcript order
+func siteShifts(segments []genodatastruct.Coor, trancoors []TranCoor, t *genodatastruct.Transcript) []SiteShift {
+	result := []SiteShift{}
+	forward := t.Strand == "+"
+	for i := 0; i < len(segments)-1; i++ {
+		donor, acceptor := segments[i].End, segments[i+1].Start
+		if !forward {
+			donor, acceptor = segments[i].Start, segments[i+1].End
+		}
+		junction := gap(segments[i], segments[i+1])
+		if shift, ok := shiftedSite(t, segments[i], donor, "donor", forward); ok {
+			shift.Junction = junction
+			result = append(result, shift)
+		}
+		if shift, ok := shiftedSite(t, segments[i+1], acceptor, "acceptor", forward); ok {
+			shift.Junction = junction
+			result = append(result, shift)
+		}
+	}
+	for i := range result {
+		result[i].GeneID = trancoors[0].GeneID
+		result[i].TranscriptName = t.TranscriptName
+		result[i].Frame = frameEffect(t, result[i])
+	}
+	return result
+}
+
+//shiftedSite checks a single junction end at pos of the segment seg
+func shiftedSite(t *genodatastruct.Transcript, seg genodatastruct.Coor, pos int, site string, forward bool) (SiteShift, bool) {
+	//the boundary of an exon facing the junction
+	boundary := func(exon genodatastruct.Coor) int {
+		if (site == "donor") == forward {
+			return exon.End
+		}
+		return exon.Start
+	}
+	point := genodatastruct.Coor{Start: pos, End: pos}
+	for _, exon := range t.Exons {
+		if !point.Inside(exon) {
+			continue
+		}
+		if boundary(exon) == pos {
+			return SiteShift{}, false
+		}
+		return SiteShift{Type: "truncExon", Site: site, Exon: exon, Position: pos, Annotated: boundary(exon), Bases: abs(boundary(exon) - pos)}, true
+	}
+	//site in an intron: an extension of the exon the segment comes from
+	for _, exon := range t.Exons {
+		b := boundary(exon)
+		extended := genodatastruct.Coor{Start: b, End: pos}
+		if pos < b {
+			extended = genodatastruct.Coor{Start: pos, End: b}
+		}
+		if !seg.Intersect(exon) || !extended.Inside(seg) {
+			continue
+		}
+		return SiteShift{Type: "extendExon", Site: site, Exon: exon, Position: pos, Annotated: b, Bases: abs(b - pos)}, true
+	}
+	return SiteShift{}, false
+}
+
+//frameEffect of the shift, only meaningful for a coding transcript
+func frameEffect(t *genodatastruct.Transcript, shift SiteShift) string {
+	span, ok := t.CodingSpan()
+	if !ok {
+		return NoCDS
+	}
+	if shift.Annotated < span.Start || shift.Annotated > span.End {
+		return NonCoding
+	}
+	if shift.Bases%3 == 0 {
+		return InFrame
+	}
+	return FrameShift
+}
+
+//extensionExplained is true when every segment overlapping an intron does so
+//only by the extended part of an exon
+func extensionExplained(segments []genodatastruct.Coor, trancoors []TranCoor, shifts []SiteShift) bool {
+	for i, tc := range trancoors {
+		switch tc.ClassSeg() {
+		case Exonic:
+			continue
+		case Intronic:
+			return false
+		}
+		if len(tc.ExonID) != 1 || len(tc.IntronID) != 1 {
+			return false
+		}
+		explained := false
+		for _, s := range shifts {
+			if s.Type == "extendExon" && s.Exon.Intersect(segments[i]) && (s.Position == segments[i].Start || s.Position == segments[i].End) {
+				explained = true
+			}
+		}
+		if !explained {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+//SiteShifts of the read against the transcripts that classify it as
+//truncExon or extendExon. genes provides the transcript structures
+func (mr *ReadMapTranscriptome) SiteShifts(genes map[string]*genodatastruct.Gene) []SiteShift {
+	result := []SiteShift{}
+	if mr.Class != "truncExon" && mr.Class != "extendExon" {
+		return result
+	}
+	for _, trancoors := range mr.MapTran {
+		t := genes[trancoors[0].GeneID].Transcript(trancoors[0].TranscriptName)
+		if tag, shifts := classifyTran(mr.Segment, trancoors, t); tag == mr.Class {
+			result = append(result, shifts...)
+		}
+	}
+	return result
+}
+
+//ShiftedSite is a distinct shifted splice site with its read support
+type ShiftedSite struct {
+	SiteShift
+	Chromosome     string
+	Strand         string
+	Transcripts    []string
+	Reads          int
+	ObservedScore  float64 //site strengths, NaN unless scored from the genome
+	AnnotatedScore float64
+}
+
+type siteKey struct {
+	Chromosome, Strand, GeneID, Type, Site string
+	Position, Annotated                    int
+}
+
+//SiteShiftCounter aggregates the shifted splice sites across reads
+type SiteShiftCounter struct {
+	Genes map[string]*genodatastruct.Gene
+	sites map[siteKey]*ShiftedSite
+}
+
+func NewSiteShiftCounter(genes map[string]*genodatastruct.Gene) *SiteShiftCounter {
+	return &SiteShiftCounter{Genes: genes, sites: map[siteKey]*ShiftedSite{}}
+}
+
+//Add counts the shifted sites of a truncExon or extendExon read
+func (c *SiteShiftCounter) Add(mr *ReadMapTranscriptome) {
+	seen := map[siteKey]bool{}
+	for _, shift := range mr.SiteShifts(c.Genes) {
+		key := siteKey{mr.Chromosome, mr.Strand, shift.GeneID, shift.Type, shift.Site, shift.Position, shift.Annotated}
+		site, ok := c.sites[key]
+		if !ok {
+			site = &ShiftedSite{SiteShift: shift, Chromosome: mr.Chromosome, Strand: mr.Strand, ObservedScore: math.NaN(), AnnotatedScore: math.NaN()}
+			c.sites[key] = site
+		}
+		if !AnyString(site.Transcripts, func(s string) bool { return s == shift.TranscriptName }) {
+			site.Transcripts = append(site.Transcripts, shift.TranscriptName)
+		}
+		//a coding transcript decides the frame effect
+		if site.Frame == NoCDS || site.Frame == NonCoding {
+			site.Frame = shift.Frame
+		}
+		if !seen[key] {
+			site.Reads++
+			seen[key] = true
+		}
+	}
+}
+
+//Sites returns the shifted sites supported by at least minReads reads
+func (c *SiteShiftCounter) Sites(minReads int) []*ShiftedSite {
+	result := []*ShiftedSite{}
+	for _, site := range c.sites {
+		if site.Reads >= minReads {
+			result = append(result, site)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Chromosome != result[j].Chromosome {
+			return result[i].Chromosome < result[j].Chromosome
+		}
+		if result[i].Position != result[j].Position {
+			return result[i].Position < result[j].Position
+		}
+		return result[i].Annotated < result[j].Annotated
+	})
+	return result
+}
+
+//WriteSiteShifts writes shifted sites as a tab separated table
+func WriteSiteShifts(w io.Writer, sites []*ShiftedSite) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "type\tgene_id\tchromosome\tstrand\tsite\texon_start\texon_end\tannotated_site\tobserved_site\tbases\tframe\treads\tannotated_score\tobserved_score\ttranscripts")
+	for _, s := range sites {
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\t%d\t%s\t", s.Type, s.GeneID, s.Chromosome, s.Strand, s.Site,
+			s.Exon.Start, s.Exon.End, s.Annotated, s.Position, s.Bases, s.Frame, s.Reads, formatScores(s.AnnotatedScore, s.ObservedScore))
+		for i, name := range s.Transcripts {
+			if i > 0 {
+				fmt.Fprint(bw, ",")
+			}
+			fmt.Fprint(bw, name)
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
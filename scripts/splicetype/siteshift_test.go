@@ -0,0 +1,64 @@
+package splicetype
+
+import (
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestSiteShifts(t *testing.T) {
+	exons := []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 300, End: 400}, {Start: 500, End: 600}}
+	coding := []genodatastruct.Coor{{Start: 150, End: 200}, {Start: 300, End: 400}, {Start: 500, End: 550}}
+	tests := []struct {
+		name   string
+		strand string
+		cds    []genodatastruct.Coor
+		cigar  string //of a read at 151
+		want   SiteShift
+	}{
+		{"shorter second exon", "+", coding, "50M109N41M",
+			SiteShift{Type: "truncExon", Site: "acceptor", Exon: exons[1], Position: 310, Annotated: 300, Bases: 10, Frame: FrameShift}},
+		{"shorter first exon", "+", coding, "41M108N51M",
+			SiteShift{Type: "truncExon", Site: "donor", Exon: exons[0], Position: 191, Annotated: 200, Bases: 9, Frame: InFrame}},
+		{"longer first exon", "+", coding, "56M93N51M",
+			SiteShift{Type: "extendExon", Site: "donor", Exon: exons[0], Position: 206, Annotated: 200, Bases: 6, Frame: InFrame}},
+		{"longer second exon", "+", coding, "50M95N55M",
+			SiteShift{Type: "extendExon", Site: "acceptor", Exon: exons[1], Position: 296, Annotated: 300, Bases: 4, Frame: FrameShift}},
+		//the exon starts are the donors of a reverse strand transcript
+		{"reverse strand truncation", "-", coding, "50M109N41M",
+			SiteShift{Type: "truncExon", Site: "donor", Exon: exons[1], Position: 310, Annotated: 300, Bases: 10, Frame: FrameShift}},
+		{"reverse strand extension", "-", coding, "56M93N51M",
+			SiteShift{Type: "extendExon", Site: "acceptor", Exon: exons[0], Position: 206, Annotated: 200, Bases: 6, Frame: InFrame}},
+		//the first exon is untranslated
+		{"5' UTR", "+", coding[1:], "41M108N51M",
+			SiteShift{Type: "truncExon", Site: "donor", Exon: exons[0], Position: 191, Annotated: 200, Bases: 9, Frame: NonCoding}},
+		{"noncoding transcript", "+", nil, "41M108N51M",
+			SiteShift{Type: "truncExon", Site: "donor", Exon: exons[0], Position: 191, Annotated: 200, Bases: 9, Frame: NoCDS}},
+	}
+	for _, test := range tests {
+		//GenerateIntrons sorts the exons of a reverse strand transcript in place
+		tr := &genodatastruct.Transcript{TranscriptName: "T1", Chromosome: "chr1", Strand: test.strand, Coordinate: genodatastruct.Coor{Start: 100, End: 600},
+			Exons: append([]genodatastruct.Coor{}, exons...), CDS: append([]genodatastruct.Coor(nil), test.cds...)}
+		tr.Introns = tr.GenerateIntrons()
+		genes := map[string]*genodatastruct.Gene{"G1": {Chromosome: "chr1", Strand: test.strand, Coordinate: genodatastruct.Coor{Start: 100, End: 600},
+			Transcripts: []*genodatastruct.Transcript{tr}}}
+		var flag int64
+		if test.strand == "-" {
+			flag = 16
+		}
+		mr := NewReadMapTranscriptome(genodatastruct.SamRec{QName: "r", Flag: flag, Chromosome: "chr1", Pos: 151, CIGAR: test.cigar})
+		mr.GeneLoci = []string{"G1"}
+		mr.MapToTran(genes)
+		mr.Class = mr.SpliceType(genes)
+		shifts := mr.SiteShifts(genes)
+		if mr.Class != test.want.Type || len(shifts) != 1 {
+			t.Errorf("%s: class %s shifts %+v, want one %s", test.name, mr.Class, shifts, test.want.Type)
+			continue
+		}
+		s := shifts[0]
+		s.Junction, s.GeneID, s.TranscriptName = genodatastruct.Coor{}, "", ""
+		if s != test.want {
+			t.Errorf("%s: shift %+v, want %+v", test.name, s, test.want)
+		}
+	}
+}
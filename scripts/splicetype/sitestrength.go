@@ -0,0 +1,288 @@
+package splicetype
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//Splice site windows of MaxEntScan: the donor 9-mer has 3 exonic and 6
+//intronic bases, the acceptor 23-mer 20 intronic and 3 exonic bases
+const (
+	DonorLength    = 9
+	AcceptorLength = 23
+)
+
+//donorFrequencies of A, C, G, T at positions -3 to +6 of human donor sites
+var donorFrequencies = [DonorLength][4]float64{
+	{0.33, 0.36, 0.19, 0.12},
+	{0.60, 0.13, 0.14, 0.13},
+	{0.09, 0.03, 0.80, 0.08},
+	{0.00, 0.00, 1.00, 0.00},
+	{0.00, 0.01, 0.00, 0.99},
+	{0.60, 0.03, 0.34, 0.03},
+	{0.71, 0.08, 0.12, 0.09},
+	{0.06, 0.05, 0.84, 0.05},
+	{0.16, 0.17, 0.18, 0.49},
+}
+
+//acceptorFrequencies of A, C, G, T at positions -20 to +3 of human acceptor
+//sites, the polypyrimidine tract followed by the YAG of the intron end
+var acceptorFrequencies = [AcceptorLength][4]float64{
+	{0.22, 0.27, 0.20, 0.31},
+	{0.21, 0.28, 0.19, 0.32},
+	{0.20, 0.28, 0.19, 0.33},
+	{0.19, 0.29, 0.18, 0.34},
+	{0.18, 0.29, 0.17, 0.36},
+	{0.17, 0.30, 0.16, 0.37},
+	{0.15, 0.30, 0.15, 0.40},
+	{0.13, 0.31, 0.13, 0.43},
+	{0.12, 0.31, 0.12, 0.45},
+	{0.11, 0.32, 0.11, 0.46},
+	{0.10, 0.33, 0.10, 0.47},
+	{0.10, 0.34, 0.09, 0.47},
+	{0.09, 0.35, 0.08, 0.48},
+	{0.09, 0.35, 0.07, 0.49},
+	{0.10, 0.36, 0.06, 0.48},
+	{0.11, 0.37, 0.06, 0.46},
+	{0.23, 0.30, 0.22, 0.25},
+	{0.06, 0.74, 0.01, 0.19},
+	{1.00, 0.00, 0.00, 0.00}, //-2, the AG ends the intron
+	{0.00, 0.00, 1.00, 0.00},
+	{0.25, 0.14, 0.52, 0.09}, //+1, first exonic base
+	{0.26, 0.19, 0.22, 0.33},
+	{0.26, 0.22, 0.24, 0.28},
+}
+
+//SiteModel scores splice site sequences by the log2 odds of position weight
+//matrices against a uniform background
+type SiteModel struct {
+	Donor    [][4]float64
+	Acceptor [][4]float64
+}
+
+//minFrequency replaces null frequencies so that any sequence has a score
+const minFrequency = 0.001
+
+//NewSiteModel builds a model of the frequency matrices of A, C, G, T per position
+func NewSiteModel(donor, acceptor [][4]float64) (*SiteModel, error) {
+	if len(donor) != DonorLength || len(acceptor) != AcceptorLength {
+		return nil, fmt.Errorf("site model needs %d donor and %d acceptor positions, got %d and %d", DonorLength, AcceptorLength, len(donor), len(acceptor))
+	}
+	m := &SiteModel{}
+	for _, freqs := range donor {
+		m.Donor = append(m.Donor, logOdds(freqs))
+	}
+	for _, freqs := range acceptor {
+		m.Acceptor = append(m.Acceptor, logOdds(freqs))
+	}
+	return m, nil
+}
+
+//logOdds of the normalized frequencies of a position
+func logOdds(freqs [4]float64) [4]float64 {
+	sum := 0.0
+	for _, f := range freqs {
+		sum += math.Max(f, minFrequency)
+	}
+	var scores [4]float64
+	for i, f := range freqs {
+		scores[i] = math.Log2(math.Max(f, minFrequency) / sum / 0.25)
+	}
+	return scores
+}
+
+//DefaultSiteModel is the model shipped with the project
+func DefaultSiteModel() *SiteModel {
+	m, _ := NewSiteModel(donorFrequencies[:], acceptorFrequencies[:])
+	return m
+}
+
+//ParseSiteModel reads frequency matrices from lines of site type (donor or
+//acceptor) followed by the frequencies of A, C, G and T, one line per
+//position from 5' to 3'. Lines starting with # are comments
+func ParseSiteModel(text string) (*SiteModel, error) {
+	matrices := map[string][][4]float64{}
+	for n, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 5 || (fields[0] != "donor" && fields[0] != "acceptor") {
+			return nil, fmt.Errorf("line %d of site model: want donor|acceptor and 4 frequencies", n+1)
+		}
+		var freqs [4]float64
+		for i := range freqs {
+			f, err := strconv.ParseFloat(fields[i+1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d of site model: %v", n+1, err)
+			}
+			freqs[i] = f
+		}
+		matrices[fields[0]] = append(matrices[fields[0]], freqs)
+	}
+	return NewSiteModel(matrices["donor"], matrices["acceptor"])
+}
+
+//ScoreSequence scores a donor 9-mer or an acceptor 23-mer read 5' to 3'.
+//The score is NaN for a sequence of wrong length or with other bases than ACGT
+func (m *SiteModel) ScoreSequence(site, seq string) float64 {
+	matrix := m.Donor
+	if site == "acceptor" {
+		matrix = m.Acceptor
+	}
+	if len(seq) != len(matrix) {
+		return math.NaN()
+	}
+	score := 0.0
+	for i := 0; i < len(seq); i++ {
+		k := strings.IndexByte("ACGT", seq[i])
+		if k < 0 {
+			return math.NaN()
+		}
+		score += matrix[i][k]
+	}
+	return score
+}
+
+//Score the donor or acceptor site at the exonic base next to the junction,
+//the convention of SiteShift.Position
+func (m *SiteModel) Score(fa *genodatastruct.Fasta, chromosome, strand, site string, pos int) (float64, error) {
+	//exonic and intronic bases of the window
+	exonic, intronic := 3, 6
+	if site == "acceptor" {
+		exonic, intronic = 3, 20
+	}
+	//the window runs to the intron on the right of pos for + donors and - acceptors
+	right := (site == "donor") == (strand == "+")
+	window := genodatastruct.Coor{Start: pos - exonic + 1, End: pos + intronic}
+	if !right {
+		window = genodatastruct.Coor{Start: pos - intronic, End: pos + exonic - 1}
+	}
+	if window.Start < 1 {
+		return math.NaN(), nil
+	}
+	if _, ok := fa.Index[genodatastruct.ChroSym(chromosome)]; !ok {
+		return math.NaN(), nil
+	}
+	seq, err := fa.Fetch(chromosome, window)
+	if err != nil {
+		return math.NaN(), err
+	}
+	if strand == "-" {
+		seq = genodatastruct.ReverseComplement(seq)
+	}
+	return m.ScoreSequence(site, seq), nil
+}
+
+//SiteStrength are the scores of the sites of an alternative region against
+//the competing reference sites, NaN when not applicable
+type SiteStrength struct {
+	Donor, Acceptor       float64
+	RefDonor, RefAcceptor float64
+}
+
+//junctionSites are the exonic bases next to the donor and acceptor of an intron
+func junctionSites(intron genodatastruct.Coor, strand string) (donor, acceptor int) {
+	if strand == "-" {
+		return intron.End + 1, intron.Start - 1
+	}
+	return intron.Start - 1, intron.End + 1
+}
+
+//exonSites are the donor and acceptor bases of an exon
+func exonSites(exon genodatastruct.Coor, strand string) (donor, acceptor int) {
+	if strand == "-" {
+		return exon.Start, exon.End
+	}
+	return exon.End, exon.Start
+}
+
+//siteStrength of an event. Truncated and extended exons compare the observed
+//site to the annotated one, cryptic exons their sites to the host intron, skipped
+//exons their sites to the skipping junction and retained introns have no reference
+func (m *SiteModel) siteStrength(fa *genodatastruct.Fasta, e *Event) (*SiteStrength, error) {
+	nan := math.NaN()
+	donor, acceptor, refDonor, refAcceptor := -1, -1, -1, -1
+	switch e.Type {
+	case "truncExon", "extendExon":
+		if len(e.InclusionJunctions) == 0 || len(e.ExclusionJunctions) == 0 {
+			break
+		}
+		d, a := junctionSites(e.InclusionJunctions[0], e.Strand)
+		rd, ra := junctionSites(e.ExclusionJunctions[0], e.Strand)
+		if d != rd {
+			donor, refDonor = d, rd
+		}
+		if a != ra {
+			acceptor, refAcceptor = a, ra
+		}
+	case "crypticExon", "exonSkipping":
+		donor, acceptor = exonSites(e.Coordinate, e.Strand)
+		if len(e.ExclusionJunctions) > 0 {
+			refDonor, refAcceptor = junctionSites(e.ExclusionJunctions[0], e.Strand)
+		}
+	case "intronInclusion":
+		donor, acceptor = junctionSites(e.Coordinate, e.Strand)
+	}
+	s := &SiteStrength{nan, nan, nan, nan}
+	for _, x := range []struct {
+		pos   int
+		site  string
+		score *float64
+	}{{donor, "donor", &s.Donor}, {acceptor, "acceptor", &s.Acceptor}, {refDonor, "donor", &s.RefDonor}, {refAcceptor, "acceptor", &s.RefAcceptor}} {
+		if x.pos < 0 {
+			continue
+		}
+		score, err := m.Score(fa, e.Chromosome, e.Strand, x.site, x.pos)
+		if err != nil {
+			return nil, err
+		}
+		*x.score = score
+	}
+	return s, nil
+}
+
+//ScoreEvents sets the site strength of the events
+func (m *SiteModel) ScoreEvents(fa *genodatastruct.Fasta, events []*Event) error {
+	for _, e := range events {
+		s, err := m.siteStrength(fa, e)
+		if err != nil {
+			return err
+		}
+		e.Strength = s
+	}
+	return nil
+}
+
+//ScoreSites sets the strength of the observed and the annotated site of
+//shifted splice sites
+func (m *SiteModel) ScoreSites(fa *genodatastruct.Fasta, sites []*ShiftedSite) error {
+	for _, s := range sites {
+		observed, err := m.Score(fa, s.Chromosome, s.Strand, s.Site, s.Position)
+		if err != nil {
+			return err
+		}
+		annotated, err := m.Score(fa, s.Chromosome, s.Strand, s.Site, s.Annotated)
+		if err != nil {
+			return err
+		}
+		s.ObservedScore, s.AnnotatedScore = observed, annotated
+	}
+	return nil
+}
+
+//formatScores prints site scores for tables, NA for missing ones
+func formatScores(scores ...float64) string {
+	printed := make([]string, len(scores))
+	for i, v := range scores {
+		printed[i] = "NA"
+		if !math.IsNaN(v) {
+			printed[i] = strconv.FormatFloat(v, 'f', 2, 64)
+		}
+	}
+	return strings.Join(printed, "\t")
+}
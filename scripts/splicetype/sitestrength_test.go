@@ -0,0 +1,78 @@
+package splicetype
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestSiteScore(t *testing.T) {
+	m := DefaultSiteModel()
+	consensus, weak := m.ScoreSequence("donor", "CAGGTAAGT"), m.ScoreSequence("donor", "CAGGTCCTA")
+	if !(consensus > weak) || consensus < 5 {
+		t.Errorf("consensus donor %g, weak donor %g", consensus, weak)
+	}
+	if !math.IsNaN(m.ScoreSequence("donor", "CAGGTNAGT")) {
+		t.Error("score of a sequence with N")
+	}
+	//the same donor on both strands: exon CAG|GTAAGT intron
+	donor := "CCCCAGGTAAGTCCCC"
+	seq := donor + genodatastruct.ReverseComplement(donor)
+	path := filepath.Join(t.TempDir(), "donor.fa")
+	if err := ioutil.WriteFile(path, []byte(">chr1\n"+seq+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fa, err := genodatastruct.OpenFasta(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fa.Close()
+	plus, err := m.Score(fa, "chr1", "+", "donor", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	minus, err := m.Score(fa, "chr1", "-", "donor", 27)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plus != consensus || minus != consensus {
+		t.Errorf("donor scored %g on + and %g on -, want %g", plus, minus, consensus)
+	}
+}
+
+func TestAcceptorScore(t *testing.T) {
+	m := DefaultSiteModel()
+	//20 intronic bases ending in CAG, then 3 exonic bases
+	consensus := m.ScoreSequence("acceptor", "TTTTTTTTTTTTTTTTTCAGGTA")
+	shifted := m.ScoreSequence("acceptor", "TTTTTTTTTTTTTTTTCAGGTAA")
+	if !(consensus > 10) || !(consensus > shifted) {
+		t.Errorf("consensus acceptor %g, shifted by one base %g", consensus, shifted)
+	}
+	//the same acceptor on both strands: intron TTTT...CAG|GTA exon
+	acceptor := "CCCC" + "TTTTTTTTTTTTTTTTTCAG" + "GTACCCC"
+	seq := acceptor + genodatastruct.ReverseComplement(acceptor)
+	path := filepath.Join(t.TempDir(), "acceptor.fa")
+	if err := ioutil.WriteFile(path, []byte(">chr1\n"+seq+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fa, err := genodatastruct.OpenFasta(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fa.Close()
+	//the first exonic base is 25 on + and its mirror 38 on -
+	plus, err := m.Score(fa, "chr1", "+", "acceptor", 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	minus, err := m.Score(fa, "chr1", "-", "acceptor", 2*len(acceptor)-25+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plus != consensus || minus != consensus {
+		t.Errorf("acceptor scored %g on + and %g on -, want %g", plus, minus, consensus)
+	}
+}
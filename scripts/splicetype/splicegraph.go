@@ -0,0 +1,241 @@
+package splicetype
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//maxDeNovoExon is the largest extension of an exon or length of a de novo
+//exon made of junction ends outside the annotated exons
+const maxDeNovoExon = 500
+
+//SpliceNode is an exon of the splice graph: the merged overlapping exons of
+//the transcripts, so alternative 5' and 3' sites are several junctions of one
+//node, or a de novo exon between junction ends outside the annotation
+type SpliceNode struct {
+	Exon  genodatastruct.Coor
+	Novel bool
+}
+
+//SpliceEdge is a junction from the node of its donor to that of its acceptor
+type SpliceEdge struct {
+	Intron         genodatastruct.Coor
+	Source, Target int //node indexes
+	Annotated      bool
+	Reads          float64
+}
+
+//SpliceGraph of a gene, nodes are sorted by genomic position
+type SpliceGraph struct {
+	GeneID     string
+	Chromosome string
+	Strand     string
+	Nodes      []SpliceNode
+	Edges      []SpliceEdge
+}
+
+//NewSpliceGraph builds the graph of the gene from the introns of its
+//transcripts and the observed junctions, with the reads of the junction counter
+func NewSpliceGraph(geneID string, gene *genodatastruct.Gene, observed []genodatastruct.Coor, jc *JunctionCounter) *SpliceGraph {
+	g := &SpliceGraph{GeneID: geneID, Chromosome: gene.Chromosome, Strand: gene.Strand}
+	annotated := map[genodatastruct.Coor]bool{}
+	introns := []genodatastruct.Coor{}
+	for _, t := range gene.Transcripts {
+		for _, intron := range t.Introns {
+			if !annotated[intron] {
+				annotated[intron] = true
+				introns = append(introns, intron)
+			}
+		}
+	}
+	for _, intron := range observed {
+		if !annotated[intron] {
+			introns = append(introns, intron)
+		}
+	}
+	sort.Slice(introns, func(i, j int) bool {
+		if introns[i].Start != introns[j].Start {
+			return introns[i].Start < introns[j].Start
+		}
+		return introns[i].End < introns[j].End
+	})
+	for _, exon := range gene.MergeExons() {
+		g.Nodes = append(g.Nodes, SpliceNode{Exon: exon})
+	}
+	//junction ends outside the exons extend the closest exon or make de novo exons
+	type end struct {
+		pos  int
+		left bool //the junction is on the left, the exon goes on to the right
+	}
+	outside := []end{}
+	for _, intron := range introns {
+		if g.node(intron.Start-1) < 0 {
+			outside = append(outside, end{intron.Start - 1, false})
+		}
+		if g.node(intron.End+1) < 0 {
+			outside = append(outside, end{intron.End + 1, true})
+		}
+	}
+	sort.Slice(outside, func(i, j int) bool { return outside[i].pos < outside[j].pos })
+	open := map[int]bool{} //de novo exons without a right end yet, by start
+	for _, e := range outside {
+		if g.node(e.pos) >= 0 {
+			continue
+		}
+		if e.left {
+			g.Nodes = append(g.Nodes, SpliceNode{Exon: genodatastruct.Coor{Start: e.pos, End: e.pos}, Novel: true})
+			open[e.pos] = true
+		} else if k := g.nodeBefore(e.pos); k >= 0 && e.pos-g.Nodes[k].Exon.End <= maxDeNovoExon {
+			g.Nodes[k].Exon.End = e.pos
+			delete(open, g.Nodes[k].Exon.Start)
+		} else {
+			g.Nodes = append(g.Nodes, SpliceNode{Exon: genodatastruct.Coor{Start: e.pos, End: e.pos}, Novel: true})
+		}
+		sort.SliceStable(g.Nodes, func(i, j int) bool { return g.Nodes[i].Exon.Start < g.Nodes[j].Exon.Start })
+	}
+	//a de novo exon only entered from the left is the extension of the next exon
+	merged := []SpliceNode{}
+	for i := 0; i < len(g.Nodes); i++ {
+		n := g.Nodes[i]
+		if n.Novel && open[n.Exon.Start] && i+1 < len(g.Nodes) && g.Nodes[i+1].Exon.Start-n.Exon.End <= maxDeNovoExon {
+			g.Nodes[i+1].Exon.Start = n.Exon.Start
+			continue
+		}
+		merged = append(merged, n)
+	}
+	g.Nodes = merged
+	for _, intron := range introns {
+		donor, acceptor := junctionSites(intron, gene.Strand)
+		g.Edges = append(g.Edges, SpliceEdge{
+			Intron:    intron,
+			Source:    g.node(donor),
+			Target:    g.node(acceptor),
+			Annotated: annotated[intron],
+			Reads:     jc.Count(gene.Chromosome, gene.Strand, intron),
+		})
+	}
+	return g
+}
+
+//node containing the position, -1 if none
+func (g *SpliceGraph) node(pos int) int {
+	point := genodatastruct.Coor{Start: pos, End: pos}
+	for i, n := range g.Nodes {
+		if point.Inside(n.Exon) {
+			return i
+		}
+	}
+	return -1
+}
+
+//nodeBefore is the last node ending before the position, -1 if none
+func (g *SpliceGraph) nodeBefore(pos int) int {
+	k := -1
+	for i, n := range g.Nodes {
+		if n.Exon.End < pos {
+			k = i
+		}
+	}
+	return k
+}
+
+//BuildSpliceGraphs builds the splice graph of every gene with the counted
+//junctions whose both ends fall in the gene on its strand
+func BuildSpliceGraphs(genes map[string]*genodatastruct.Gene, index map[string]*GeneMapIndex, jc *JunctionCounter) map[string]*SpliceGraph {
+	observed := map[string][]genodatastruct.Coor{}
+	for j := range jc.Counts {
+		mr := ReadMapTranscriptome{
+			Chromosome: j.Chromosome,
+			Segment:    []genodatastruct.Coor{{Start: j.Intron.Start - 1, End: j.Intron.Start - 1}, {Start: j.Intron.End + 1, End: j.Intron.End + 1}},
+		}
+		mr.InvolvedGeneLoci(index)
+		for _, geneid := range mr.GeneLoci {
+			gene, ok := genes[geneid]
+			if !ok || gene.Strand != j.Strand || !gene.Contains(genodatastruct.Coor{Start: j.Intron.Start - 1, End: j.Intron.End + 1}) {
+				continue
+			}
+			observed[geneid] = append(observed[geneid], j.Intron)
+		}
+	}
+	graphs := map[string]*SpliceGraph{}
+	for geneid, gene := range genes {
+		graphs[geneid] = NewSpliceGraph(geneid, gene, observed[geneid], jc)
+	}
+	return graphs
+}
+
+//LSV is a local splicing variation: the junctions leaving a node (source)
+//or entering it (target) in the transcript direction, when more than one
+type LSV struct {
+	ID    string
+	Type  string //source or target
+	Node  int
+	Edges []int
+	Graph *SpliceGraph
+	Reads float64 //reads of all the junctions
+	Novel bool    //has a junction not in the annotation
+}
+
+//LSVs of the graph, ID is gene:s|t:start-end of the reference node
+func (g *SpliceGraph) LSVs() []*LSV {
+	result := []*LSV{}
+	for i, n := range g.Nodes {
+		for _, lsvType := range []string{"source", "target"} {
+			lsv := &LSV{Type: lsvType, Node: i, Graph: g}
+			for k, e := range g.Edges {
+				if (lsvType == "source" && e.Source == i) || (lsvType == "target" && e.Target == i) {
+					lsv.Edges = append(lsv.Edges, k)
+					lsv.Reads += e.Reads
+					lsv.Novel = lsv.Novel || !e.Annotated
+				}
+			}
+			if len(lsv.Edges) < 2 {
+				continue
+			}
+			lsv.ID = fmt.Sprintf("%s:%s:%d-%d", g.GeneID, lsvType[:1], n.Exon.Start, n.Exon.End)
+			result = append(result, lsv)
+		}
+	}
+	return result
+}
+
+//WriteLSVs writes one row per junction of the LSVs with at least minReads
+//reads, with its fraction of the LSV reads
+func WriteLSVs(w io.Writer, graphs map[string]*SpliceGraph, genes map[string]*genodatastruct.Gene, minReads int) error {
+	geneids := []string{}
+	for geneid := range graphs {
+		geneids = append(geneids, geneid)
+	}
+	sort.Slice(geneids, func(i, j int) bool {
+		a, b := genes[geneids[i]], genes[geneids[j]]
+		if a.Chromosome != b.Chromosome {
+			return a.Chromosome < b.Chromosome
+		}
+		if a.Coordinate.Start != b.Coordinate.Start {
+			return a.Coordinate.Start < b.Coordinate.Start
+		}
+		return geneids[i] < geneids[j]
+	})
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "lsv_id\tgene_id\tgene_name\ttype\tchromosome\tstrand\tnode_start\tnode_end\tnode_novel\tjunction_start\tjunction_end\tannotated\treads\tlsv_reads\tfraction")
+	for _, geneid := range geneids {
+		g := graphs[geneid]
+		for _, lsv := range g.LSVs() {
+			if lsv.Reads < float64(minReads) {
+				continue
+			}
+			n := g.Nodes[lsv.Node]
+			for _, k := range lsv.Edges {
+				e := g.Edges[k]
+				fmt.Fprintf(bw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%t\t%d\t%d\t%t\t%s\t%s\t%s\n", lsv.ID, geneid, genes[geneid].GeneName, lsv.Type,
+					g.Chromosome, g.Strand, n.Exon.Start, n.Exon.End, n.Novel, e.Intron.Start, e.Intron.End, e.Annotated, FormatCount(e.Reads),
+					FormatCount(lsv.Reads), FormatRatio(e.Reads/lsv.Reads))
+			}
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,136 @@
+package splicetype
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+//graphGene of the transcripts, each given by its exons in ascending order
+func graphGene(strand string, transcripts ...[]genodatastruct.Coor) *genodatastruct.Gene {
+	gene := &genodatastruct.Gene{GeneName: "ONE", Chromosome: "chr1", Strand: strand, Coordinate: genodatastruct.Coor{Start: 100, End: 700}}
+	for _, exons := range transcripts {
+		gene.Transcripts = append(gene.Transcripts, &genodatastruct.Transcript{Chromosome: "chr1", Strand: strand, Exons: exons, Introns: genodatastruct.IntervalRegions(exons)})
+	}
+	return gene
+}
+
+func TestNewSpliceGraph(t *testing.T) {
+	//T1 has the exon 300-400 that T2 skips
+	t1 := []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 300, End: 400}, {Start: 600, End: 700}}
+	t2 := []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 600, End: 700}}
+	type edge struct {
+		intron         genodatastruct.Coor
+		source, target int
+		annotated      bool
+	}
+	tests := []struct {
+		name     string
+		strand   string
+		observed []genodatastruct.Coor
+		nodes    []SpliceNode
+		edges    []edge
+		lsvs     []string
+	}{
+		{"annotated", "+", nil,
+			[]SpliceNode{{Exon: genodatastruct.Coor{Start: 100, End: 200}}, {Exon: genodatastruct.Coor{Start: 300, End: 400}}, {Exon: genodatastruct.Coor{Start: 600, End: 700}}},
+			[]edge{{genodatastruct.Coor{Start: 201, End: 299}, 0, 1, true}, {genodatastruct.Coor{Start: 201, End: 599}, 0, 2, true}, {genodatastruct.Coor{Start: 401, End: 599}, 1, 2, true}},
+			[]string{"G:s:100-200", "G:t:600-700"}},
+		//edges go from the donor on the right
+		{"reverse strand", "-", nil,
+			[]SpliceNode{{Exon: genodatastruct.Coor{Start: 100, End: 200}}, {Exon: genodatastruct.Coor{Start: 300, End: 400}}, {Exon: genodatastruct.Coor{Start: 600, End: 700}}},
+			[]edge{{genodatastruct.Coor{Start: 201, End: 299}, 1, 0, true}, {genodatastruct.Coor{Start: 201, End: 599}, 2, 0, true}, {genodatastruct.Coor{Start: 401, End: 599}, 2, 1, true}},
+			[]string{"G:t:100-200", "G:s:600-700"}},
+		//both ends of 500-550 are novel junction ends
+		{"de novo exon", "+", []genodatastruct.Coor{{Start: 401, End: 499}, {Start: 551, End: 599}, {Start: 201, End: 299}},
+			[]SpliceNode{{Exon: genodatastruct.Coor{Start: 100, End: 200}}, {Exon: genodatastruct.Coor{Start: 300, End: 400}},
+				{Exon: genodatastruct.Coor{Start: 500, End: 550}, Novel: true}, {Exon: genodatastruct.Coor{Start: 600, End: 700}}},
+			[]edge{{genodatastruct.Coor{Start: 201, End: 299}, 0, 1, true}, {genodatastruct.Coor{Start: 201, End: 599}, 0, 3, true},
+				{genodatastruct.Coor{Start: 401, End: 499}, 1, 2, false}, {genodatastruct.Coor{Start: 401, End: 599}, 1, 3, true}, {genodatastruct.Coor{Start: 551, End: 599}, 2, 3, false}},
+			[]string{"G:s:100-200", "G:s:300-400", "G:t:600-700"}},
+		//a novel acceptor before an exon extends it
+		{"extended exon", "+", []genodatastruct.Coor{{Start: 201, End: 449}},
+			[]SpliceNode{{Exon: genodatastruct.Coor{Start: 100, End: 200}}, {Exon: genodatastruct.Coor{Start: 300, End: 400}}, {Exon: genodatastruct.Coor{Start: 450, End: 700}}},
+			[]edge{{genodatastruct.Coor{Start: 201, End: 299}, 0, 1, true}, {genodatastruct.Coor{Start: 201, End: 449}, 0, 2, false},
+				{genodatastruct.Coor{Start: 201, End: 599}, 0, 2, true}, {genodatastruct.Coor{Start: 401, End: 599}, 1, 2, true}},
+			[]string{"G:s:100-200", "G:t:450-700"}},
+	}
+	for _, test := range tests {
+		g := NewSpliceGraph("G", graphGene(test.strand, t1, t2), test.observed, NewJunctionCounter())
+		if len(g.Nodes) != len(test.nodes) {
+			t.Errorf("%s: nodes %v, want %v", test.name, g.Nodes, test.nodes)
+			continue
+		}
+		for i := range g.Nodes {
+			if g.Nodes[i] != test.nodes[i] {
+				t.Errorf("%s: nodes %v, want %v", test.name, g.Nodes, test.nodes)
+				break
+			}
+		}
+		if len(g.Edges) != len(test.edges) {
+			t.Errorf("%s: edges %v, want %v", test.name, g.Edges, test.edges)
+			continue
+		}
+		for i, e := range g.Edges {
+			if w := test.edges[i]; e.Intron != w.intron || e.Source != w.source || e.Target != w.target || e.Annotated != w.annotated {
+				t.Errorf("%s: edge %d %+v, want %+v", test.name, i, e, w)
+			}
+		}
+		lsvs := []string{}
+		for _, lsv := range g.LSVs() {
+			lsvs = append(lsvs, lsv.ID)
+		}
+		if strings.Join(lsvs, " ") != strings.Join(test.lsvs, " ") {
+			t.Errorf("%s: LSVs %v, want %v", test.name, lsvs, test.lsvs)
+		}
+	}
+}
+
+func TestWriteLSVs(t *testing.T) {
+	gene := graphGene("+", []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 300, End: 400}, {Start: 600, End: 700}})
+	genes := map[string]*genodatastruct.Gene{"G": gene}
+	jc := NewJunctionCounter()
+	for _, j := range []struct {
+		strand string
+		intron genodatastruct.Coor
+		reads  float64
+	}{
+		{"+", genodatastruct.Coor{Start: 201, End: 299}, 10},
+		{"+", genodatastruct.Coor{Start: 401, End: 599}, 3},
+		{"+", genodatastruct.Coor{Start: 201, End: 599}, 2},  //novel skipping junction
+		{"+", genodatastruct.Coor{Start: 251, End: 299}, 4},  //novel donor extending the first exon
+		{"-", genodatastruct.Coor{Start: 201, End: 499}, 50}, //other strand
+		{"+", genodatastruct.Coor{Start: 651, End: 899}, 50}, //ends out of the gene
+	} {
+		jc.Counts[Junction{"chr1", j.strand, j.intron}] = j.reads
+	}
+	graphs := BuildSpliceGraphs(genes, SortGeneMap(genes), jc)
+	if n := len(graphs["G"].Edges); n != 4 {
+		t.Fatalf("%d edges, want the 4 junctions of the gene and strand", n)
+	}
+	tests := []struct {
+		minReads int
+		want     []string //lsv and junction of the rows
+	}{
+		{1, []string{"G:s:100-250 201-299", "G:s:100-250 201-599", "G:s:100-250 251-299", "G:t:300-400 201-299", "G:t:300-400 251-299", "G:t:600-700 201-599", "G:t:600-700 401-599"}},
+		{6, []string{"G:s:100-250 201-299", "G:s:100-250 201-599", "G:s:100-250 251-299", "G:t:300-400 201-299", "G:t:300-400 251-299"}},
+		{15, []string{"G:s:100-250 201-299", "G:s:100-250 201-599", "G:s:100-250 251-299"}},
+		{17, []string{}},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := WriteLSVs(&buf, graphs, genes, test.minReads); err != nil {
+			t.Fatal(err)
+		}
+		rows := []string{}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n")[1:] {
+			fields := strings.Split(line, "\t")
+			rows = append(rows, fields[0]+" "+fields[9]+"-"+fields[10])
+		}
+		if strings.Join(rows, "|") != strings.Join(test.want, "|") {
+			t.Errorf("LSV rows of at least %d reads %v, want %v", test.minReads, rows, test.want)
+		}
+	}
+}
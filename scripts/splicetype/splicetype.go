@@ -1,6 +1,8 @@
 package splicetype
 
 import (
+	"strings"
+
 	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
 )
 
@@ -26,10 +28,15 @@ func (m *TranCoor) ClassSeg() TranOri {
 	}
 }
 
-//Values: normal, intronic, intronInclusion, exonSkipping, truncExon...
+//Values: normal, intronic, intronInclusion, exonSkipping, crypticExon, truncExon, extendExon...
 type SpliceType string
 
-func (mr *ReadMapTranscriptome) SpliceType() string {
+//Categories of splited reads, in the order of precedence when
+//transcripts of a read disagree
+var Categories = []string{"normal", "exonSkipping", "truncExon", "extendExon", "crypticExon", "intronInclusion"}
+
+//SpliceType of the read, genes provides the transcript structures
+func (mr *ReadMapTranscriptome) SpliceType(genes map[string]*genodatastruct.Gene) string {
 	//if len(mr.Segment) == 1 { //no junction
 		//sumflag := Crossonic //lowest value of TranOri type
 		//for _, trancoor := range mr.MapTran {
@@ -52,61 +59,132 @@ func (mr *ReadMapTranscriptome) SpliceType() string {
 	if len(mr.Segment) > 1 { // splited read
 		classify := []string{}
 		for _, trancoors := range mr.MapTran {
-			temp := []TranOri{}
-			for _, tc := range trancoors {
-				temp = append(temp, tc.ClassSeg())
-			}
-			if len(temp) == 0 {
+			if len(trancoors) == 0 {
 				continue
 			}
-			//detect intron inclusion and exon skipping
-			if All(temp, func(tr TranOri) bool { return tr == Exonic }) {
-				tag := "normal"
-				for i := 0; i < len(trancoors)-1; i++ {
-					if trancoors[i+1].ExonID[0]-trancoors[i].ExonID[0] > 1 {
-						tag = "exonSkipping"
-						break
-					}
-				}
-				classify = append(classify, tag)
-			} else {
-				classify = append(classify, "intronInclusion")
-			}
+			t := genes[trancoors[0].GeneID].Transcript(trancoors[0].TranscriptName)
+			tag, _ := classifyTran(mr.Segment, trancoors, t)
+			classify = append(classify, tag)
 		}
-		if AnyString(classify, func(s string) bool { return s == "normal" }) {
-			return "normal"
-		} else if AnyString(classify, func(s string) bool { return s == "exonSkipping" }) {
-			return "exonSkipping"
-		} else if AnyString(classify, func(s string) bool { return s == "intronInclusion" }) {
-			return "intronInclusion"
+		//the most normal explanation among the transcripts wins
+		for _, tag := range Categories {
+			if AnyString(classify, func(s string) bool { return s == tag }) {
+				return tag
+			}
 		}
 	}
 	return "No Class"
 }
 
+//classifyTran gives the splice type of a splited read against a single transcript,
+//with the shifted splice sites for truncExon and extendExon
+func classifyTran(segments []genodatastruct.Coor, trancoors []TranCoor, t *genodatastruct.Transcript) (string, []SiteShift) {
+	temp := []TranOri{}
+	for _, tc := range trancoors {
+		temp = append(temp, tc.ClassSeg())
+	}
+	//detect intron inclusion and exon skipping
+	if All(temp, func(tr TranOri) bool { return tr == Exonic }) {
+		//junction lands inside an exon
+		if shifts := siteShifts(segments, trancoors, t); len(shifts) > 0 {
+			return "truncExon", shifts
+		}
+		tag := "normal"
+		for i := 0; i < len(trancoors)-1; i++ {
+			if trancoors[i+1].ExonID[0]-trancoors[i].ExonID[0] > 1 {
+				tag = "exonSkipping"
+				break
+			}
+		}
+		return tag, nil
+	} else if len(crypticSegments(trancoors)) > 0 {
+		//internal segment inside an intron, bounded by novel junctions
+		return "crypticExon", nil
+	}
+	//junction lands inside the intron next to an exon
+	if shifts := siteShifts(segments, trancoors, t); len(shifts) > 0 && extensionExplained(segments, trancoors, shifts) {
+		tag := "extendExon"
+		for _, s := range shifts {
+			if s.Type == "truncExon" {
+				tag = "truncExon"
+			}
+		}
+		return tag, shifts
+	}
+	return "intronInclusion", nil
+}
+
+//NewReadMapTranscriptome is the aligned segments of a read before mapping
+//them to genes and transcripts
+func NewReadMapTranscriptome(samrec genodatastruct.SamRec) *ReadMapTranscriptome {
+	name := samrec.QName
+	switch {
+	case samrec.Flag&0x40 != 0:
+		name += "/1"
+	case samrec.Flag&0x80 != 0:
+		name += "/2"
+	}
+	return &ReadMapTranscriptome{
+		Name:       name,
+		Chromosome: samrec.Chromosome,
+		Strand:     samrec.Strand(),
+		Segment:    samrec.RegionAligned(),
+		NH:         samrec.NH(),
+		Weight:     1,
+		Tags:       samrec.Tags,
+		Fields:     samrec.Fields,
+	}
+}
+
+//Tag returns the value of an optional field of the alignment of the read
+func (mr *ReadMapTranscriptome) Tag(name string) (string, bool) {
+	samrec := genodatastruct.SamRec{Tags: mr.Tags}
+	return samrec.Tag(name)
+}
+
 //Goroutine infrastruture to generate
 type RMTConstructor struct {
 	In    <-chan genodatastruct.SamRec
-	Out   chan string
+	Out   chan *ReadMapTranscriptome
 	Genes map[string]*genodatastruct.Gene
 	Index map[string]*GeneMapIndex
+	//Library tells the transcript strand of the reads, the alignment
+	//strand by default
+	Library LibraryType
+	//Anchors rejects the split reads of untrusted junctions, none if nil
+	Anchors *AnchorChecker
+	//Rejected is given the alignments failing the anchor checks, if set
+	Rejected func(s genodatastruct.SamRec, reason string)
 }
 
 func (w *RMTConstructor) Construct() {
 	//total := 0
 	for samrec := range w.In {
-		mr := ReadMapTranscriptome{
-			Chromosome: samrec.Chromosome,
-			Strand:     samrec.Strand(),
-			Segment:    samrec.RegionAligned(),
-		}
+		mr := NewReadMapTranscriptome(samrec)
+		mr.Strand = w.Library.ReadStrand(samrec)
 		mr.InvolvedGeneLoci(w.Index)
+		if mr.Strand == "." {
+			mr.Strand = mr.geneStrand(w.Genes)
+		}
+		mr.orderSegments()
+		if w.Anchors != nil {
+			//rejected reads are passed on unclassified to be tallied
+			if mr.Rejected = w.Anchors.Check(samrec, mr); len(mr.Rejected) > 0 {
+				if w.Rejected != nil {
+					w.Rejected(samrec, strings.Join(mr.Rejected, ","))
+				}
+				w.Out <- mr
+				continue
+			}
+		}
 		mr.MapToTran(w.Genes)
-		if len(mr.MapTran) == 0 {
-			continue
+		//reads off the transcripts still count for the junctions,
+		//they are passed on with an empty Class
+		if len(mr.MapTran) > 0 {
+			//total++
+			mr.Class = mr.SpliceType(w.Genes)
 		}
-		//total++
-		w.Out <- mr.SpliceType()
+		w.Out <- mr
 	}
 	//println("I have processed ", total)
 	close(w.Out)
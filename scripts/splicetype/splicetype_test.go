@@ -0,0 +1,83 @@
+package splicetype
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
+)
+
+func TestRMTConstructorOffTranscript(t *testing.T) {
+	gene := graphGene("+", []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 300, End: 400}})
+	genes := map[string]*genodatastruct.Gene{"G": gene}
+	in := make(chan genodatastruct.SamRec, 2)
+	in <- genodatastruct.SamRec{QName: "genic", Chromosome: "chr1", Pos: 151, CIGAR: "50M99N51M"}
+	in <- genodatastruct.SamRec{QName: "intergenic", Chromosome: "chr1", Pos: 1001, CIGAR: "50M99N51M"}
+	close(in)
+	w := RMTConstructor{In: in, Out: make(chan *ReadMapTranscriptome, 2), Genes: genes, Index: SortGeneMap(genes)}
+	go w.Construct()
+	classes := map[string]string{}
+	jc := NewJunctionCounter()
+	for mr := range w.Out {
+		classes[mr.Name] = mr.Class
+		jc.Add(mr)
+	}
+	//reads off the transcripts come out unclassified, their junctions counted
+	if len(classes) != 2 || classes["genic"] != "normal" || classes["intergenic"] != "" {
+		t.Errorf("classes %v, want genic normal and intergenic empty", classes)
+	}
+	if n := jc.Count("chr1", "+", genodatastruct.Coor{Start: 1051, End: 1149}); n != 1 {
+		t.Errorf("%v reads of the intergenic junction, want 1", n)
+	}
+}
+
+func TestRMTConstructorLibrary(t *testing.T) {
+	exons := []genodatastruct.Coor{{Start: 100, End: 200}, {Start: 300, End: 400}, {Start: 600, End: 700}}
+	const reverse = 0x10
+	tests := []struct {
+		library string
+		strand  string //of the gene
+		flag    int64
+		tags    []string
+	}{
+		{"forward", "+", 0, nil},
+		{"forward", "-", reverse, nil},
+		{"reverse", "+", reverse, nil},
+		{"reverse", "-", 0, nil},
+		{"unstranded", "+", reverse, nil},
+		{"unstranded", "-", 0, nil},
+		{"unstranded", "-", 0, []string{"XS:A:-"}},
+		{"fr-firststrand", "+", 0x1 | 0x40 | reverse, nil},
+		{"fr-firststrand", "-", 0x1 | 0x40, nil},
+	}
+	for _, test := range tests {
+		library, err := ParseLibraryType(test.library)
+		if err != nil {
+			t.Fatal(err)
+		}
+		//exons of a reverse strand transcript are in descending order
+		tr := &genodatastruct.Transcript{TranscriptName: "T1", Chromosome: "chr1", Strand: test.strand, Coordinate: genodatastruct.Coor{Start: 100, End: 700},
+			Exons: append([]genodatastruct.Coor{}, exons...)}
+		genodatastruct.SortCoors(tr.Exons, test.strand == "+")
+		tr.Introns = tr.GenerateIntrons()
+		gene := &genodatastruct.Gene{GeneName: "ONE", Chromosome: "chr1", Strand: test.strand, Coordinate: tr.Coordinate, Transcripts: []*genodatastruct.Transcript{tr}}
+		genes := map[string]*genodatastruct.Gene{"G": gene}
+		in := make(chan genodatastruct.SamRec, 2)
+		in <- genodatastruct.SamRec{QName: "skipping", Flag: test.flag, Chromosome: "chr1", Pos: 180, CIGAR: "21M399N21M", Tags: test.tags}
+		in <- genodatastruct.SamRec{QName: "normal", Flag: test.flag, Chromosome: "chr1", Pos: 180, CIGAR: "21M99N101M199N21M", Tags: test.tags}
+		close(in)
+		w := RMTConstructor{In: in, Out: make(chan *ReadMapTranscriptome, 2), Genes: genes, Index: SortGeneMap(genes), Library: library}
+		go w.Construct()
+		classes := map[string]string{}
+		for mr := range w.Out {
+			classes[strings.TrimSuffix(mr.Name, "/1")] = mr.Class
+			//segments follow the exons of the gene strand
+			if mr.Strand != test.strand || (test.strand == "+") != (mr.Segment[0].Start < mr.Segment[1].Start) {
+				t.Errorf("%s library, %s gene: read %s on strand %s with segments %v", test.library, test.strand, mr.Name, mr.Strand, mr.Segment)
+			}
+		}
+		if classes["skipping"] != "exonSkipping" || classes["normal"] != "normal" {
+			t.Errorf("%s library, %s gene: classes %v, want exonSkipping and normal", test.library, test.strand, classes)
+		}
+	}
+}
@@ -45,11 +45,18 @@ func SortGeneMap(Genes map[string]*genodatastruct.Gene) map[string]*GeneMapIndex
 
 //Map mapped read to the transcriptomic origin (RMT)
 type ReadMapTranscriptome struct {
+	Name       string //read name, with /1 or /2 for the mates of a pair
 	Chromosome string
 	Strand     string
 	Segment    []genodatastruct.Coor
 	GeneLoci   []string
 	MapTran    [][]TranCoor //transcriptname->matched exon number of each segment
+	Class      string       //SpliceType of the read
+	NH         int          //number of alignments of the read
+	Weight     float64      //share of the read counted for this alignment, 1 unless a weighted multimapper
+	Tags       []string     //optional fields of the alignment
+	Fields     []string     //all the fields of the alignment line
+	Rejected   []string     //anchor checks failed by the junctions of the read, which is not counted then
 }
 
 //Searching for gene loci that Intersect with any of the segment
@@ -61,24 +68,34 @@ func (mr *ReadMapTranscriptome) InvolvedGeneLoci(index map[string]*GeneMapIndex)
 		return
 	}
 
+	//segments of a reverse strand read are in descending order
+	span := genodatastruct.Coor{Start: mr.Segment[0].Start, End: mr.Segment[0].End}
+	for _, seg := range mr.Segment {
+		if seg.Start < span.Start {
+			span.Start = seg.Start
+		}
+		if seg.End > span.End {
+			span.End = seg.End
+		}
+	}
 	//Narrow down the searching range by binary searching sorted index
 	end := sort.Search(len(index[mr.Chromosome].GeneLoci), func(i int) bool {
-		return index[mr.Chromosome].GeneLoci[i].Locus.Start > mr.Segment[len(mr.Segment)-1].End
+		return index[mr.Chromosome].GeneLoci[i].Locus.Start > span.End
 	})
 	if end == len(index[mr.Chromosome].GeneLoci) {
 		end--
 	}
 	//searching from the non-overlapping loci
 	boundaryIdx := sort.Search(len(index[mr.Chromosome].NonOverlapLoci), func(i int) bool {
-		return index[mr.Chromosome].NonOverlapLoci[i].End >= mr.Segment[0].Start
+		return index[mr.Chromosome].NonOverlapLoci[i].End >= span.Start
 	}) - 1
-	if boundaryIdx == -1 {
-		boundaryIdx = 0
+	boundary := 0 //read within the first locus, search all the way back
+	if boundaryIdx >= 0 {
+		boundary = index[mr.Chromosome].NonOverlapLoci[boundaryIdx].End
 	}
-	boundary := index[mr.Chromosome].NonOverlapLoci[boundaryIdx].End
 
 	//searching backwards from the end gene loci
-	for i := end; i > 0; i-- {
+	for i := end; i >= 0; i-- {
 		genecoorpair := index[mr.Chromosome].GeneLoci[i]
 		if genecoorpair.Locus.Start <= boundary {
 			//the rest wont intersect with the read.
@@ -103,6 +120,7 @@ func (mr *ReadMapTranscriptome) InvolvedGeneLoci(index map[string]*GeneMapIndex)
 
 //Detail annotate the segment's Exon/Intron location in the transcriptome
 type TranCoor struct {
+	GeneID         string
 	TranscriptName string
 	IsIn           bool
 	ExonID         []int
@@ -131,7 +149,7 @@ func (mr *ReadMapTranscriptome) MapToTran(genes map[string]*genodatastruct.Gene)
 			//Initiate Temp
 			emptyCnt := 0
 			for i, seg := range mr.Segment {
-				temp[i] = TranCoor{TranscriptName: t.TranscriptName}
+				temp[i] = TranCoor{GeneID: geneid, TranscriptName: t.TranscriptName}
 				//which exon and intron
 				temp[i].ExonID = t.WhichExonIntersect(seg)
 				temp[i].IntronID = t.WhichIntronIntersect(seg)
@@ -2,6 +2,8 @@ package splicetype
 
 import (
 	"os"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
@@ -28,6 +30,38 @@ func TestTranscriptOrigin(t *testing.T) {
 	//}
 }
 
+func TestInvolvedGeneLoci(t *testing.T) {
+	genes := map[string]*genodatastruct.Gene{
+		"G1": {Chromosome: "chr1", Coordinate: genodatastruct.Coor{Start: 100, End: 250}},
+		"G2": {Chromosome: "chr1", Coordinate: genodatastruct.Coor{Start: 300, End: 400}},
+		"G3": {Chromosome: "chr1", Coordinate: genodatastruct.Coor{Start: 1000, End: 1200}},
+		"G4": {Chromosome: "chr1", Coordinate: genodatastruct.Coor{Start: 450, End: 550}},
+	}
+	index := SortGeneMap(genes)
+	tests := []struct {
+		name       string
+		chromosome string
+		segments   []genodatastruct.Coor
+		want       string
+	}{
+		{"first locus of the chromosome", "chr1", []genodatastruct.Coor{{Start: 150, End: 200}}, "G1"},
+		{"last locus of the chromosome", "chr1", []genodatastruct.Coor{{Start: 1050, End: 1100}}, "G3"},
+		{"spliced across loci", "chr1", []genodatastruct.Coor{{Start: 150, End: 200}, {Start: 320, End: 350}}, "G1 G2"},
+		//segments of a reverse strand read are in descending order
+		{"reverse strand", "chr1", []genodatastruct.Coor{{Start: 460, End: 500}, {Start: 150, End: 200}}, "G1 G4"},
+		{"intergenic", "chr1", []genodatastruct.Coor{{Start: 600, End: 700}}, "Intergenic"},
+		{"unknown chromosome", "chr2", []genodatastruct.Coor{{Start: 150, End: 200}}, "No Chromosome"},
+	}
+	for _, test := range tests {
+		mr := &ReadMapTranscriptome{Chromosome: test.chromosome, Segment: test.segments}
+		mr.InvolvedGeneLoci(index)
+		sort.Strings(mr.GeneLoci)
+		if got := strings.Join(mr.GeneLoci, " "); got != test.want {
+			t.Errorf("%s: gene loci %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
 func stabletest(gtf, sam string) {
 	//result := []string{}
 	genes := gtfparser.ParsegtfConcurrent(gtf)
@@ -39,23 +73,23 @@ func stabletest(gtf, sam string) {
 		return false
 	}
 	samchan := samparser.ParseSam(sam, mapqfilter)
-	total, cnt := 0, 0
-	var out []chan []int
+	cnt := 0
+	var out []chan *ReadMapTranscriptome
 	for i := 0; i < 6; i++ {
-		o := make(chan []int)
+		o := make(chan *ReadMapTranscriptome)
 		out = append(out, o)
 		worker := RMTConstructor{
-			in:    samchan,
-			out:   o,
-			index: index,
-			genes: genes,
+			In:    samchan,
+			Out:   o,
+			Index: index,
+			Genes: genes,
 		}
 		go worker.Construct()
 	}
 	for _, o := range out {
-		raw := <-o
-		cnt += raw[0]
-		total += raw[1]
+		for range o {
+			cnt++
+		}
 	}
 	//for samrec := range samchan {
 	//	mr := ReadMapTranscriptome{
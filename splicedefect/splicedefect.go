@@ -1,75 +1,424 @@
 package main
 
 import (
-	"os"
+	"flag"
 	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/Hanbin/AberrantSplice/Internal/genodatastruct"
 	"github.com/Hanbin/AberrantSplice/Internal/gtfparser"
+	"github.com/Hanbin/AberrantSplice/Internal/outfile"
 	"github.com/Hanbin/AberrantSplice/Internal/samparser"
+	"github.com/Hanbin/AberrantSplice/Internal/samplesheet"
+	"github.com/Hanbin/AberrantSplice/Internal/sjparser"
 	"github.com/Hanbin/AberrantSplice/scripts/splicetype"
 )
 
+//outputs of a sample and their options, empty paths are not written
+type outputs struct {
+	cryptic, sites, events, genes, ir, sj, junctionBed, junctionTypes, lsv, partition, annotated, readReport, equivalenceClasses, abundance string
+
+	partitionTag string
+	whitelist    map[string]bool
+	groups       map[string]string
+
+	crypticMin, sitesMin, eventsMin, irMinCover, lsvMin int
+	psiZ, fragmentLength                                float64
+	canonicalOnly                                       bool
+}
+
+//prefixed names the outputs of a sample in dir after the sample ID
+func (o outputs) prefixed(dir, sample string) outputs {
+	for _, path := range []*string{&o.cryptic, &o.sites, &o.events, &o.genes, &o.ir, &o.sj, &o.junctionBed, &o.junctionTypes, &o.lsv, &o.partition, &o.annotated, &o.readReport, &o.equivalenceClasses, &o.abundance} {
+		if *path != "" {
+			*path = filepath.Join(dir, sample+"."+filepath.Base(*path))
+		}
+	}
+	return o
+}
+
 func main() {
-	gtf, sam := os.Args[1], os.Args[2]
-	genes := gtfparser.ParsegtfConcurrent(gtf)
+	var o outputs
+	flag.StringVar(&o.cryptic, "cryptic", "", "output prefix of cryptic exon candidates (<prefix>.gtf and <prefix>.bed)")
+	flag.IntVar(&o.crypticMin, "cryptic-min", 2, "minimum reads supporting a cryptic exon")
+	flag.StringVar(&o.sites, "sites", "", "output table of truncated and extended exon splice sites")
+	flag.IntVar(&o.sitesMin, "sites-min", 1, "minimum reads supporting a shifted splice site")
+	flag.StringVar(&o.events, "events", "", "output table of per-event inclusion and exclusion reads")
+	flag.StringVar(&o.genes, "genes", "", "output table of per-gene reads of each splice type")
+	flag.IntVar(&o.eventsMin, "events-min", 1, "minimum reads classified to an event")
+	flag.Float64Var(&o.psiZ, "psi-z", splicetype.Z95, "z score of the PSI confidence interval")
+	flag.StringVar(&o.ir, "ir", "", "output table of intron retention per gene intron")
+	flag.IntVar(&o.irMinCover, "ir-min-cover", 10, "intron depth plus splice reads below which an intron is flagged LowCover")
+	flag.StringVar(&o.sj, "sj", "", "output junction table in STAR SJ.out.tab format")
+	flag.StringVar(&o.junctionBed, "junction-bed", "", "output junctions as BED12")
+	flag.StringVar(&o.annotated, "annotated", "", "output of the alignments tagged with their splice category (sc), genes (gi), compatible transcripts (tn) and junction classes (jn), "+
+		"and of the reads left out tagged with the reason (rj: unmapped, filtered, umiDuplicate, shortAnchor, anchorMismatch), "+
+		"BAM if the name ends in .bam and SAM otherwise, unsorted: run samtools sort and samtools index on it for a genome browser")
+	flag.StringVar(&o.readReport, "read-report", "", "output of the classification of each read: its segments, genes, and the exons, introns and category of the read against each of their transcripts, "+
+		"JSON Lines if the name ends in .json or .jsonl and a table with a line per read and transcript otherwise")
+	flag.StringVar(&o.equivalenceClasses, "equivalence-classes", "", "output table of the fragments, single reads or mate pairs, counted by their set of compatible transcripts, "+
+		"whose introns are the junctions of the fragment and whose exons hold its segments")
+	flag.StringVar(&o.abundance, "abundance", "", "output table of the reads, TPM and isoform fraction of each transcript estimated by expectation maximization over the equivalence classes")
+	flag.Float64Var(&o.fragmentLength, "fragment-length", splicetype.DefaultFragmentLength, "mean fragment length of the effective transcript lengths for -abundance")
+	format := flag.String("format", "auto", "input format: sam, sj (STAR SJ.out.tab), junc (regtools/leafcutter) or auto by file name: sj for names ending in SJ.out.tab, junc for .junc and sam otherwise")
+	flag.StringVar(&o.junctionTypes, "junction-types", "", "output table of junction classification (junction input only)")
+	flag.StringVar(&o.lsv, "lsv", "", "output table of local splicing variations of the gene splice graphs")
+	flag.IntVar(&o.lsvMin, "lsv-min", 1, "minimum reads of the junctions of a local splicing variation")
+	fasta := flag.String("fasta", "", "genome FASTA (plain or bgzip, indexed by .fai if present) to annotate junction motifs")
+	siteModel := flag.String("site-model", "", "splice site frequency matrices replacing the built-in ones (lines of donor|acceptor and A C G T frequencies)")
+	flag.BoolVar(&o.canonicalOnly, "canonical-only", false, "discard events with novel junctions of non-canonical motif")
+	flag.StringVar(&o.partition, "partition", "", "output prefix of the reads split by -partition-tag: <prefix>.events.tsv count matrix, <prefix>.summary.tsv, "+
+		"and sparse Matrix Market <prefix>.events.inclusion.mtx, <prefix>.events.exclusion.mtx and <prefix>.junctions.mtx with their .rows.tsv and .features.tsv names")
+	flag.StringVar(&o.partitionTag, "partition-tag", "RG", "optional field splitting the reads for -partition: RG, CB or any tag, CB by default with -clusters")
+	clusters := flag.String("clusters", "", "barcode to cluster table (tab or comma separated) pooling the cells of each cluster for -partition")
+	whitelist := flag.String("whitelist", "", "partition tag values to keep, one per line")
+	readFlags := splicetype.ReadFlags(flag.CommandLine)
+	flag.Lookup("umi-cell-tag").Usage += "; the -partition-tag with -partition"
+	libraryName := flag.String("library", "forward", "library type for the read strands: forward, reverse, unstranded, fr-firststrand or fr-secondstrand; the library column of the sample sheet overrides it")
+	samples := flag.String("samples", "", "sample sheet (tab separated, or comma separated .csv) with sample, path, group and optional library_type and read_group columns, replacing the input argument")
+	jobs := flag.Int("j", 2, "samples processed at the same time in batch mode")
+	outdir := flag.String("outdir", ".", "directory of the per-sample outputs, named <sample>.<output>, in batch mode")
+	matrix := flag.String("matrix", "events_matrix.tsv", "merged event count matrix of the samples in the output directory, in batch mode")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <gtf> <sam|SJ.out.tab|junc>\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [options] -samples <sample sheet> <gtf>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if (*samples == "" && flag.NArg() != 2) || (*samples != "" && flag.NArg() != 1) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	readOpt := *readFlags
+	library, err := splicetype.ParseLibraryType(*libraryName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	readOpt.Library = library
+	if *whitelist != "" {
+		if o.whitelist, err = splicetype.ReadWhitelist(*whitelist); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *clusters != "" {
+		if o.groups, err = splicetype.ReadGroups(*clusters); err != nil {
+			log.Fatal(err)
+		}
+		tagSet := false
+		flag.Visit(func(f *flag.Flag) { tagSet = tagSet || f.Name == "partition-tag" })
+		if !tagSet {
+			o.partitionTag = "CB"
+		}
+	}
+	if o.partition != "" {
+		cellTagSet := false
+		flag.Visit(func(f *flag.Flag) { cellTagSet = cellTagSet || f.Name == "umi-cell-tag" })
+		if !cellTagSet {
+			readOpt.CellTag = o.partitionTag
+		}
+	}
+	genes := gtfparser.ParsegtfConcurrent(flag.Arg(0))
 	index := splicetype.SortGeneMap(genes)
-	mapqfilter := func(s genodatastruct.SamRec) bool {
-		if s.MAPQ > 30 {
-			return true
-		}
-		return false
-	}
-	samchan := samparser.ParseSam(sam, mapqfilter)
-	normal, intronInc, exonSkip := 0, 0, 0
-	var out []chan string
-	nworker := 5
-	for i := 0; i < nworker; i++ {
-		o := make(chan string)
-		out = append(out, o)
-		worker := splicetype.RMTConstructor{
-			In:    samchan,
-			Out:   o,
-			Index: index,
-			Genes: genes,
-		}
-		go worker.Construct()
-	}
-	//merge chan
+	var genome *genodatastruct.Fasta
+	if *fasta != "" {
+		var err error
+		if genome, err = genodatastruct.OpenFasta(*fasta); err != nil {
+			log.Fatal(err)
+		}
+		defer genome.Close()
+	}
+	model := splicetype.DefaultSiteModel()
+	if *siteModel != "" {
+		text, err := ioutil.ReadFile(*siteModel)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if model, err = splicetype.ParseSiteModel(string(text)); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *samples == "" {
+		run(flag.Arg(1), *format, readOpt, o, genes, index, genome, model, "")
+		return
+	}
+	sheet := samplesheet.ParseSampleSheet(*samples)
+	sampleOpts := make([]splicetype.ReadOptions, len(sheet))
+	for i, s := range sheet {
+		if sampleOpts[i], err = readOpt.SampleOptions(s.ReadGroup, s.Library); err != nil {
+			log.Fatalln("Sample ", s.ID, ": ", err)
+		}
+	}
+	if err := os.MkdirAll(*outdir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	//bounded pool of samples, each running its own read workers
+	tables := make([]*splicetype.EventTable, len(sheet))
+	pool := make(chan bool, *jobs)
 	var wg sync.WaitGroup
-	wg.Add(nworker)
-	mergechan := make(chan string)
-	output := func(c chan string) {
-		for v := range c {
-			mergechan <- v
+	for i, s := range sheet {
+		wg.Add(1)
+		go func(i int, s samplesheet.Sample) {
+			defer wg.Done()
+			pool <- true
+			defer func() { <-pool }()
+			log.Println("Processing ", s.ID, " from ", s.Path)
+			tables[i] = run(s.Path, *format, sampleOpts[i], o.prefixed(*outdir, s.ID), genes, index, genome, model, s.ID+": ")
+		}(i, s)
+	}
+	wg.Wait()
+	names := []string{}
+	for _, s := range sheet {
+		names = append(names, s.ID)
+	}
+	events, counts := splicetype.CountEvents(tables, o.eventsMin)
+	outfile.Write(filepath.Join(*outdir, *matrix), func(f *os.File) error { return splicetype.WriteEventMatrix(f, events, counts, names) })
+}
+
+//run classifies the alignments or junctions of a sample, writes its outputs
+//and returns its event table. The printed summaries start with the label
+func run(input, format string, readOpt splicetype.ReadOptions, o outputs, genes map[string]*genodatastruct.Gene,
+	index map[string]*splicetype.GeneMapIndex, genome *genodatastruct.Fasta, model *splicetype.SiteModel, label string) *splicetype.EventTable {
+	junctions := splicetype.NewJunctionCounter()
+	crypticExons := splicetype.NewCrypticExonFinder(genes, junctions)
+	siteShifts := splicetype.NewSiteShiftCounter(genes)
+	events := splicetype.NewEventTable(genes, junctions)
+	events.CanonicalOnly = o.canonicalOnly
+	var retention *splicetype.IRCollector
+	if o.ir != "" {
+		retention = splicetype.NewIRCollector(genes, junctions)
+	}
+	var partition *splicetype.Partition
+	if o.partition != "" {
+		partition = splicetype.NewPartition(o.partitionTag, o.whitelist, genes)
+		partition.Groups = o.groups
+	}
+
+	if format == "auto" {
+		format = sjparser.DetectFormat(input)
+	}
+	if o.canonicalOnly && genome == nil && format != "sj" {
+		log.Fatalln("-canonical-only needs -fasta unless the input is a STAR SJ.out.tab")
+	}
+	switch format {
+	case "sam":
+		var annotated *splicetype.AnnotatedWriter
+		if o.annotated != "" {
+			header, err := samparser.ReadHeader(input)
+			if err != nil {
+				log.Fatal(err)
+			}
+			header = samparser.AddProgram(header, "splicedefect", "", strings.Join(os.Args, " "))
+			f, err := os.Create(o.annotated)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			if annotated, err = splicetype.NewAnnotatedWriter(f, header, strings.HasSuffix(o.annotated, ".bam"), genes, index); err != nil {
+				log.Fatal(err)
+			}
+		}
+		var readReport *splicetype.ReadReportWriter
+		if o.readReport != "" {
+			f, err := os.Create(o.readReport)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			jsonLines := strings.HasSuffix(o.readReport, ".json") || strings.HasSuffix(o.readReport, ".jsonl")
+			if readReport, err = splicetype.NewReadReportWriter(f, jsonLines, genes); err != nil {
+				log.Fatal(err)
+			}
+		}
+		var classes *splicetype.EquivalenceClassCounter
+		if o.equivalenceClasses != "" || o.abundance != "" {
+			classes = splicetype.NewEquivalenceClassCounter(genes)
+		}
+		collect := func(mr *splicetype.ReadMapTranscriptome) {
+			junctions.Add(mr)
+			crypticExons.Add(mr)
+			siteShifts.Add(mr)
+			events.Add(mr)
+			if retention != nil {
+				retention.Add(mr)
+			}
+			if partition != nil {
+				partition.Add(mr)
+			}
+			if annotated != nil {
+				annotated.Add(mr)
+			}
+			if readReport != nil {
+				readReport.Add(mr)
+			}
+			if classes != nil {
+				classes.Add(mr)
+			}
+		}
+		rejects := []func(genodatastruct.SamRec, string){}
+		if partition != nil {
+			rejects = append(rejects, partition.Reject)
+		}
+		if annotated != nil {
+			rejects = append(rejects, annotated.Reject)
+		}
+		if len(rejects) > 0 {
+			readOpt.Rejected = func(s genodatastruct.SamRec, reason string) {
+				for _, reject := range rejects {
+					reject(s, reason)
+				}
+			}
+		}
+		classifyReads(input, readOpt, genes, index, collect, label)
+		if annotated != nil {
+			if err := annotated.Close(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if readReport != nil {
+			if err := readReport.Close(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if classes != nil {
+			ecs := classes.Classes()
+			fmt.Printf(label+"Fragments compatible with no transcript of their genes %s\n", splicetype.FormatCount(classes.Unassigned))
+			if o.equivalenceClasses != "" {
+				outfile.Write(o.equivalenceClasses, func(f *os.File) error { return splicetype.WriteEquivalenceClasses(f, ecs) })
+			}
+			if o.abundance != "" {
+				abundances := splicetype.EstimateAbundance(ecs, genes, o.fragmentLength)
+				outfile.Write(o.abundance, func(f *os.File) error { return splicetype.WriteAbundance(f, abundances) })
+			}
+		}
+		if genome != nil {
+			if err := junctions.AnnotateMotifs(genome); err != nil {
+				log.Fatal(err)
+			}
+		}
+	case "sj", "junc":
+		records := sjparser.ParseJunctions(input, format)
+		if genome != nil {
+			if err := splicetype.RecordMotifs(genome, records); err != nil {
+				log.Fatal(err)
+			}
 		}
-		wg.Done()
+		types := classifyJunctions(records, events, index, label)
+		if o.junctionTypes != "" {
+			outfile.Write(o.junctionTypes, func(f *os.File) error { return splicetype.WriteJunctionTypes(f, types) })
+		}
+		//read level outputs need alignments
+		if o.cryptic != "" || o.sites != "" || retention != nil || partition != nil || o.annotated != "" || o.readReport != "" || o.equivalenceClasses != "" || o.abundance != "" {
+			log.Println(label + "Cryptic exons, shifted sites, intron retention, partitions, annotated alignments, read reports, equivalence classes and abundances need alignments, skipped for junction input")
+			o.cryptic, o.sites, retention, partition = "", "", nil, nil
+		}
+	default:
+		log.Fatalln("Unknown input format ", format)
+	}
+
+	if o.cryptic != "" {
+		candidates := crypticExons.Candidates(o.crypticMin)
+		outfile.Write(o.cryptic+".gtf", func(f *os.File) error { return splicetype.WriteCrypticGTF(f, candidates, genes) })
+		outfile.Write(o.cryptic+".bed", func(f *os.File) error { return splicetype.WriteCrypticBED(f, candidates) })
+	}
+	if o.sites != "" {
+		shifted := siteShifts.Sites(o.sitesMin)
+		if genome != nil {
+			if err := model.ScoreSites(genome, shifted); err != nil {
+				log.Fatal(err)
+			}
+		}
+		outfile.Write(o.sites, func(f *os.File) error { return splicetype.WriteSiteShifts(f, shifted) })
+	}
+	if o.sj != "" {
+		annotated := splicetype.AnnotatedJunctions(genes)
+		outfile.Write(o.sj, func(f *os.File) error { return junctions.WriteSJTab(f, annotated) })
+	}
+	if o.junctionBed != "" {
+		outfile.Write(o.junctionBed, func(f *os.File) error { return junctions.WriteBED12(f) })
 	}
-	for _, o := range out {
-		go output(o)
+	if o.lsv != "" {
+		graphs := splicetype.BuildSpliceGraphs(genes, index, junctions)
+		outfile.Write(o.lsv, func(f *os.File) error { return splicetype.WriteLSVs(f, graphs, genes, o.lsvMin) })
 	}
-	go func() {
-		wg.Wait()
-		close(mergechan)
-	}()
-	//take results
-	for s := range mergechan {
-		if s == "normal" {
-			normal++
+	if retention != nil {
+		report := retention.Report(o.irMinCover)
+		outfile.Write(o.ir, func(f *os.File) error { return splicetype.WriteIntronRetention(f, report) })
+	}
+	if partition != nil {
+		names := partition.Names()
+		counted, counts := splicetype.CountEvents(partition.EventTables(), o.eventsMin)
+		outfile.Write(o.partition+".events.tsv", func(f *os.File) error { return splicetype.WriteEventMatrix(f, counted, counts, names) })
+		outfile.Write(o.partition+".summary.tsv", func(f *os.File) error { return splicetype.WritePartitionSummary(f, partition) })
+		outfile.Write(o.partition+".rows.tsv", func(f *os.File) error {
+			for _, name := range names {
+				if _, err := fmt.Fprintln(f, name); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		inclusion, exclusion := splicetype.EventMatrices(counts, len(names))
+		outfile.Write(o.partition+".events.inclusion.mtx", func(f *os.File) error { return splicetype.WriteMatrixMarket(f, inclusion) })
+		outfile.Write(o.partition+".events.exclusion.mtx", func(f *os.File) error { return splicetype.WriteMatrixMarket(f, exclusion) })
+		outfile.Write(o.partition+".events.features.tsv", func(f *os.File) error { return splicetype.WriteEventFeatures(f, counted) })
+		junctionNames, junctionCounts := partition.JunctionMatrix()
+		outfile.Write(o.partition+".junctions.mtx", func(f *os.File) error { return splicetype.WriteMatrixMarket(f, junctionCounts) })
+		outfile.Write(o.partition+".junctions.features.tsv", func(f *os.File) error { return splicetype.WriteJunctionFeatures(f, junctionNames) })
+	}
+	if o.events != "" || o.genes != "" {
+		table := events.Events(o.eventsMin)
+		if genome != nil {
+			if err := model.ScoreEvents(genome, table); err != nil {
+				log.Fatal(err)
+			}
 		}
-		if s == "intronInclusion" {
-			intronInc++
+		if o.events != "" {
+			outfile.Write(o.events, func(f *os.File) error { return splicetype.WriteEvents(f, table, o.psiZ) })
 		}
-		if s == "exonSkipping" {
-			exonSkip++
+		if o.genes != "" {
+			outfile.Write(o.genes, func(f *os.File) error { return events.WriteGeneSummary(f, table) })
 		}
-		//if s == "fatal" {
-		//	log.Fatalln("Exception read")
-		//}
 	}
+	return events
+}
+
+//classifyReads runs the read classification workers on the alignments and
+//hands every classified read to collect
+func classifyReads(sam string, readOpt splicetype.ReadOptions, genes map[string]*genodatastruct.Gene,
+	index map[string]*splicetype.GeneMapIndex, collect func(*splicetype.ReadMapTranscriptome), label string) {
+	classes, rejected := splicetype.ClassifyAlignments(sam, readOpt, genes, index, 5, collect)
+	normal := classes["normal"]
+	fmt.Fprintln(os.Stderr, label+"Normal reads #", splicetype.FormatCount(normal))
+	fmt.Printf(label+"Intron Inclusion reads %s of %e\n", splicetype.FormatCount(classes["intronInclusion"]), classes["intronInclusion"]/normal)
+	fmt.Printf(label+"Exon skipping reads %s of %e\n", splicetype.FormatCount(classes["exonSkipping"]), classes["exonSkipping"]/normal)
+	fmt.Printf(label+"Cryptic exon reads %s of %e\n", splicetype.FormatCount(classes["crypticExon"]), classes["crypticExon"]/normal)
+	fmt.Printf(label+"Exon truncation reads %s of %e\n", splicetype.FormatCount(classes["truncExon"]), classes["truncExon"]/normal)
+	fmt.Printf(label+"Exon extension reads %s of %e\n", splicetype.FormatCount(classes["extendExon"]), classes["extendExon"]/normal)
+	fmt.Printf(label+"Junctions filtered for short anchors %d, for anchor mismatches %d\n", rejected[splicetype.ShortAnchor], rejected[splicetype.AnchorMismatch])
+	if readOpt.UMITag != "" {
+		fmt.Printf(label+"UMI duplicates collapsed %d\n", rejected[splicetype.UMIDuplicate])
+	}
+}
 
-	println("Normal reads #", normal)
-	fmt.Printf("Intron Inclusion reads %d of %e\n", intronInc, float64(intronInc)/float64(normal))
-	fmt.Printf("Exon skipping reads %d of %e\n", exonSkip, float64(exonSkip)/float64(normal))
+//classifyJunctions adds the junction records to the event table and
+//prints the number of junctions of each class
+func classifyJunctions(records []genodatastruct.JunctionRec, events *splicetype.EventTable, index map[string]*splicetype.GeneMapIndex, label string) []splicetype.JunctionType {
+	types := []splicetype.JunctionType{}
+	nclass, nreads := map[string]int{}, map[string]int{}
+	for _, rec := range records {
+		jt := events.AddJunction(rec, index)
+		types = append(types, jt)
+		nclass[jt.Class]++
+		nreads[jt.Class] += jt.Reads
+	}
+	for _, class := range []string{splicetype.AnnotatedJunction, "exonSkipping", splicetype.NovelDonor, splicetype.NovelAcceptor, splicetype.NovelJunction, splicetype.NoGene} {
+		fmt.Printf("%s%s junctions %d with %d reads\n", label, class, nclass[class], nreads[class])
+	}
+	return types
 }
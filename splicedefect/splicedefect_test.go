@@ -0,0 +1,25 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestOutputsPrefixed(t *testing.T) {
+	o := outputs{events: "events.tsv", sj: "out/junctions.SJ.out.tab", annotated: "reads.bam", crypticMin: 3, partitionTag: "CB"}
+	p := o.prefixed("batch", "s1")
+	want := map[string]string{
+		p.events:    filepath.Join("batch", "s1.events.tsv"),
+		p.sj:        filepath.Join("batch", "s1.junctions.SJ.out.tab"),
+		p.annotated: filepath.Join("batch", "s1.reads.bam"),
+	}
+	for got, w := range want {
+		if got != w {
+			t.Errorf("output %s, want %s", got, w)
+		}
+	}
+	//unset outputs stay unset, the options and the shared outputs are kept
+	if p.genes != "" || p.abundance != "" || p.crypticMin != 3 || p.partitionTag != "CB" || o.events != "events.tsv" {
+		t.Errorf("prefixed outputs %+v of %+v", p, o)
+	}
+}
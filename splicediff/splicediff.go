@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+
+	"github.com/Hanbin/AberrantSplice/Internal/gtfparser"
+	"github.com/Hanbin/AberrantSplice/Internal/outfile"
+	"github.com/Hanbin/AberrantSplice/Internal/samplesheet"
+	"github.com/Hanbin/AberrantSplice/Internal/sjparser"
+	"github.com/Hanbin/AberrantSplice/scripts/splicetype"
+)
+
+//splicediff tests the differential usage of splicing events between two
+//groups of samples listed in a sample sheet
+func main() {
+	out := flag.String("o", "splicediff.tsv", "output table of differential events")
+	groupA := flag.String("group-a", "", "reference group, the first group of the sheet by default")
+	groupB := flag.String("group-b", "", "compared group, the second group of the sheet by default")
+	eventsMin := flag.Int("events-min", 2, "minimum reads classified to an event over all the samples")
+	sampleMin := flag.Float64("sample-min", 1, "minimum normalized reads for a sample to be informative for an event")
+	isoformSwitch := flag.String("isoform-switch", "", "output prefix of the isoform switches between the groups from the transcript abundances of the alignments: "+
+		"<prefix>.isoforms.tsv tests the isoform fraction of each transcript and <prefix>.switches.tsv lists the genes changing their dominant isoform by -switch-q and -switch-delta-if with the events told apart by the two isoforms")
+	switchQ := flag.Float64("switch-q", 0.05, "largest q-value of both isoforms of an isoform switch")
+	switchDeltaIF := flag.Float64("switch-delta-if", 0.1, "least change of isoform fraction of both isoforms of an isoform switch")
+	fragmentLength := flag.Float64("fragment-length", splicetype.DefaultFragmentLength, "mean fragment length of the effective transcript lengths for -isoform-switch")
+	format := flag.String("format", "auto", "input format: sam, sj (STAR SJ.out.tab), junc (regtools/leafcutter) or auto by file name: sj for names ending in SJ.out.tab, junc for .junc and sam otherwise")
+	readFlags := splicetype.ReadFlags(flag.CommandLine)
+	libraryName := flag.String("library", "forward", "library type for the read strands: forward, reverse, unstranded, fr-firststrand or fr-secondstrand; the library column of the sample sheet overrides it")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <gtf> <sample sheet>\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "The sample sheet is tab separated, or comma separated if named .csv, with a header of at least sample, path and group")
+		fmt.Fprintln(flag.CommandLine.Output(), "and optional library_type and read_group columns")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	readOpt := *readFlags
+	library, err := splicetype.ParseLibraryType(*libraryName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	readOpt.Library = library
+	samples := samplesheet.ParseSampleSheet(flag.Arg(1))
+	groups := samplesheet.Groups(samples)
+	if *groupA == "" && len(groups) > 0 {
+		*groupA = groups[0]
+	}
+	if *groupB == "" && len(groups) > 1 {
+		*groupB = groups[1]
+	}
+	if *groupA == "" || *groupB == "" || *groupA == *groupB {
+		log.Fatalln("Need two groups to compare, the sheet has ", groups)
+	}
+
+	genes := gtfparser.ParsegtfConcurrent(flag.Arg(0))
+	index := splicetype.SortGeneMap(genes)
+	tables := []*splicetype.EventTable{}
+	abundances := [][]*splicetype.TranscriptAbundance{}
+	names := []string{}
+	group := []int{}
+	for _, s := range samples {
+		g := -1
+		switch s.Group {
+		case *groupA:
+			g = 0
+		case *groupB:
+			g = 1
+		default:
+			continue
+		}
+		f := *format
+		if f == "auto" {
+			f = sjparser.DetectFormat(s.Path)
+		}
+		log.Println("Classifying ", s.ID, " (", s.Group, ") from ", s.Path)
+		sampleOpt, err := readOpt.SampleOptions(s.ReadGroup, s.Library)
+		if err != nil {
+			log.Fatalln("Sample ", s.ID, ": ", err)
+		}
+		if *isoformSwitch == "" {
+			tables = append(tables, splicetype.SampleEvents(s.Path, f, sampleOpt, genes, index, 5))
+		} else {
+			if f != "sam" {
+				log.Fatalln("Isoform switching needs alignments, the input of ", s.ID, " is ", f)
+			}
+			classes := splicetype.NewEquivalenceClassCounter(genes)
+			tables = append(tables, splicetype.SampleEvents(s.Path, f, sampleOpt, genes, index, 5, classes.Add))
+			abundances = append(abundances, splicetype.EstimateAbundance(classes.Classes(), genes, *fragmentLength))
+		}
+		names = append(names, s.ID)
+		group = append(group, g)
+	}
+
+	events, counts := splicetype.CountEvents(tables, *eventsMin)
+	results := splicetype.TestEvents(events, counts, group, *sampleMin)
+	tested := 0
+	for _, r := range results {
+		if !math.IsNaN(r.P) {
+			tested++
+		}
+	}
+	fmt.Printf("Events %d, tested %d between %s and %s\n", len(results), tested, *groupA, *groupB)
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	if err := splicetype.WriteDiff(f, results, names, [2]string{*groupA, *groupB}); err != nil {
+		log.Fatal(err)
+	}
+
+	if *isoformSwitch != "" {
+		usages := splicetype.TestIsoformUsage(abundances, group, *sampleMin)
+		switches := splicetype.IsoformSwitches(usages, genes, *switchQ, *switchDeltaIF)
+		fmt.Printf("Isoforms %d, genes switching their dominant isoform %d between %s and %s\n", len(usages), len(switches), *groupA, *groupB)
+		outfile.Write(*isoformSwitch+".isoforms.tsv", func(f *os.File) error {
+			return splicetype.WriteIsoformUsage(f, usages, names, [2]string{*groupA, *groupB})
+		})
+		outfile.Write(*isoformSwitch+".switches.tsv", func(f *os.File) error {
+			return splicetype.WriteIsoformSwitches(f, switches, [2]string{*groupA, *groupB})
+		})
+	}
+}
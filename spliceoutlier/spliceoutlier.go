@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+
+	"github.com/Hanbin/AberrantSplice/Internal/gtfparser"
+	"github.com/Hanbin/AberrantSplice/Internal/samplesheet"
+	"github.com/Hanbin/AberrantSplice/Internal/sjparser"
+	"github.com/Hanbin/AberrantSplice/scripts/splicetype"
+)
+
+//spliceoutlier scores the splicing events of patients against a cohort of
+//control samples listed in the same sample sheet
+func main() {
+	out := flag.String("o", "spliceoutlier.tsv", "output table of the scored events, ranked by gene for each patient")
+	controlGroup := flag.String("controls", "control", "group of the control samples, the other samples are scored as patients")
+	patient := flag.String("patient", "", "score only this sample")
+	eventsMin := flag.Int("events-min", 2, "minimum reads classified to an event over all the samples")
+	opt := splicetype.DefaultOutlierOptions
+	flag.Float64Var(&opt.MinPatientReads, "patient-min", opt.MinPatientReads, "minimum normalized reads of the patient for an event to be scored")
+	flag.Float64Var(&opt.MinControlReads, "control-min", opt.MinControlReads, "minimum normalized reads for a control to be informative")
+	flag.IntVar(&opt.MinControls, "min-controls", opt.MinControls, "minimum informative controls for an event to be scored")
+	flag.Float64Var(&opt.MinSD, "min-sd", opt.MinSD, "floor of the control PSI standard deviation for the z-score")
+	format := flag.String("format", "auto", "input format: sam, sj (STAR SJ.out.tab), junc (regtools/leafcutter) or auto by file name: sj for names ending in SJ.out.tab, junc for .junc and sam otherwise")
+	readFlags := splicetype.ReadFlags(flag.CommandLine)
+	libraryName := flag.String("library", "forward", "library type for the read strands: forward, reverse, unstranded, fr-firststrand or fr-secondstrand; the library column of the sample sheet overrides it")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <gtf> <sample sheet>\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "The sample sheet is tab separated, or comma separated if named .csv, with a header of at least sample, path and group")
+		fmt.Fprintln(flag.CommandLine.Output(), "and optional library_type and read_group columns")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	readOpt := *readFlags
+	library, err := splicetype.ParseLibraryType(*libraryName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	readOpt.Library = library
+	samples := samplesheet.ParseSampleSheet(flag.Arg(1))
+	selected := []samplesheet.Sample{}
+	controls := []int{}
+	patients := []int{}
+	for _, s := range samples {
+		switch {
+		case s.Group == *controlGroup:
+			controls = append(controls, len(selected))
+		case *patient == "" || s.ID == *patient:
+			patients = append(patients, len(selected))
+		default:
+			continue
+		}
+		selected = append(selected, s)
+	}
+	if len(controls) == 0 {
+		log.Fatalln("No sample of the control group ", *controlGroup, " in ", flag.Arg(1))
+	}
+	if len(patients) == 0 {
+		log.Fatalln("No patient sample to score in ", flag.Arg(1))
+	}
+	if len(controls) < opt.MinControls {
+		log.Println("Warning: ", len(controls), " controls, less than the ", opt.MinControls, " needed to score an event")
+	}
+
+	genes := gtfparser.ParsegtfConcurrent(flag.Arg(0))
+	index := splicetype.SortGeneMap(genes)
+	tables := []*splicetype.EventTable{}
+	for _, s := range selected {
+		f := *format
+		if f == "auto" {
+			f = sjparser.DetectFormat(s.Path)
+		}
+		log.Println("Classifying ", s.ID, " (", s.Group, ") from ", s.Path)
+		sampleOpt, err := readOpt.SampleOptions(s.ReadGroup, s.Library)
+		if err != nil {
+			log.Fatalln("Sample ", s.ID, ": ", err)
+		}
+		tables = append(tables, splicetype.SampleEvents(s.Path, f, sampleOpt, genes, index, 5))
+	}
+
+	events, counts := splicetype.CountEvents(tables, *eventsMin)
+	results := []*splicetype.OutlierResult{}
+	for _, p := range patients {
+		scored := splicetype.ScoreOutliers(selected[p].ID, events, counts, p, controls, opt)
+		tested, significant := 0, 0
+		for _, r := range scored {
+			if !math.IsNaN(r.P) {
+				tested++
+			}
+			if r.Q < 0.05 {
+				significant++
+			}
+		}
+		fmt.Printf("%s: events %d, scored %d, outliers at 5%% FDR %d\n", selected[p].ID, len(scored), tested, significant)
+		results = append(results, scored...)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	if err := splicetype.WriteOutliers(f, results); err != nil {
+		log.Fatal(err)
+	}
+}